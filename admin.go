@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/cron"
+	"tutorial/flags"
+	"tutorial/middleware"
+	"tutorial/problem"
+	"tutorial/profiling"
+	"tutorial/requestid"
+	"tutorial/routes"
+)
+
+// setupAdminRouter builds the internal engine served on admin.addr. Nothing
+// on it is reachable through the public router.
+func (a *app) setupAdminRouter(public *gin.Engine) *gin.Engine {
+	router := gin.New()
+	// Cannot fail: setupRouter has already applied the same list.
+	router.SetTrustedProxies(a.store.Load().Server.TrustedProxies)
+	router.Use(
+		requestid.Middleware(),
+		middleware.AccessLog(slog.Default(), a.store.Load),
+		a.auditMiddleware(),
+		middleware.Recovery(slog.Default()),
+		problem.Handler(),
+	)
+	router.NoRoute(problem.NoRoute)
+
+	const owner = "platform"
+	open := routes.Meta{Auth: "none", Owner: owner}
+	token := routes.Meta{Auth: "admin token", Owner: owner}
+	describe := func(m routes.Meta, description string) routes.Meta {
+		m.Description = description
+		return m
+	}
+
+	r := a.adminRoutes.Wrap(&router.RouterGroup)
+	auth := middleware.AdminAuth(a.store.Load)
+
+	r.GET("/livez", describe(open, "Liveness probe."), a.health.Livez)
+	r.GET("/readyz", describe(open, "Readiness probe; fails during shutdown."), a.health.Readyz)
+	r.GET("/healthz", describe(open, "Dependency check report; add ?verbose for details."), a.health.Healthz)
+
+	r.GET("/metrics", describe(open, "Prometheus metrics."), gin.WrapH(a.metrics.Handler()))
+
+	profiling.Register(r.Group("/debug", a.debugEnabled, auth), token)
+
+	r.GET("/traces", describe(open, "Recently finished spans; filter with ?trace_id."), func(c *gin.Context) {
+		spans := a.spans.Spans()
+		if id := c.Query("trace_id"); id != "" {
+			matching := spans[:0]
+			for _, s := range spans {
+				if s.SpanContext.TraceID.String() == id {
+					matching = append(matching, s)
+				}
+			}
+			spans = matching
+		}
+		c.JSON(http.StatusOK, spans)
+	})
+
+	r.GET("/routes", describe(open, "Routes of both listeners; ?format=json|table|markdown, ?prefix, ?method, ?listener."), func(c *gin.Context) {
+		listed := a.listRoutes(public, router, c.Query("listener"), c.Query("prefix"), c.Query("method"))
+		format := c.DefaultQuery("format", routes.FormatJSON)
+		if format == routes.FormatJSON {
+			c.JSON(http.StatusOK, listed)
+			return
+		}
+		var buf bytes.Buffer
+		for _, l := range listed {
+			buf.WriteString("## " + l.Listener + "\n\n")
+			if err := routes.Write(&buf, format, l.Routes); err != nil {
+				c.Error(problem.BadRequest("invalid_format", err.Error()))
+				return
+			}
+			buf.WriteString("\n")
+		}
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", buf.Bytes())
+	})
+
+	r.GET("/audit/verify", describe(token, "Verifies the audit log hash chain."), auth, func(c *gin.Context) {
+		if a.audit == nil {
+			c.Error(problem.NotFound("audit_disabled", "Auditing is not enabled."))
+			return
+		}
+		rep := a.audit.Verify()
+		status := http.StatusOK
+		if !rep.OK {
+			status = http.StatusConflict
+		}
+		c.JSON(status, rep)
+	})
+
+	r.GET("/cron", describe(open, "Maintenance tasks with their schedules, next runs and last results."), func(c *gin.Context) {
+		c.JSON(http.StatusOK, a.cron.Tasks())
+	})
+	r.POST("/cron/:name/run", describe(token, "Runs a maintenance task now."), auth, func(c *gin.Context) {
+		name := c.Param("name")
+		switch err := a.cron.Trigger(name); {
+		case errors.Is(err, cron.ErrNotFound):
+			c.Error(problem.NotFound("task_not_found", "There is no such maintenance task."))
+			return
+		case errors.Is(err, cron.ErrRunning):
+			c.Error(problem.Conflict("task_running", "The task is already running."))
+			return
+		case errors.Is(err, cron.ErrStopped):
+			c.Error(problem.New(http.StatusServiceUnavailable, "shutting_down", "The server is shutting down."))
+			return
+		case err != nil:
+			c.Error(err)
+			return
+		}
+		c.Header("Location", "/cron")
+		c.JSON(http.StatusAccepted, gin.H{"status": "started", "task": name})
+	})
+
+	flags.NewHandler(a.flags).Register(r.Group("/flags", auth), token)
+
+	cfg := r.Group("/config", auth)
+	cfg.GET("", describe(token, "Current configuration with secrets redacted."), func(c *gin.Context) {
+		var buf bytes.Buffer
+		if err := a.store.Load().Print(&buf); err != nil {
+			c.Error(err)
+			return
+		}
+		c.Data(http.StatusOK, "application/toml; charset=utf-8", buf.Bytes())
+	})
+	cfg.POST("/reload", describe(token, "Re-reads the configuration."), func(c *gin.Context) {
+		if err := a.store.Reload(); err != nil {
+			c.Error(problem.New(http.StatusUnprocessableEntity, "invalid_config", err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "reloaded"})
+	})
+
+	return router
+}
+
+type listenerRoutes struct {
+	Listener string         `json:"listener"`
+	Routes   []routes.Route `json:"routes"`
+}
+
+// listRoutes lists the routes of the public and admin engines, or only the
+// one named by listener.
+func (a *app) listRoutes(public, admin *gin.Engine, listener, prefix, method string) []listenerRoutes {
+	var out []listenerRoutes
+	if listener == "" || listener == "public" {
+		out = append(out, listenerRoutes{"public", routes.Filter(a.publicRoutes.List(public), prefix, method)})
+	}
+	if listener == "" || listener == "admin" {
+		out = append(out, listenerRoutes{"admin", routes.Filter(a.adminRoutes.List(admin), prefix, method)})
+	}
+	return out
+}
+
+// debugEnabled hides the profiling endpoints unless debug.endpoints allows
+// them; it is read on every request so a reload takes effect immediately.
+func (a *app) debugEnabled(c *gin.Context) {
+	if !a.store.Load().DebugEnabled() {
+		problem.NoRoute(c)
+		c.Abort()
+	}
+}
@@ -0,0 +1,51 @@
+package albums
+
+import "slices"
+
+// Album is a record album. ID is chosen by the client or generated on
+// create.
+type Album struct {
+	ID     string  `json:"id" binding:"omitempty,max=64,alphanum"`
+	Title  string  `json:"title" binding:"required,max=200"`
+	Artist string  `json:"artist" binding:"required,max=200"`
+	Year   int     `json:"year,omitempty" binding:"omitempty,gte=1900,lte=2100"`
+	Price  float64 `json:"price" binding:"gte=0"`
+	Tracks []Track `json:"tracks,omitempty" binding:"max=100,dive"`
+}
+
+type Track struct {
+	Title   string `json:"title" binding:"required,max=200"`
+	Seconds int    `json:"seconds,omitempty" binding:"gte=0"`
+}
+
+// patch is the body of PATCH: only the fields present are changed.
+type patch struct {
+	Title  *string  `json:"title" binding:"omitempty,min=1,max=200"`
+	Artist *string  `json:"artist" binding:"omitempty,min=1,max=200"`
+	Year   *int     `json:"year" binding:"omitempty,gte=1900,lte=2100"`
+	Price  *float64 `json:"price" binding:"omitempty,gte=0"`
+	Tracks *[]Track `json:"tracks" binding:"omitempty,max=100,dive"`
+}
+
+func (p patch) apply(a *Album) {
+	if p.Title != nil {
+		a.Title = *p.Title
+	}
+	if p.Artist != nil {
+		a.Artist = *p.Artist
+	}
+	if p.Year != nil {
+		a.Year = *p.Year
+	}
+	if p.Price != nil {
+		a.Price = *p.Price
+	}
+	if p.Tracks != nil {
+		a.Tracks = *p.Tracks
+	}
+}
+
+func (a Album) clone() Album {
+	a.Tracks = slices.Clone(a.Tracks)
+	return a
+}
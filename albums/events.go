@@ -0,0 +1,26 @@
+package albums
+
+import (
+	"tutorial/storage"
+)
+
+// Event types a KVStore with an Outbox records.
+const (
+	EventCreated = "album.created"
+	EventUpdated = "album.updated"
+	EventDeleted = "album.deleted"
+)
+
+// EventTypes lists every event type albums publish.
+var EventTypes = []string{EventCreated, EventUpdated, EventDeleted}
+
+// Outbox records events about album changes. The event is written in the
+// same storage.KV.Apply as the change, so a crash or a failed write never
+// stores one without the other.
+type Outbox interface {
+	// Stage returns the write that records an event of type typ carrying
+	// data.
+	Stage(typ string, data any) (storage.Op, error)
+	// Notify is called once staged events are written.
+	Notify()
+}
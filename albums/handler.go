@@ -0,0 +1,154 @@
+package albums
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+	"tutorial/routes"
+)
+
+// Handler serves the albums API.
+type Handler struct {
+	store Store
+}
+
+func NewHandler(store Store) *Handler {
+	return &Handler{store: store}
+}
+
+type albumURI struct {
+	ID string `uri:"id" binding:"required,max=64,alphanum"`
+}
+
+// Register mounts the albums API on r, typically the /api/v1/albums group.
+func (h *Handler) Register(r routes.Router) {
+	meta := func(description string) routes.Meta {
+		return routes.Meta{Description: description, Auth: "none", Owner: "catalog"}
+	}
+	r.GET("", meta("Lists albums ordered by ID."), h.list)
+	r.POST("", meta("Creates an album; 409 if the ID is taken."), h.create)
+	r.GET("/:id", meta("Returns one album."), h.get)
+	r.PUT("/:id", meta("Replaces an album."), h.replace)
+	r.PATCH("/:id", meta("Changes the given fields of an album."), h.patch)
+	r.DELETE("/:id", meta("Deletes an album."), h.delete)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	all, err := h.store.List(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, all)
+}
+
+func (h *Handler) get(c *gin.Context) {
+	var uri albumURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	a, err := h.store.Get(c.Request.Context(), uri.ID)
+	if err != nil {
+		c.Error(storeError(err, uri.ID))
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+func (h *Handler) create(c *gin.Context) {
+	var a Album
+	if err := c.ShouldBindJSON(&a); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	if a.ID == "" {
+		a.ID = newID()
+	}
+	if err := h.store.Create(c.Request.Context(), a); err != nil {
+		c.Error(storeError(err, a.ID))
+		return
+	}
+	c.Header("Location", c.FullPath()+"/"+a.ID)
+	c.JSON(http.StatusCreated, a)
+}
+
+func (h *Handler) replace(c *gin.Context) {
+	var uri albumURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	var a Album
+	if err := c.ShouldBindJSON(&a); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	if a.ID != "" && a.ID != uri.ID {
+		c.Error(problem.BadRequest("id_mismatch", "The body's id does not match the URL."))
+		return
+	}
+	a.ID = uri.ID
+	if err := h.store.Replace(c.Request.Context(), a); err != nil {
+		c.Error(storeError(err, a.ID))
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+func (h *Handler) patch(c *gin.Context) {
+	var uri albumURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	var p patch
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	a, err := h.store.Update(c.Request.Context(), uri.ID, func(a *Album) error {
+		p.apply(a)
+		return nil
+	})
+	if err != nil {
+		c.Error(storeError(err, uri.ID))
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	var uri albumURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	if err := h.store.Delete(c.Request.Context(), uri.ID); err != nil {
+		c.Error(storeError(err, uri.ID))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// storeError maps store errors to problems; anything else becomes a 500.
+func storeError(err error, id string) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return problem.NotFound("album_not_found", "There is no album with id "+id+".")
+	case errors.Is(err, ErrExists):
+		return problem.Conflict("album_exists", "An album with id "+id+" already exists.")
+	}
+	return err
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,127 @@
+package albums
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"tutorial/storage"
+)
+
+const keyPrefix = "albums/"
+
+// KVStore keeps albums as JSON in a storage.KV under "albums/<id>".
+type KVStore struct {
+	kv     storage.KV
+	outbox Outbox
+	mu     sync.Mutex // makes the existence checks and writes atomic
+}
+
+// NewKVStore records an event in outbox with every change; outbox may be
+// nil.
+func NewKVStore(kv storage.KV, outbox Outbox) *KVStore {
+	return &KVStore{kv: kv, outbox: outbox}
+}
+
+func (s *KVStore) List(context.Context) ([]Album, error) {
+	out := []Album{}
+	var err error
+	scanErr := s.kv.Scan(keyPrefix, func(_ string, v []byte) bool {
+		var a Album
+		if err = json.Unmarshal(v, &a); err != nil {
+			return false
+		}
+		out = append(out, a)
+		return true
+	})
+	return out, errors.Join(scanErr, err)
+}
+
+func (s *KVStore) Get(_ context.Context, id string) (Album, error) {
+	v, err := s.kv.Get(keyPrefix + id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return Album{}, ErrNotFound
+	}
+	if err != nil {
+		return Album{}, err
+	}
+	var a Album
+	err = json.Unmarshal(v, &a)
+	return a, err
+}
+
+func (s *KVStore) Create(_ context.Context, a Album) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.kv.Get(keyPrefix + a.ID); err == nil {
+		return ErrExists
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return s.put(a, EventCreated)
+}
+
+func (s *KVStore) Replace(_ context.Context, a Album) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.exists(a.ID); err != nil {
+		return err
+	}
+	return s.put(a, EventUpdated)
+}
+
+func (s *KVStore) Update(ctx context.Context, id string, fn func(*Album) error) (Album, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, err := s.Get(ctx, id)
+	if err != nil {
+		return Album{}, err
+	}
+	if err := fn(&a); err != nil {
+		return Album{}, err
+	}
+	a.ID = id
+	return a, s.put(a, EventUpdated)
+}
+
+func (s *KVStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.exists(id); err != nil {
+		return err
+	}
+	return s.write(storage.Op{Key: keyPrefix + id, Delete: true}, EventDeleted, map[string]string{"id": id})
+}
+
+func (s *KVStore) exists(id string) error {
+	_, err := s.kv.Get(keyPrefix + id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *KVStore) put(a Album, event string) error {
+	v, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return s.write(storage.Op{Key: keyPrefix + a.ID, Value: v}, event, a)
+}
+
+// write makes op together with the event describing it.
+func (s *KVStore) write(op storage.Op, event string, data any) error {
+	if s.outbox == nil {
+		return s.kv.Apply(op)
+	}
+	staged, err := s.outbox.Stage(event, data)
+	if err != nil {
+		return err
+	}
+	if err := s.kv.Apply(op, staged); err != nil {
+		return err
+	}
+	s.outbox.Notify()
+	return nil
+}
@@ -0,0 +1,65 @@
+package albums
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tutorial/storage"
+)
+
+// outbox stages events under "outbox/<type>".
+type outbox struct{ notified int }
+
+func (o *outbox) Stage(typ string, _ any) (storage.Op, error) {
+	return storage.Op{Key: "outbox/" + typ, Value: []byte(typ)}, nil
+}
+
+func (o *outbox) Notify() { o.notified++ }
+
+// failingKV refuses batches, as a full disk would.
+type failingKV struct{ storage.KV }
+
+func (failingKV) Apply(...storage.Op) error { return errors.New("disk full") }
+
+func TestKVStoreWritesEventWithChange(t *testing.T) {
+	ctx := context.Background()
+	kv := storage.NewMemory()
+	o := &outbox{}
+	s := NewKVStore(kv, o)
+
+	a := Album{ID: "a1", Title: "Blue Train", Artist: "John Coltrane"}
+	if err := s.Create(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	a.Price = 10
+	if err := s.Replace(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "a1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range EventTypes {
+		if _, err := kv.Get("outbox/" + typ); err != nil {
+			t.Errorf("%s not staged: %v", typ, err)
+		}
+	}
+	if o.notified != 3 {
+		t.Errorf("notified %d times, want 3", o.notified)
+	}
+
+	failing := NewKVStore(failingKV{kv}, o)
+	kv.Delete("outbox/" + EventCreated)
+	if err := failing.Create(ctx, Album{ID: "a2", Title: "x", Artist: "y"}); err == nil {
+		t.Fatal("Create succeeded on a failing store")
+	}
+	if _, err := kv.Get(keyPrefix + "a2"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("album stored without its event: %v", err)
+	}
+	if _, err := kv.Get("outbox/" + EventCreated); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("event staged without its change: %v", err)
+	}
+	if o.notified != 3 {
+		t.Error("notified about a failed write")
+	}
+}
@@ -0,0 +1,35 @@
+package albums
+
+import "context"
+
+// Report summarises the catalogue.
+type Report struct {
+	Albums     int            `json:"albums"`
+	Tracks     int            `json:"tracks"`
+	TotalPrice float64        `json:"total_price"`
+	Artists    map[string]int `json:"artists"` // albums per artist
+	FirstYear  int            `json:"first_year,omitempty"`
+	LastYear   int            `json:"last_year,omitempty"`
+}
+
+// BuildReport reads every album in s and summarises them.
+func BuildReport(ctx context.Context, s Store) (Report, error) {
+	all, err := s.List(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	r := Report{Albums: len(all), Artists: map[string]int{}}
+	for _, a := range all {
+		r.Tracks += len(a.Tracks)
+		r.TotalPrice += a.Price
+		r.Artists[a.Artist]++
+		if a.Year == 0 {
+			continue
+		}
+		if r.FirstYear == 0 || a.Year < r.FirstYear {
+			r.FirstYear = a.Year
+		}
+		r.LastYear = max(r.LastYear, a.Year)
+	}
+	return r, nil
+}
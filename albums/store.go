@@ -0,0 +1,112 @@
+package albums
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrNotFound = errors.New("album not found")
+	ErrExists   = errors.New("album already exists")
+)
+
+// Store persists albums. Implementations must be safe for concurrent use.
+type Store interface {
+	List(ctx context.Context) ([]Album, error)
+	Get(ctx context.Context, id string) (Album, error)
+	// Create adds a, failing with ErrExists if its ID is taken.
+	Create(ctx context.Context, a Album) error
+	// Replace overwrites the album with a's ID, failing with ErrNotFound if
+	// there is none.
+	Replace(ctx context.Context, a Album) error
+	// Update applies fn to the album with id and stores the result, with no
+	// other change to it in between, and returns it. It fails with
+	// ErrNotFound if there is no such album and stores nothing if fn fails.
+	Update(ctx context.Context, id string, fn func(*Album) error) (Album, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryStore keeps albums in a map; its contents are lost on restart.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	albums map[string]Album
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{albums: map[string]Album{}}
+}
+
+func (s *MemoryStore) List(context.Context) ([]Album, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Album, 0, len(s.albums))
+	for _, a := range s.albums {
+		out = append(out, a.clone())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (Album, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.albums[id]
+	if !ok {
+		return Album{}, ErrNotFound
+	}
+	return a.clone(), nil
+}
+
+func (s *MemoryStore) Create(_ context.Context, a Album) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.albums[a.ID]; ok {
+		return ErrExists
+	}
+	s.albums[a.ID] = a.clone()
+	return nil
+}
+
+func (s *MemoryStore) Replace(_ context.Context, a Album) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.albums[a.ID]; !ok {
+		return ErrNotFound
+	}
+	s.albums[a.ID] = a.clone()
+	return nil
+}
+
+func (s *MemoryStore) Update(_ context.Context, id string, fn func(*Album) error) (Album, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.albums[id]
+	if !ok {
+		return Album{}, ErrNotFound
+	}
+	a = a.clone()
+	if err := fn(&a); err != nil {
+		return Album{}, err
+	}
+	a.ID = id
+	s.albums[id] = a.clone()
+	return a, nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.albums[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.albums, id)
+	return nil
+}
@@ -0,0 +1,58 @@
+package albums
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"tutorial/storage"
+)
+
+func TestUpdateIsAtomic(t *testing.T) {
+	for name, s := range map[string]Store{
+		"memory": NewMemoryStore(),
+		"kv":     NewKVStore(storage.NewMemory(), nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := s.Create(ctx, Album{ID: "a1", Title: "Blue Train", Artist: "John Coltrane"}); err != nil {
+				t.Fatal(err)
+			}
+
+			// Every update sees the one before, so none is lost.
+			const n = 50
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := s.Update(ctx, "a1", func(a *Album) error {
+						a.Year++
+						return nil
+					}); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+			if a, _ := s.Get(ctx, "a1"); a.Year != n {
+				t.Errorf("year %d after %d increments", a.Year, n)
+			}
+
+			boom := errors.New("boom")
+			if _, err := s.Update(ctx, "a1", func(a *Album) error {
+				a.Title = "changed"
+				return boom
+			}); !errors.Is(err, boom) {
+				t.Errorf("Update = %v, want the function's error", err)
+			}
+			if a, _ := s.Get(ctx, "a1"); a.Title != "Blue Train" {
+				t.Errorf("failed update stored title %q", a.Title)
+			}
+			if _, err := s.Update(ctx, "missing", func(*Album) error { return nil }); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Update of a missing album = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/config"
+)
+
+func newTestRouter(t *testing.T, args ...string) *gin.Engine {
+	t.Helper()
+	_, router := newTestApp(t, args...)
+	return router
+}
+
+// newTestApp builds an app from args on top of test defaults, with its public
+// router, and shuts it down when the test ends.
+func newTestApp(t *testing.T, args ...string) (*app, *gin.Engine) {
+	t.Helper()
+	args = append([]string{"-server.mode=test", "-blobs.dir=" + t.TempDir()}, args...)
+	store, err := config.NewStore("test", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newApp(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, h := range a.hooks {
+			h.Fn(context.Background())
+		}
+	})
+	router, err := a.setupRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, router
+}
+
+func TestAlbums(t *testing.T) {
+	engines := map[string][]string{
+		"memory": {"-storage.engine=memory"},
+		"disk":   {"-storage.engine=disk", "-storage.dir=" + t.TempDir()},
+	}
+	for name, args := range engines {
+		t.Run(name, func(t *testing.T) { testAlbums(t, newTestRouter(t, args...)) })
+	}
+}
+
+func testAlbums(t *testing.T, router *gin.Engine) {
+
+	// The steps share one router, so each sees what the previous ones did.
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantHeader map[string]string
+		wantBody   string // substring of the response body
+	}{
+		{"list empty", "GET", "/api/v1/albums", "", 200, nil, `[]`},
+		{"create", "POST", "/api/v1/albums", `{"id":"bluetrain","title":"Blue Train","artist":"John Coltrane","price":56.99}`,
+			201, map[string]string{"Location": "/api/v1/albums/bluetrain"}, `"title":"Blue Train"`},
+		{"create generates id", "POST", "/api/v1/albums", `{"title":"Jeru","artist":"Gerry Mulligan","price":17.99}`,
+			201, nil, `"id":"`},
+		{"create duplicate", "POST", "/api/v1/albums", `{"id":"bluetrain","title":"Blue Train","artist":"John Coltrane"}`,
+			409, map[string]string{"Content-Type": "application/problem+json"}, `"code":"album_exists"`},
+		{"create invalid", "POST", "/api/v1/albums", `{"id":"x","artist":"","price":-1,"tracks":[{"seconds":3}]}`,
+			422, nil, `"field":"tracks[0].title"`},
+		{"create malformed", "POST", "/api/v1/albums", `{"title":`, 400, nil, `"code":"malformed_request"`},
+		{"get", "GET", "/api/v1/albums/bluetrain", "", 200, nil, `"artist":"John Coltrane"`},
+		{"get missing", "GET", "/api/v1/albums/nope", "", 404, nil, `"code":"album_not_found"`},
+		{"get invalid id", "GET", "/api/v1/albums/not-an-id", "", 422, nil, `"field":"id"`},
+		{"replace", "PUT", "/api/v1/albums/bluetrain", `{"title":"Blue Train (Remastered)","artist":"John Coltrane","price":20}`,
+			200, nil, `"title":"Blue Train (Remastered)"`},
+		{"replace id mismatch", "PUT", "/api/v1/albums/bluetrain", `{"id":"other","title":"x","artist":"y"}`,
+			400, nil, `"code":"id_mismatch"`},
+		{"replace missing", "PUT", "/api/v1/albums/nope", `{"title":"x","artist":"y"}`, 404, nil, `"code":"album_not_found"`},
+		{"patch", "PATCH", "/api/v1/albums/bluetrain", `{"price":9.5}`, 200, nil, `"price":9.5`},
+		{"patch keeps other fields", "GET", "/api/v1/albums/bluetrain", "", 200, nil, `"title":"Blue Train (Remastered)"`},
+		{"patch invalid", "PATCH", "/api/v1/albums/bluetrain", `{"title":""}`, 422, nil, `"field":"title"`},
+		{"patch missing", "PATCH", "/api/v1/albums/nope", `{"price":1}`, 404, nil, `"code":"album_not_found"`},
+		{"delete", "DELETE", "/api/v1/albums/bluetrain", "", 204, nil, ``},
+		{"delete again", "DELETE", "/api/v1/albums/bluetrain", "", 404, nil, `"code":"album_not_found"`},
+		{"get deleted", "GET", "/api/v1/albums/bluetrain", "", 404, nil, `"code":"album_not_found"`},
+	}
+
+	for _, s := range steps {
+		req := httptest.NewRequest(s.method, s.path, strings.NewReader(s.body))
+		if s.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != s.wantStatus {
+			t.Errorf("%s: status = %d, want %d; body: %s", s.name, w.Code, s.wantStatus, w.Body)
+			continue
+		}
+		for k, v := range s.wantHeader {
+			if got := w.Header().Get(k); got != v {
+				t.Errorf("%s: %s = %q, want %q", s.name, k, got, v)
+			}
+		}
+		if !strings.Contains(w.Body.String(), s.wantBody) {
+			t.Errorf("%s: body %s does not contain %s", s.name, w.Body, s.wantBody)
+		}
+	}
+}
+
+func TestAlbumsListOrder(t *testing.T) {
+	router := newTestRouter(t)
+	for _, id := range []string{"c", "a", "b"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/albums", strings.NewReader(`{"id":"`+id+`","title":"t","artist":"a"}`))
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %s: %d %s", id, w.Code, w.Body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/albums", nil))
+	var got []struct{ ID string }
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].ID != "a" || got[1].ID != "b" || got[2].ID != "c" {
+		t.Errorf("list = %+v, want a, b, c", got)
+	}
+}
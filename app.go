@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/albums"
+	"tutorial/audit"
+	"tutorial/blobs"
+	"tutorial/config"
+	"tutorial/cron"
+	"tutorial/events"
+	"tutorial/flags"
+	"tutorial/health"
+	"tutorial/httpclient"
+	"tutorial/jobs"
+	"tutorial/links"
+	"tutorial/metrics"
+	"tutorial/middleware"
+	"tutorial/problem"
+	"tutorial/requestid"
+	"tutorial/routes"
+	"tutorial/server"
+	"tutorial/storage"
+	"tutorial/todos"
+	"tutorial/tracing"
+	"tutorial/views"
+	"tutorial/webhooks"
+	"tutorial/websocket"
+)
+
+// app holds what the public and admin routers share.
+type app struct {
+	store    *config.Store
+	metrics  *metrics.Registry
+	tracer   *tracing.Tracer
+	spans    *tracing.Ring
+	client   *http.Client
+	health   *health.Registry
+	audit    *audit.Log // nil unless audit.enabled
+	kv       storage.KV
+	albums   albums.Store
+	todos    *todos.Store
+	links    *links.Store
+	clicks   *links.Recorder
+	blobs    *blobs.Store
+	events   *events.Broker
+	hub      *websocket.Hub
+	jobs     *jobs.Queue
+	webhooks *webhooks.Dispatcher
+	cron     *cron.Scheduler
+	flags    *flags.Service
+
+	publicRoutes *routes.Catalog
+	adminRoutes  *routes.Catalog
+
+	// hooks release what newApp acquired, newest first; they run on
+	// shutdown.
+	hooks []server.Hook
+}
+
+func newApp(store *config.Store) (_ *app, err error) {
+	cfg := store.Load()
+	a := &app{
+		store:   store,
+		metrics: metrics.NewRegistry(),
+		spans:   tracing.NewRing(cfg.Tracing.RingSize),
+		health:  health.NewRegistry(cfg.Health.CacheTTL.Std()),
+
+		publicRoutes: routes.NewCatalog(),
+		adminRoutes:  routes.NewCatalog(),
+	}
+	metrics.RegisterRuntime(a.metrics)
+
+	// If a step fails, release what the ones before it acquired.
+	defer func() {
+		if err != nil {
+			for _, h := range a.hooks {
+				h.Fn(context.Background())
+			}
+		}
+	}()
+
+	loc, err := time.LoadLocation(cfg.Cron.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	a.cron = cron.New(loc)
+
+	exporters := tracing.Exporters{a.spans}
+	if cfg.Tracing.File != "" {
+		f, err := tracing.NewFileExporter(cfg.Tracing.File)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, f)
+		a.onShutdown("tracing", func(context.Context) error { return f.Close() })
+	}
+	a.tracer = tracing.NewTracer(exporters)
+	a.client = httpclient.New(30*time.Second, a.tracer)
+
+	if cfg.Audit.Enabled {
+		l, err := audit.Open(cfg.Audit.Dir, cfg.Audit.MaxSegmentBytes)
+		if err != nil {
+			return nil, err
+		}
+		a.audit = l
+		a.onShutdown("audit", func(context.Context) error { return l.Close() })
+	}
+	if cfg.Storage.Engine == "disk" {
+		d, err := storage.Open(cfg.Storage.Dir, storage.Options{
+			Sync:             storage.SyncPolicy(cfg.Storage.Sync),
+			SyncInterval:     cfg.Storage.SyncInterval.Std(),
+			SnapshotInterval: cfg.Storage.SnapshotInterval.Std(),
+			MaxWALBytes:      cfg.Storage.MaxWALBytes,
+		})
+		if err != nil {
+			return nil, err
+		}
+		a.kv = d
+	} else {
+		a.kv = storage.NewMemory()
+	}
+	a.onShutdown("storage", func(context.Context) error { return a.kv.Close() })
+
+	// Webhook URLs come from API callers, so deliveries only go to public
+	// addresses unless allowed otherwise.
+	whClient := httpclient.Public(30*time.Second, a.tracer)
+	if cfg.Webhooks.AllowPrivate {
+		whClient = a.client
+	}
+	wh, err := webhooks.New(a.kv, whClient, webhooks.Options{
+		EventTypes:   albums.EventTypes,
+		Concurrency:  cfg.Webhooks.Concurrency,
+		Timeout:      cfg.Webhooks.Timeout.Std(),
+		Backoff:      cfg.Webhooks.Backoff.Std(),
+		MaxBackoff:   cfg.Webhooks.MaxBackoff.Std(),
+		MaxAttempts:  cfg.Webhooks.MaxAttempts,
+		DisableAfter: cfg.Webhooks.DisableAfter,
+		Retention:    cfg.Webhooks.Retention.Std(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.webhooks = wh
+	a.albums = albums.NewKVStore(a.kv, wh)
+	wh.Start()
+	a.onShutdown("webhooks", wh.Close)
+
+	q, err := jobs.NewQueue(a.kv, jobs.Options{
+		Workers:     cfg.Jobs.Workers,
+		Size:        cfg.Jobs.Queue,
+		MaxAttempts: cfg.Jobs.MaxAttempts,
+		Backoff:     cfg.Jobs.Backoff.Std(),
+		MaxBackoff:  cfg.Jobs.MaxBackoff.Std(),
+		Timeout:     cfg.Jobs.Timeout.Std(),
+		Retention:   cfg.Jobs.Retention.Std(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.jobs = q
+	jobs.Register(q, "demo.sleep", jobs.Sleep)
+	jobs.Register(q, "albums.report", func(ctx context.Context, _ *jobs.Task, _ struct{}) (any, error) {
+		return albums.BuildReport(ctx, a.albums)
+	})
+	q.Start()
+	a.onShutdown("jobs", q.Close)
+
+	// The definitions were checked by checkFlags when the config was loaded,
+	// so decoding them again cannot fail.
+	var defs atomic.Pointer[[]flags.Flag]
+	decodeFlags := func(cfg *config.Config) {
+		fs, _ := flags.Decode(cfg.Flags.Flag)
+		defs.Store(&fs)
+	}
+	decodeFlags(cfg)
+	a.store.OnReload(func(_, cur *config.Config) { decodeFlags(cur) })
+	fl, err := flags.NewService(a.kv, func() []flags.Flag { return *defs.Load() })
+	if err != nil {
+		return nil, err
+	}
+	a.flags = fl
+
+	a.todos = todos.NewStore(a.kv)
+	a.links = links.NewStore(a.kv)
+	a.clicks = links.NewRecorder(a.links, 4096, time.Second)
+	a.onShutdown("clicks", a.clicks.Close)
+	b, err := blobs.Open(cfg.Blobs.Dir, a.kv, cfg.Blobs.AllowedTypes)
+	if err != nil {
+		return nil, err
+	}
+	a.blobs = b
+	if err := a.scheduleMaintenance(cfg.Cron); err != nil {
+		return nil, err
+	}
+	a.cron.Start()
+	a.onShutdown("cron", a.cron.Stop)
+	a.events = events.NewBroker(events.Options{
+		History:   cfg.Events.History,
+		Buffer:    cfg.Events.Buffer,
+		MaxTopics: cfg.Events.MaxTopics,
+		Retention: cfg.Events.Retention.Std(),
+	})
+	a.hub = websocket.NewHub(websocket.HubOptions{
+		Queue:        cfg.WebSocket.Queue,
+		MaxMessage:   cfg.WebSocket.MaxMessageBytes,
+		PingInterval: cfg.WebSocket.PingInterval.Std(),
+	})
+	a.registerChecks()
+	a.metrics.Register(metrics.CollectorFunc(func(e *metrics.Encoder) {
+		st := a.events.Stats()
+		e.Header("events_topics", "Topics of the event broker.", "gauge")
+		e.Sample("events_topics", float64(st.Topics))
+		e.Header("events_subscribers", "Open event streams.", "gauge")
+		e.Sample("events_subscribers", float64(st.Subscribers))
+		e.Header("events_dropped_subscribers_total", "Event streams disconnected for falling behind.", "counter")
+		e.Sample("events_dropped_subscribers_total", float64(st.Dropped))
+
+		e.Header("jobs", "Background jobs by state.", "gauge")
+		for state, n := range a.jobs.Stats() {
+			e.Sample("jobs", float64(n), "state", string(state))
+		}
+
+		e.Header("webhook_deliveries", "Webhook deliveries in the delivery log by state.", "gauge")
+		for state, n := range a.webhooks.Stats() {
+			e.Sample("webhook_deliveries", float64(n), "state", string(state))
+		}
+
+		tasks := a.cron.Tasks()
+		e.Header("cron_runs_total", "Runs of maintenance tasks.", "counter")
+		for _, t := range tasks {
+			e.Sample("cron_runs_total", float64(t.Runs), "task", t.Name)
+		}
+		e.Header("cron_failures_total", "Failed runs of maintenance tasks.", "counter")
+		for _, t := range tasks {
+			e.Sample("cron_failures_total", float64(t.Failed), "task", t.Name)
+		}
+
+		e.Header("websocket_room_members", "WebSocket connections per room.", "gauge")
+		for room, n := range a.hub.Rooms() {
+			e.Sample("websocket_room_members", float64(n), "room", room)
+		}
+	}))
+	return a, nil
+}
+
+// registerChecks adds the dependency checks behind /readyz and /healthz.
+// Without storage or, when enabled, the audit log requests fail or go
+// unrecorded, so those are critical; a stuck job queue or failing webhook
+// endpoints only degrade the service.
+func (a *app) registerChecks() {
+	a.health.Register(health.Check{Name: "storage", Critical: true, Fn: func(context.Context) error {
+		return storage.Ping(a.kv)
+	}})
+	if a.audit != nil {
+		a.health.Register(health.Check{Name: "audit", Critical: true, Fn: a.audit.Check})
+	}
+	a.health.Register(health.Check{Name: "jobs", Fn: a.jobs.Check})
+	a.health.Register(health.Check{Name: "webhooks", Fn: a.webhooks.Check})
+}
+
+// scheduleMaintenance adds the maintenance tasks that have a schedule and
+// something to work on.
+func (a *app) scheduleMaintenance(cfg config.CronConfig) error {
+	var tasks []cron.Task
+	if cfg.PurgeLinks != "" {
+		tasks = append(tasks, cron.Task{Name: "purge_links", Schedule: cfg.PurgeLinks, Func: func(context.Context) (string, error) {
+			n, err := a.links.PurgeExpired(time.Now())
+			return fmt.Sprintf("purged %d expired links", n), err
+		}})
+	}
+	if d, ok := a.kv.(*storage.Disk); ok && cfg.CompactStorage != "" {
+		tasks = append(tasks, cron.Task{Name: "compact_storage", Schedule: cfg.CompactStorage, Func: func(context.Context) (string, error) {
+			return "compacted", d.Compact()
+		}})
+	}
+	if a.audit != nil && cfg.RotateAudit != "" {
+		tasks = append(tasks, cron.Task{Name: "rotate_audit", Schedule: cfg.RotateAudit, Func: func(context.Context) (string, error) {
+			return "rotated", a.audit.Rotate()
+		}})
+	}
+	for _, t := range tasks {
+		t.Jitter = cfg.Jitter.Std()
+		if err := a.cron.Add(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditMiddleware records mutating requests if auditing is enabled.
+func (a *app) auditMiddleware() gin.HandlerFunc {
+	if a.audit == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return audit.Middleware(a.audit, a.store.Load().Blobs.MaxUploadBytes)
+}
+
+// onShutdown registers fn to run before the hooks registered earlier, so
+// that everything is released before what it depends on: maintenance stops
+// first, job runs and webhook deliveries finish while tracing still exports
+// their spans, and storage closes last.
+func (a *app) onShutdown(name string, fn func(context.Context) error) {
+	a.hooks = append([]server.Hook{{Name: name, Fn: fn}}, a.hooks...)
+}
+
+func (a *app) setupRouter() (*gin.Engine, error) {
+	cfg := a.store.Load()
+	gin.SetMode(cfg.Server.Mode)
+	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, err
+	}
+	router.Use(
+		requestid.Middleware(),
+		middleware.AccessLog(slog.Default(), a.store.Load),
+		a.auditMiddleware(),
+		middleware.Recovery(slog.Default()),
+		tracing.Middleware(a.tracer),
+		middleware.Metrics(a.metrics, cfg.Metrics.Buckets),
+		middleware.CORS(a.store.Load),
+		middleware.RateLimit(a.store.Load),
+		middleware.Maintenance(a.store.Load),
+		flags.Middleware(a.flags, a.flagSubject),
+		problem.Handler(),
+	)
+
+	router.NoRoute(problem.NoRoute)
+
+	html, err := views.Install(router, a.viewOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	r := a.publicRoutes.Wrap(&router.RouterGroup)
+	r.GET("/", routes.Meta{Description: "Greets the caller.", Auth: "none", Owner: "platform"}, func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"message": "hello world",
+		})
+	})
+
+	api := r.Group("/api/v1")
+	albums.NewHandler(a.albums).Register(api.Group("/albums"))
+	blobs.NewHandler(a.blobs, cfg.Blobs.MaxUploadBytes).Register(r.Group("/api/files"))
+	jobs.NewHandler(a.jobs).Register(r.Group("/api/jobs"))
+	webhooks.NewHandler(a.webhooks).Register(r.Group("/api/webhooks"))
+	flags.NewHandler(a.flags).RegisterEvaluations(r.Group("/api/flags"))
+
+	r.GET("/static/*filepath", routes.Meta{Description: "Stylesheets and other static assets.", Auth: "none", Owner: "platform"}, html.Static())
+	todos.NewHandler(a.todos, a.publicRoutes).Register(r.Group("/todos"))
+
+	eh := events.NewHandler(a.events, cfg.Events.Heartbeat.Std())
+	eh.RegisterStream(r.Group("/events"))
+	eh.RegisterAPI(r.Group("/api/events"))
+	websocket.NewHandler(a.hub, func() []string { return a.store.Load().CORS.AllowedOrigins }).Register(r.Group("/ws"))
+	r.GET("/chat", routes.Meta{Name: "chat", Description: "Chat room page; ?room= picks the room.", Auth: "none", Owner: "platform"}, events.Chat)
+
+	// Registered last; static routes such as /todos win over /:code, and
+	// reservedCode keeps codes from shadowing them.
+	lh := links.NewHandler(a.links, a.clicks, reservedCode(router))
+	lh.RegisterAPI(r.Group("/api/links"))
+	lh.RegisterRedirect(r)
+
+	return router, nil
+}
+
+// flagSubject identifies the caller of r for feature flags by the headers
+// named in flags.user_header and flags.tenant_header.
+func (a *app) flagSubject(r *http.Request) flags.Subject {
+	cfg := a.store.Load().Flags
+	return flags.Subject{
+		User:   r.Header.Get(cfg.UserHeader),
+		Tenant: r.Header.Get(cfg.TenantHeader),
+		Header: r.Header,
+	}
+}
+
+// reservedCode reports whether code is the first path segment of another
+// route on engine, which a link with that code would be hidden behind.
+func reservedCode(engine *gin.Engine) func(string) bool {
+	return func(code string) bool {
+		for _, ri := range engine.Routes() {
+			first, _, _ := strings.Cut(strings.TrimPrefix(ri.Path, "/"), "/")
+			if strings.EqualFold(first, code) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// viewOptions reads templates from the source tree and reparses them on
+// every request in debug mode, when run from the repository root; otherwise
+// the embedded copies are used.
+func (a *app) viewOptions() views.Options {
+	opts := views.Options{
+		Funcs: template.FuncMap{"url": a.publicRoutes.URL},
+	}
+	if gin.IsDebugging() {
+		if _, err := os.Stat("views/templates"); err == nil {
+			opts.FS = os.DirFS("views")
+			opts.Reload = true
+		}
+	}
+	return opts
+}
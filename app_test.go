@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tutorial/config"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	dir := t.TempDir()
+	a, _ := newTestApp(t,
+		"-tracing.file="+filepath.Join(dir, "spans.jsonl"),
+		"-audit.enabled", "-audit.dir="+filepath.Join(dir, "audit"),
+	)
+	var names []string
+	for _, h := range a.hooks {
+		names = append(names, h.Name)
+	}
+	// Spans of the last job runs and deliveries are exported before tracing
+	// closes, and nothing writes to storage once it is closed.
+	want := "cron clicks jobs webhooks storage audit tracing"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("shutdown order %q, want %q", got, want)
+	}
+}
+
+// openFilesUnder counts the files the process has open below dir.
+func openFilesUnder(t *testing.T, dir string) int {
+	t.Helper()
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("no /proc/self/fd:", err)
+	}
+	n := 0
+	for _, fd := range fds {
+		if target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); err == nil && strings.HasPrefix(target, dir) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestNewAppReleasesOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	// A file where the blob directory should be fails newApp after the
+	// trace file, audit log and disk storage are open.
+	blobs := filepath.Join(dir, "blobs")
+	os.WriteFile(blobs, nil, 0o600)
+	store, err := config.NewStore("test", []string{
+		"-server.mode=test",
+		"-blobs.dir=" + blobs,
+		"-tracing.file=" + filepath.Join(dir, "spans.jsonl"),
+		"-audit.enabled", "-audit.dir=" + filepath.Join(dir, "audit"),
+		"-storage.engine=disk", "-storage.dir=" + filepath.Join(dir, "data"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newApp(store); err == nil {
+		t.Fatal("newApp succeeded with a file as blobs.dir")
+	}
+	if n := openFilesUnder(t, dir); n != 0 {
+		t.Errorf("%d files left open after newApp failed", n)
+	}
+}
@@ -0,0 +1,214 @@
+package audit
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/sha3"
+)
+
+func appendN(t *testing.T, l *Log, n int) {
+	for i := 0; i < n; i++ {
+		if _, err := l.Append(Record{Method: "POST", Path: "/x", Status: 201}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestChainAcrossSegments(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendN(t, l, 20)
+	l.Close()
+
+	rep := Verify(dir)
+	if !rep.OK || rep.Records != 20 || rep.Head != 20 || rep.Segments < 2 {
+		t.Fatalf("Verify = %+v, want 20 records over several segments", rep)
+	}
+
+	// Reopening continues the chain.
+	l, err = Open(dir, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := l.Append(Record{Method: "DELETE"})
+	l.Close()
+	if err != nil || rec.Seq != 21 {
+		t.Fatalf("Append after reopen = %+v, %v", rec, err)
+	}
+	if rep := Verify(dir); !rep.OK || rep.Records != 21 {
+		t.Fatalf("Verify after reopen = %+v", rep)
+	}
+}
+
+func TestVerifyWhileAppending(t *testing.T) {
+	l, err := Open(t.TempDir(), 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 300; i++ {
+			if _, err := l.Append(Record{Method: "POST", Path: "/x", Status: 201}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for {
+		if rep := l.Verify(); !rep.OK {
+			t.Fatalf("Verify during appends = %+v", rep)
+		}
+		select {
+		case <-done:
+			if rep := l.Verify(); !rep.OK || rep.Records != 300 {
+				t.Fatalf("Verify after appends = %+v", rep)
+			}
+			return
+		default:
+		}
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, dir string)
+		want   string
+	}{
+		{"modified", func(t *testing.T, dir string) {
+			rewrite(t, dir, func(s string) string { return strings.Replace(s, `"status":201`, `"status":200`, 1) })
+		}, "was modified"},
+		{"last record removed", func(t *testing.T, dir string) {
+			rewrite(t, dir, func(s string) string {
+				lines := strings.SplitAfter(s, "\n")
+				return strings.Join(lines[:len(lines)-2], "")
+			})
+		}, "records were removed"},
+		{"record removed from the middle", func(t *testing.T, dir string) {
+			rewrite(t, dir, func(s string) string {
+				lines := strings.SplitAfter(s, "\n")
+				return strings.Join(append(lines[:1], lines[2:]...), "")
+			})
+		}, "expected seq 2"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		l, err := Open(dir, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendN(t, l, 3)
+		l.Close()
+		tt.tamper(t, dir)
+		if rep := Verify(dir); rep.OK || !strings.Contains(rep.Error, tt.want) {
+			t.Errorf("%s: Verify = %+v, want an error about %q", tt.name, rep, tt.want)
+		}
+	}
+}
+
+func rewrite(t *testing.T, dir string, fn func(string) string) {
+	path := filepath.Join(dir, "audit-000001.log")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(fn(string(b))), 0o640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenDropsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendN(t, l, 2)
+	l.Close()
+
+	// A crash in the middle of Append leaves half a line and an old HEAD.
+	f, err := os.OpenFile(filepath.Join(dir, "audit-000001.log"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":3,"time":"2024-`)
+	f.Close()
+
+	l, err = Open(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Open with a torn record: %v", err)
+	}
+	rec, err := l.Append(Record{Method: "POST"})
+	l.Close()
+	if err != nil || rec.Seq != 3 {
+		t.Fatalf("Append = %+v, %v", rec, err)
+	}
+	if rep := Verify(dir); !rep.OK || rep.Records != 3 {
+		t.Errorf("Verify = %+v", rep)
+	}
+}
+
+func TestMiddlewareBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	l, err := Open(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	router := gin.New()
+	router.Use(Middleware(l, 16))
+	// Reads only the first 4 bytes, as a handler with a body limit would.
+	router.POST("/partial", func(c *gin.Context) {
+		c.Request.Body.Read(make([]byte, 4))
+		c.Status(http.StatusNoContent)
+	})
+
+	sum := func(s string) string {
+		h := sha3.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	tests := []struct {
+		path, body string
+		hashed     string
+		truncated  bool
+	}{
+		{"/partial", "short body", "short body", false},
+		{"/partial", strings.Repeat("x", 16), strings.Repeat("x", 16), false},
+		{"/partial", strings.Repeat("x", 1000), strings.Repeat("x", 16), true},
+		// Unrouted requests are audited too, and drained the same way.
+		{"/missing", strings.Repeat("y", 1000), strings.Repeat("y", 16), true},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+
+		var last Record
+		if err := scan(l.segmentPath(1), func(rec Record, _ int) error {
+			last = rec
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if last.Seq != uint64(i+1) || last.Path != tt.path {
+			t.Fatalf("%s: last record %+v", tt.path, last)
+		}
+		if last.BodySHA3 != sum(tt.hashed) || last.Truncated != tt.truncated {
+			t.Errorf("%s with %d bytes: truncated = %v; want the hash of %d bytes, truncated = %v", tt.path, len(tt.body), last.Truncated, len(tt.hashed), tt.truncated)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// genesis is the prev hash of the first record ever written.
+var genesis = strings.Repeat("0", 64)
+
+const (
+	segmentPrefix = "audit-"
+	segmentSuffix = ".log"
+	headFile      = "HEAD"
+)
+
+// Record is one audited request. Hash is the SHA3-256 of the record's JSON
+// encoding with Hash left empty; since that encoding includes Prev, each
+// record commits to every record before it. Truncated means BodySHA3 covers
+// only the start of the body.
+type Record struct {
+	Seq       uint64            `json:"seq"`
+	Time      time.Time         `json:"time"`
+	Actor     string            `json:"actor"`
+	ClientIP  string            `json:"client_ip"`
+	Method    string            `json:"method"`
+	Route     string            `json:"route"`
+	Path      string            `json:"path"`
+	Params    map[string]string `json:"params,omitempty"`
+	Status    int               `json:"status"`
+	RequestID string            `json:"request_id,omitempty"`
+	BodySHA3  string            `json:"body_sha3"`
+	Truncated bool              `json:"body_truncated,omitempty"`
+	Prev      string            `json:"prev"`
+	Hash      string            `json:"hash,omitempty"`
+}
+
+func (r Record) digest() (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha3.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// head is the position of the newest record. It is kept in its own file so
+// that cutting records off the end of the log is detected.
+type head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// Log is an append-only, hash-chained audit log stored as numbered segment
+// files in a directory. The chain continues across segments.
+type Log struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	f       *os.File
+	segment int
+	size    int64
+	head    head
+	failed  error // of the last Append, if it failed
+}
+
+// Open opens the log in dir, creating it if needed, and resumes the chain
+// from the newest record. Segments rotate once they exceed maxBytes.
+func Open(dir string, maxBytes int64) (*Log, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	l := &Log{dir: dir, maxBytes: maxBytes, head: head{Hash: genesis}}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return l, l.openSegment(1)
+	}
+	if err := trimTornRecord(l.segmentPath(segments[len(segments)-1])); err != nil {
+		return nil, err
+	}
+
+	// Resume from the newest record, looking back past empty segments.
+	for i := len(segments) - 1; i >= 0; i-- {
+		last, err := lastRecord(l.segmentPath(segments[i]))
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			l.head = head{Seq: last.Seq, Hash: last.Hash}
+			break
+		}
+	}
+	return l, l.openSegment(segments[len(segments)-1])
+}
+
+func (l *Log) segmentPath(n int) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%s%06d%s", segmentPrefix, n, segmentSuffix))
+}
+
+func (l *Log) openSegment(n int) error {
+	f, err := os.OpenFile(l.segmentPath(n), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.segment, l.size = f, n, fi.Size()
+	return nil
+}
+
+// Append links rec to the chain, assigning Seq, Prev and Hash, and writes it
+// durably.
+func (l *Log) Append(rec Record) (Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec, err := l.append(rec)
+	l.failed = err
+	return rec, err
+}
+
+func (l *Log) append(rec Record) (Record, error) {
+	if l.f == nil {
+		return rec, errors.New("audit: log is closed")
+	}
+	if l.size >= l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return rec, err
+		}
+	}
+
+	rec.Seq = l.head.Seq + 1
+	rec.Prev = l.head.Hash
+	hash, err := rec.digest()
+	if err != nil {
+		return rec, err
+	}
+	rec.Hash = hash
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return rec, err
+	}
+	line = append(line, '\n')
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return rec, err
+	}
+	if err := l.f.Sync(); err != nil {
+		return rec, err
+	}
+
+	l.head = head{Seq: rec.Seq, Hash: rec.Hash}
+	return rec, l.writeHead()
+}
+
+// Check fails once the log is closed or while appending to it fails.
+func (l *Log) Check(context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return errors.New("audit: log is closed")
+	}
+	return l.failed
+}
+
+// writeHead replaces the HEAD file atomically.
+func (l *Log) writeHead() error {
+	b, err := json.Marshal(l.head)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(l.dir, headFile+".tmp")
+	if err := os.WriteFile(tmp, b, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(l.dir, headFile))
+}
+
+// Rotate starts a new segment. The next record still links to the last one
+// of the current segment.
+func (l *Log) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return errors.New("audit: log is closed")
+	}
+	if l.size == 0 {
+		return nil
+	}
+	return l.rotate()
+}
+
+func (l *Log) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	return l.openSegment(l.segment + 1)
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// trimTornRecord cuts a partial last line, left by a crash in the middle of
+// Append, off the segment at path. The record was never acknowledged: HEAD
+// is only written once a record is complete.
+func trimTornRecord(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	keep := bytes.LastIndexByte(b, '\n') + 1
+	if keep == len(b) {
+		return nil
+	}
+	slog.Warn("audit: dropping torn record", "segment", filepath.Base(path), "bytes", len(b)-keep)
+	if err := f.Truncate(int64(keep)); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func listSegments(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []int
+	for _, e := range entries {
+		var n int
+		name := e.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), "%d", &n); err == nil {
+			out = append(out, n)
+		}
+	}
+	sort.Ints(out)
+	return out, nil
+}
+
+func lastRecord(path string) (*Record, error) {
+	var last *Record
+	err := scan(path, func(rec Record, _ int) error {
+		last = &rec
+		return nil
+	})
+	return last, err
+}
+
+// scan calls fn for every record in the segment at path.
+func scan(path string, fn func(rec Record, line int) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		b, err := r.ReadBytes('\n')
+		if err == io.EOF && len(b) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF {
+			return fmt.Errorf("%s:%d: incomplete record", filepath.Base(path), line)
+		}
+		var rec Record
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rec); err != nil {
+			return fmt.Errorf("%s:%d: %w", filepath.Base(path), line, err)
+		}
+		if err := fn(rec, line); err != nil {
+			return err
+		}
+	}
+}
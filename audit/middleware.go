@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"encoding/hex"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/sha3"
+
+	"tutorial/requestid"
+)
+
+// ActorKey is the gin.Context key authentication middleware sets to the
+// authenticated principal. Unauthenticated requests are audited as
+// "anonymous".
+const ActorKey = "actor"
+
+// Middleware appends a record to l for every POST, PUT, PATCH and DELETE
+// request once it has been handled. The request body is hashed as the
+// handler reads it and whatever is left is hashed afterwards, so bodies are
+// never buffered in memory. Bodies are hashed up to maxBody bytes, or as far
+// as the handler read; the record is marked truncated if more was sent.
+func Middleware(l *Log, maxBody int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			c.Next()
+			return
+		}
+
+		body := &hashingReader{r: c.Request.Body, h: sha3.New256()}
+		c.Request.Body = body
+
+		c.Next()
+
+		// Whatever limit the handler put on the body, the rest is read here;
+		// cap it so a client cannot stream an endless body into the hash.
+		if left := maxBody - body.n; left > 0 {
+			io.Copy(io.Discard, io.LimitReader(body, left))
+		}
+		rec := Record{
+			Time:      time.Now().UTC(),
+			Actor:     c.GetString(ActorKey),
+			ClientIP:  c.ClientIP(),
+			Method:    c.Request.Method,
+			Route:     c.FullPath(),
+			Path:      c.Request.URL.Path,
+			Params:    params(c),
+			Status:    c.Writer.Status(),
+			RequestID: requestid.Get(c),
+			BodySHA3:  hex.EncodeToString(body.h.Sum(nil)),
+			Truncated: body.more(),
+		}
+		if rec.Actor == "" {
+			rec.Actor = "anonymous"
+		}
+		if _, err := l.Append(rec); err != nil {
+			slog.ErrorContext(c.Request.Context(), "audit append failed", "err", err, "request_id", rec.RequestID)
+		}
+	}
+}
+
+// params collects the route parameters and the first value of each query
+// parameter.
+func params(c *gin.Context) map[string]string {
+	if len(c.Params) == 0 && c.Request.URL.RawQuery == "" {
+		return nil
+	}
+	out := map[string]string{}
+	for k, v := range c.Request.URL.Query() {
+		out["query."+k] = v[0]
+	}
+	for _, p := range c.Params {
+		out[p.Key] = p.Value
+	}
+	return out
+}
+
+type hashingReader struct {
+	r   io.ReadCloser
+	h   hash.Hash
+	n   int64
+	eof bool
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	hr.n += int64(n)
+	if err != nil {
+		hr.eof = true
+	}
+	return n, err
+}
+
+// more reports whether the body goes on past what was hashed. It reads
+// ahead one byte without hashing it.
+func (hr *hashingReader) more() bool {
+	if hr.eof {
+		return false
+	}
+	var b [1]byte
+	n, _ := io.ReadFull(hr.r, b[:])
+	return n > 0
+}
+
+func (hr *hashingReader) Close() error { return hr.r.Close() }
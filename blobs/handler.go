@@ -0,0 +1,199 @@
+package blobs
+
+import (
+	"errors"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+	"tutorial/routes"
+)
+
+// Handler serves the files API.
+type Handler struct {
+	store     *Store
+	maxUpload int64
+}
+
+// NewHandler limits upload requests to maxUpload bytes in total.
+func NewHandler(store *Store, maxUpload int64) *Handler {
+	return &Handler{store: store, maxUpload: maxUpload}
+}
+
+type idURI struct {
+	ID string `uri:"id" binding:"required,hexadecimal,len=16"`
+}
+
+// Register mounts the files API on r, typically /api/files.
+func (h *Handler) Register(r routes.Router) {
+	meta := func(description string) routes.Meta {
+		return routes.Meta{Description: description, Auth: "none", Owner: "platform"}
+	}
+	r.POST("", meta("Uploads one or more files in the multipart field file."), h.upload)
+	r.GET("", meta("Lists uploaded files, oldest first."), h.list)
+	r.GET("/:id", meta("Returns a file's metadata."), h.get)
+	r.GET("/:id/content", meta("Downloads a file; supports Range and ETag, ?inline to display images, PDFs and plain text."), h.content)
+	r.Handle(http.MethodHead, "/:id/content", meta("Headers of a download."), h.content)
+	r.DELETE("/:id", meta("Deletes a file; its content goes once no other file shares it."), h.delete)
+}
+
+func (h *Handler) upload(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxUpload)
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.Error(uploadError(err))
+		return
+	}
+	headers := form.File["file"]
+	if len(headers) == 0 {
+		e := problem.New(http.StatusUnprocessableEntity, "validation_failed", "The request has invalid fields.")
+		e.Fields = []problem.FieldError{{Field: "file", Message: "is required"}}
+		c.Error(e)
+		return
+	}
+
+	added := make([]File, 0, len(headers))
+	for _, fh := range headers {
+		f, err := h.add(fh)
+		if err != nil {
+			// All or nothing: drop what this request already stored.
+			for _, f := range added {
+				h.store.Delete(f.ID)
+			}
+			c.Error(uploadError(err))
+			return
+		}
+		added = append(added, f)
+	}
+	if len(added) == 1 {
+		c.Header("Location", c.FullPath()+"/"+added[0].ID)
+	}
+	c.JSON(http.StatusCreated, added)
+}
+
+func (h *Handler) add(fh *multipart.FileHeader) (File, error) {
+	src, err := fh.Open()
+	if err != nil {
+		return File{}, err
+	}
+	defer src.Close()
+	return h.store.Add(filepath.Base(fh.Filename), src)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	files, err := h.store.List()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, files)
+}
+
+func (h *Handler) get(c *gin.Context) {
+	f, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, f)
+}
+
+// content leaves Range, If-None-Match and If-Range to http.ServeFile, which
+// honours the ETag and Content-Type set here.
+func (h *Handler) content(c *gin.Context) {
+	f, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+	c.Header("ETag", `"`+f.Hash+`"`)
+	c.Header("Content-Type", f.ContentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	// A file ID always refers to the same content.
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	if _, inline := c.GetQuery("inline"); inline && inlineable(f.ContentType) {
+		c.Header("Content-Disposition", "inline")
+		c.File(h.store.Path(f))
+		return
+	}
+	// Should a browser render an attachment anyway, it gets no script and no
+	// access to this origin.
+	c.Header("Content-Security-Policy", "sandbox")
+	c.FileAttachment(h.store.Path(f), f.Name)
+}
+
+// inlineable reports whether content of type ctype is safe to display on
+// this origin. SVG, HTML and the like can run script, so they are always
+// downloaded.
+func inlineable(ctype string) bool {
+	base, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+	switch base {
+	case "image/png", "image/jpeg", "image/gif", "image/webp", "image/avif", "image/bmp",
+		"application/pdf", "text/plain":
+		return true
+	}
+	return false
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	f, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+	if err := h.store.Delete(f.ID); err != nil {
+		c.Error(storeError(err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) lookup(c *gin.Context) (File, bool) {
+	var uri idURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(storeError(ErrNotFound))
+		return File{}, false
+	}
+	f, err := h.store.Get(uri.ID)
+	if err != nil {
+		c.Error(storeError(err))
+		return File{}, false
+	}
+	return f, true
+}
+
+func uploadError(err error) error {
+	var tooLarge *http.MaxBytesError
+	var typ *TypeError
+	switch {
+	case errors.As(err, &tooLarge):
+		return problem.New(http.StatusRequestEntityTooLarge, "upload_too_large", "Uploads are limited to "+byteSize(tooLarge.Limit)+".")
+	case errors.As(err, &typ):
+		return problem.New(http.StatusUnsupportedMediaType, "type_not_allowed", "Files of type "+typ.Type+" are not accepted.")
+	case errors.Is(err, http.ErrNotMultipart), errors.Is(err, http.ErrMissingBoundary), errors.Is(err, multipart.ErrMessageTooLarge):
+		return problem.BadRequest("malformed_request", "The request must be multipart/form-data.")
+	}
+	return err
+}
+
+func storeError(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return problem.NotFound("file_not_found", "There is no such file.")
+	}
+	return err
+}
+
+func byteSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return strconv.FormatInt(n>>20, 10) + " MiB"
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return strconv.FormatInt(n>>10, 10) + " KiB"
+	}
+	return strconv.FormatInt(n, 10) + " bytes"
+}
@@ -0,0 +1,56 @@
+package blobs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/routes"
+	"tutorial/storage"
+)
+
+func TestContentInline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s, err := Open(t.TempDir(), storage.NewMemory(), []string{"image/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	png, err := s.Add("logo.png", strings.NewReader("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg, err := s.Add("logo.svg", strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	NewHandler(s, 1<<20).Register(routes.NewCatalog().Wrap(router.Group("/files")))
+
+	tests := []struct {
+		file        File
+		query       string
+		disposition string
+		sandboxed   bool
+	}{
+		{png, "?inline", "inline", false},
+		{png, "", `attachment; filename="logo.png"`, true},
+		{svg, "?inline", `attachment; filename="logo.svg"`, true},
+		{svg, "", `attachment; filename="logo.svg"`, true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/"+tt.file.ID+"/content"+tt.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s%s: status %d", tt.file.Name, tt.query, w.Code)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != tt.disposition {
+			t.Errorf("%s%s: Content-Disposition %q, want %q", tt.file.Name, tt.query, got, tt.disposition)
+		}
+		if got := w.Header().Get("Content-Security-Policy") == "sandbox"; got != tt.sandboxed {
+			t.Errorf("%s%s: sandboxed = %v, want %v", tt.file.Name, tt.query, got, tt.sandboxed)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Package blobs stores uploaded files by content: each distinct content is
+// kept once, under its SHA3-256 hash, and shared by every upload of it.
+package blobs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"golang.org/x/crypto/sha3"
+
+	"tutorial/storage"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// TypeError is returned for content whose sniffed type is not allowed.
+type TypeError struct {
+	Type string
+}
+
+func (e *TypeError) Error() string { return "content type " + e.Type + " is not allowed" }
+
+// File is one upload. Several files may share a blob.
+type File struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Hash        string    `json:"sha3_256"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	Uploaded    time.Time `json:"uploaded"`
+}
+
+// blob is the stored content and the number of files referring to it.
+type blob struct {
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	Refs        int    `json:"refs"`
+}
+
+const (
+	filePrefix = "files/"
+	blobPrefix = "blobs/"
+
+	// sniffLen is how much of the content mimetype looks at.
+	sniffLen = 3072
+)
+
+// Store keeps blob contents in dir and their metadata in a storage.KV.
+type Store struct {
+	dir     string
+	kv      storage.KV
+	allowed []string
+
+	mu     sync.Mutex // guards reference counts and ID allocation
+	lastID int64
+}
+
+// Open uses dir for blob contents. allowed lists the content types that may
+// be stored, such as "image/png" or "image/*"; empty allows everything.
+func Open(dir string, kv storage.KV, allowed []string) (*Store, error) {
+	tmp := filepath.Join(dir, "tmp")
+	// Leftovers of uploads interrupted by a crash.
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, kv: kv, allowed: allowed}
+	if err := s.sweep(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// sweep removes contents without metadata: those of uploads that crashed
+// after the rename, and everything when the metadata lives in memory.
+func (s *Store) sweep() error {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, d := range dirs {
+		if !d.IsDir() || len(d.Name()) != 2 {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.dir, d.Name()))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if _, err := s.kv.Get(blobPrefix + e.Name()); !errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err := os.Remove(s.path(e.Name())); err != nil {
+				return err
+			}
+			removed++
+		}
+	}
+	if removed > 0 {
+		slog.Info("blobs: removed unreferenced contents", "dir", s.dir, "count", removed)
+	}
+	return nil
+}
+
+// Add stores the content read from r as a file called name. The content
+// type is sniffed from the content; the client's claim is ignored.
+func (s *Store) Add(name string, r io.Reader) (File, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return File{}, err
+	}
+	head = head[:n]
+	ctype := mimetype.Detect(head).String()
+	if !s.allows(ctype) {
+		return File{}, &TypeError{Type: ctype}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, "tmp"), "upload-*")
+	if err != nil {
+		return File{}, err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+
+	h := sha3.New256()
+	size, err := io.Copy(io.MultiWriter(tmp, h), io.MultiReader(bytes.NewReader(head), r))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return File{}, err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b blob
+	err = s.get(blobPrefix+hash, &b)
+	created := errors.Is(err, ErrNotFound)
+	switch {
+	case created:
+		b = blob{Size: size, ContentType: ctype}
+	case err != nil:
+		return File{}, err
+	}
+	b.Refs++
+
+	f := File{
+		ID:          s.nextID(),
+		Name:        name,
+		Hash:        hash,
+		Size:        size,
+		ContentType: b.ContentType,
+		Uploaded:    time.Now().UTC(),
+	}
+	blobOp, err := putOp(blobPrefix+hash, b)
+	if err != nil {
+		return File{}, err
+	}
+	fileOp, err := putOp(filePrefix+f.ID, f)
+	if err != nil {
+		return File{}, err
+	}
+
+	if created {
+		if err := os.MkdirAll(filepath.Dir(s.path(hash)), 0o755); err != nil {
+			return File{}, err
+		}
+		if err := os.Rename(tmp.Name(), s.path(hash)); err != nil {
+			return File{}, err
+		}
+	}
+	// The count and the file are written together, so neither is ever
+	// stored without the other.
+	if err := s.kv.Apply(blobOp, fileOp); err != nil {
+		if created {
+			os.Remove(s.path(hash))
+		}
+		return File{}, err
+	}
+	return f, nil
+}
+
+func (s *Store) Get(id string) (File, error) {
+	var f File
+	err := s.get(filePrefix+id, &f)
+	return f, err
+}
+
+// List returns all files, oldest first.
+func (s *Store) List() ([]File, error) {
+	out := []File{}
+	var err error
+	scanErr := s.kv.Scan(filePrefix, func(_ string, v []byte) bool {
+		var f File
+		if err = json.Unmarshal(v, &f); err != nil {
+			return false
+		}
+		out = append(out, f)
+		return true
+	})
+	return out, errors.Join(scanErr, err)
+}
+
+// Delete removes a file, and its blob once no other file refers to it.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var f File
+	if err := s.get(filePrefix+id, &f); err != nil {
+		return err
+	}
+	var b blob
+	if err := s.get(blobPrefix+f.Hash, &b); err != nil {
+		return fmt.Errorf("blob of file %s: %w", id, err)
+	}
+	ops := []storage.Op{{Key: filePrefix + id, Delete: true}}
+	if b.Refs--; b.Refs > 0 {
+		op, err := putOp(blobPrefix+f.Hash, b)
+		if err != nil {
+			return err
+		}
+		return s.kv.Apply(append(ops, op)...)
+	}
+	// The content goes only once nothing refers to it any more; if removing
+	// it fails, Open sweeps it up.
+	if err := s.kv.Apply(append(ops, storage.Op{Key: blobPrefix + f.Hash, Delete: true})...); err != nil {
+		return err
+	}
+	return os.Remove(s.path(f.Hash))
+}
+
+// Path returns where the content of f is stored.
+func (s *Store) Path(f File) string {
+	return s.path(f.Hash)
+}
+
+// path fans blobs out over directories named after the first two hex digits
+// of their hash.
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+func (s *Store) allows(ctype string) bool {
+	if len(s.allowed) == 0 {
+		return true
+	}
+	base, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+	for _, a := range s.allowed {
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok {
+			if strings.HasPrefix(base, prefix+"/") {
+				return true
+			}
+		} else if base == a {
+			return true
+		}
+	}
+	return false
+}
+
+// nextID returns IDs that sort in upload order.
+func (s *Store) nextID() string {
+	id := time.Now().UnixNano()
+	if id <= s.lastID {
+		id = s.lastID + 1
+	}
+	s.lastID = id
+	return fmt.Sprintf("%016x", id)
+}
+
+func (s *Store) get(key string, v any) error {
+	b, err := s.kv.Get(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// putOp encodes v as the value to store under key.
+func putOp(key string, v any) (storage.Op, error) {
+	b, err := json.Marshal(v)
+	return storage.Op{Key: key, Value: b}, err
+}
@@ -0,0 +1,173 @@
+package blobs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tutorial/storage"
+)
+
+func TestDedupAndRefcount(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, storage.NewMemory(), []string{"text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := s.Add("a.txt", strings.NewReader("same content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.Add("b.txt", strings.NewReader("same content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID == b.ID || a.Hash != b.Hash {
+		t.Fatalf("a = %+v, b = %+v; want distinct files sharing a hash", a, b)
+	}
+	if a.ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("content type = %q", a.ContentType)
+	}
+
+	if err := s.Delete(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.Path(b)); err != nil {
+		t.Fatalf("content removed while still referenced: %v", err)
+	}
+	if err := s.Delete(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.Path(b)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("content kept after last reference: %v", err)
+	}
+	if err := s.Delete(b.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second delete: %v, want ErrNotFound", err)
+	}
+}
+
+// flakyKV fails batches while failing is set, as a full disk would.
+type flakyKV struct {
+	storage.KV
+	failing bool
+}
+
+func (kv *flakyKV) Apply(ops ...storage.Op) error {
+	if kv.failing {
+		return errors.New("disk full")
+	}
+	return kv.KV.Apply(ops...)
+}
+
+func TestFailedWritesChangeNothing(t *testing.T) {
+	kv := &flakyKV{KV: storage.NewMemory()}
+	s, err := Open(t.TempDir(), kv, []string{"text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := s.Add("a.txt", strings.NewReader("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kv.failing = true
+	if _, err := s.Add("new.txt", strings.NewReader("other content")); err == nil {
+		t.Fatal("Add succeeded on a failing store")
+	}
+	if _, err := s.Add("b.txt", strings.NewReader("content")); err == nil {
+		t.Fatal("Add succeeded on a failing store")
+	}
+	if err := s.Delete(a.ID); err == nil {
+		t.Fatal("Delete succeeded on a failing store")
+	}
+	if files, _ := s.List(); len(files) != 1 {
+		t.Errorf("%d files after failed writes, want 1", len(files))
+	}
+	var b blob
+	if err := s.get(blobPrefix+a.Hash, &b); err != nil || b.Refs != 1 {
+		t.Errorf("blob = %+v, %v; want one reference", b, err)
+	}
+	if _, err := os.Stat(s.Path(a)); err != nil {
+		t.Errorf("content removed by a failed delete: %v", err)
+	}
+	if n := storedBlobs(t, s); n != 1 {
+		t.Errorf("%d contents on disk, want 1", n)
+	}
+
+	kv.failing = false
+	if err := s.Delete(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := storedBlobs(t, s); n != 0 {
+		t.Errorf("%d contents left after the last delete", n)
+	}
+}
+
+// storedBlobs counts the content files under s.
+func storedBlobs(t *testing.T, s *Store) int {
+	t.Helper()
+	n := 0
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range entries {
+		if !d.IsDir() || d.Name() == "tmp" {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(s.dir, d.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += len(files)
+	}
+	return n
+}
+
+func TestAllowedTypes(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	tests := []struct {
+		allowed []string
+		content string
+		ok      bool
+	}{
+		{nil, "\x00\x01\x02", true},
+		{[]string{"image/*"}, png, true},
+		{[]string{"image/png"}, png, true},
+		{[]string{"image/jpeg"}, png, false},
+		{[]string{"image/*"}, "just text", false},
+		{[]string{"text/plain"}, "just text", true},
+	}
+	for _, tt := range tests {
+		s, err := Open(t.TempDir(), storage.NewMemory(), tt.allowed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.Add("upload", strings.NewReader(tt.content))
+		var typ *TypeError
+		if tt.ok && err != nil || !tt.ok && !errors.As(err, &typ) {
+			t.Errorf("allowed %v, content %q: err = %v", tt.allowed, tt.content, err)
+		}
+	}
+}
+
+func TestOpenSweepsUnreferencedContent(t *testing.T) {
+	dir := t.TempDir()
+	kv := storage.NewMemory()
+	s, _ := Open(dir, kv, nil)
+	kept, _ := s.Add("kept", strings.NewReader("kept"))
+	lost, _ := s.Add("lost", strings.NewReader("lost"))
+	kv.Delete(blobPrefix + lost.Hash)
+
+	if _, err := Open(dir, kv, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.Path(kept)); err != nil {
+		t.Errorf("referenced content removed: %v", err)
+	}
+	if _, err := os.Stat(s.Path(lost)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unreferenced content kept: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"tutorial/config"
+	"tutorial/cron"
+	"tutorial/flags"
+)
+
+// Settings whose rules belong to other packages are checked by those
+// packages, so config imports none of them.
+func init() {
+	config.AddCheck(checkSchedules)
+	config.AddCheck(checkFlags)
+}
+
+func checkSchedules(c *config.Config, errs *config.ValidationError) {
+	loc, err := time.LoadLocation(c.Cron.TimeZone)
+	if err != nil {
+		return // reported by Validate
+	}
+	for _, sched := range []struct{ name, expr string }{
+		{"cron.purge_links", c.Cron.PurgeLinks},
+		{"cron.compact_storage", c.Cron.CompactStorage},
+		{"cron.rotate_audit", c.Cron.RotateAudit},
+	} {
+		if sched.expr == "" {
+			continue
+		}
+		if _, err := cron.Parse(sched.expr, loc); err != nil {
+			errs.Add(sched.name, "%v", err)
+		}
+	}
+}
+
+func checkFlags(c *config.Config, errs *config.ValidationError) {
+	_, err := flags.Decode(c.Flags.Flag)
+	if err == nil {
+		return
+	}
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var fe *flags.FieldError
+		if errors.As(err, &fe) {
+			errs.Add("flags."+fe.Field, "%s", fe.Message)
+		}
+	}
+}
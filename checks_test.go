@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tutorial/config"
+)
+
+func TestConfigChecks(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "flags.toml")
+	os.WriteFile(file, []byte(`
+[[flags.flag]]
+  key = 'beta'
+[[flags.flag]]
+  key = 'beta'
+[[flags.flag]]
+  key = 'gamma'
+  rollout = [{variant = 'on', percent = 50}]
+`), 0o600)
+	_, err := config.Load("test", []string{"-config=" + file, "-cron.purge_links=every day"})
+	if err == nil {
+		t.Fatal("invalid schedule and flags accepted")
+	}
+	for _, key := range []string{"cron.purge_links", "flags.flag[1].key", "flags.flag[2].rollout"} {
+		if !strings.Contains(err.Error(), key+":") {
+			t.Errorf("no problem reported for %s:\n%v", key, err)
+		}
+	}
+}
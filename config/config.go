@@ -0,0 +1,580 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config is the complete runtime configuration of the service.
+type Config struct {
+	Server      ServerConfig      `toml:"server" yaml:"server"`
+	TLS         TLSConfig         `toml:"tls" yaml:"tls"`
+	Metrics     MetricsConfig     `toml:"metrics" yaml:"metrics"`
+	Tracing     TracingConfig     `toml:"tracing" yaml:"tracing"`
+	Health      HealthConfig      `toml:"health" yaml:"health"`
+	Audit       AuditConfig       `toml:"audit" yaml:"audit"`
+	Storage     StorageConfig     `toml:"storage" yaml:"storage"`
+	Blobs       BlobsConfig       `toml:"blobs" yaml:"blobs"`
+	Events      EventsConfig      `toml:"events" yaml:"events"`
+	WebSocket   WebSocketConfig   `toml:"websocket" yaml:"websocket"`
+	Jobs        JobsConfig        `toml:"jobs" yaml:"jobs"`
+	Webhooks    WebhooksConfig    `toml:"webhooks" yaml:"webhooks"`
+	Cron        CronConfig        `toml:"cron" yaml:"cron"`
+	Log         LogConfig         `toml:"log" yaml:"log"`
+	RateLimit   RateLimitConfig   `toml:"rate_limit" yaml:"rate_limit"`
+	CORS        CORSConfig        `toml:"cors" yaml:"cors"`
+	Maintenance MaintenanceConfig `toml:"maintenance" yaml:"maintenance"`
+	Flags       FlagsConfig       `toml:"flags" yaml:"flags"`
+	Admin       AdminConfig       `toml:"admin" yaml:"admin"`
+	Debug       DebugConfig       `toml:"debug" yaml:"debug"`
+}
+
+type ServerConfig struct {
+	Addr            string   `toml:"addr" yaml:"addr" help:"public listen address"`
+	Mode            string   `toml:"mode" yaml:"mode" help:"gin mode: debug, release or test"`
+	ShutdownTimeout Duration `toml:"shutdown_timeout" yaml:"shutdown_timeout" help:"how long to wait for in-flight requests on shutdown"`
+	TrustedProxies  []string `toml:"trusted_proxies" yaml:"trusted_proxies" help:"comma-separated proxy IPs or CIDRs whose X-Forwarded-For is believed; none by default"`
+}
+
+type TLSConfig struct {
+	Enabled      bool     `toml:"enabled" yaml:"enabled" help:"serve HTTPS on server.addr"`
+	CertFile     string   `toml:"cert_file" yaml:"cert_file" help:"PEM certificate chain, reloaded when it changes on disk"`
+	KeyFile      string   `toml:"key_file" yaml:"key_file" help:"PEM private key, reloaded when it changes on disk"`
+	MinVersion   string   `toml:"min_version" yaml:"min_version" help:"minimum TLS version: 1.2 or 1.3"`
+	CipherSuites []string `toml:"cipher_suites" yaml:"cipher_suites" help:"comma-separated TLS 1.2 cipher suite names; empty uses Go's defaults"`
+	RedirectAddr string   `toml:"redirect_addr" yaml:"redirect_addr" help:"if set, plain HTTP address that redirects to HTTPS"`
+	Dev          bool     `toml:"dev" yaml:"dev" flag:"dev-tls" help:"serve HTTPS with an in-memory self-signed certificate for localhost"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Version returns the parsed min_version.
+func (t TLSConfig) Version() uint16 {
+	return tlsVersions[t.MinVersion]
+}
+
+// CipherSuiteIDs returns the IDs of the configured cipher suites, or nil to
+// use the defaults.
+func (t TLSConfig) CipherSuiteIDs() []uint16 {
+	var ids []uint16
+	for _, name := range t.CipherSuites {
+		for _, cs := range tls.CipherSuites() {
+			if cs.Name == name {
+				ids = append(ids, cs.ID)
+			}
+		}
+	}
+	return ids
+}
+
+type MetricsConfig struct {
+	Buckets []float64 `toml:"buckets" yaml:"buckets" help:"comma-separated request latency histogram buckets in seconds"`
+}
+
+type TracingConfig struct {
+	File     string `toml:"file" yaml:"file" help:"append finished spans to this file as JSON lines"`
+	RingSize int    `toml:"ring_size" yaml:"ring_size" help:"recent spans kept in memory for the admin /traces endpoint"`
+}
+
+type HealthConfig struct {
+	CacheTTL Duration `toml:"cache_ttl" yaml:"cache_ttl" help:"how long dependency check results are reused"`
+}
+
+type AuditConfig struct {
+	Enabled         bool   `toml:"enabled" yaml:"enabled" help:"record every POST, PUT, PATCH and DELETE in a hash-chained audit log"`
+	Dir             string `toml:"dir" yaml:"dir" help:"directory holding the audit log segments"`
+	MaxSegmentBytes int64  `toml:"max_segment_bytes" yaml:"max_segment_bytes" help:"size at which the audit log rotates to a new segment"`
+}
+
+type StorageConfig struct {
+	Engine           string   `toml:"engine" yaml:"engine" help:"where data is kept: memory (lost on restart) or disk"`
+	Dir              string   `toml:"dir" yaml:"dir" help:"directory of the disk engine's write-ahead log and snapshot"`
+	Sync             string   `toml:"sync" yaml:"sync" help:"when the write-ahead log is fsynced: always, interval or never"`
+	SyncInterval     Duration `toml:"sync_interval" yaml:"sync_interval" help:"fsync period with sync = interval"`
+	SnapshotInterval Duration `toml:"snapshot_interval" yaml:"snapshot_interval" help:"how often the log is compacted into a snapshot; 0 disables"`
+	MaxWALBytes      int64    `toml:"max_wal_bytes" yaml:"max_wal_bytes" help:"log size that triggers compaction; 0 disables"`
+}
+
+type BlobsConfig struct {
+	Dir            string   `toml:"dir" yaml:"dir" help:"directory holding uploaded file contents"`
+	MaxUploadBytes int64    `toml:"max_upload_bytes" yaml:"max_upload_bytes" help:"largest upload request accepted"`
+	AllowedTypes   []string `toml:"allowed_types" yaml:"allowed_types" help:"comma-separated content types accepted for upload, such as image/*; empty allows all"`
+}
+
+type EventsConfig struct {
+	History   int      `toml:"history" yaml:"history" help:"recent events kept per topic for Last-Event-ID replay"`
+	Buffer    int      `toml:"buffer" yaml:"buffer" help:"events a subscriber may fall behind before it is disconnected"`
+	MaxTopics int      `toml:"max_topics" yaml:"max_topics" help:"most topics that may exist"`
+	Retention Duration `toml:"retention" yaml:"retention" help:"how long a topic without subscribers keeps its history before it may be removed"`
+	Heartbeat Duration `toml:"heartbeat" yaml:"heartbeat" help:"interval of keep-alive comments on idle event streams"`
+}
+
+type WebSocketConfig struct {
+	MaxMessageBytes int64    `toml:"max_message_bytes" yaml:"max_message_bytes" help:"largest WebSocket message accepted from a client"`
+	Queue           int      `toml:"queue" yaml:"queue" help:"messages queued for a WebSocket client before it is disconnected as too slow"`
+	PingInterval    Duration `toml:"ping_interval" yaml:"ping_interval" help:"how often idle WebSocket connections are pinged"`
+}
+
+type JobsConfig struct {
+	Workers     int      `toml:"workers" yaml:"workers" help:"background jobs run at the same time"`
+	Queue       int      `toml:"queue" yaml:"queue" help:"jobs that may wait to run before new ones are refused"`
+	MaxAttempts int      `toml:"max_attempts" yaml:"max_attempts" help:"runs of a failing job before it is dead-lettered"`
+	Backoff     Duration `toml:"backoff" yaml:"backoff" help:"wait before the first retry; doubled after every further failure"`
+	MaxBackoff  Duration `toml:"max_backoff" yaml:"max_backoff" help:"longest wait between retries"`
+	Timeout     Duration `toml:"timeout" yaml:"timeout" help:"how long one run of a job may take"`
+	Retention   Duration `toml:"retention" yaml:"retention" help:"how long finished jobs are kept"`
+}
+
+type WebhooksConfig struct {
+	Concurrency  int      `toml:"concurrency" yaml:"concurrency" help:"deliveries in flight to one webhook endpoint at a time"`
+	Timeout      Duration `toml:"timeout" yaml:"timeout" help:"how long a webhook endpoint may take to answer"`
+	Backoff      Duration `toml:"backoff" yaml:"backoff" help:"wait before the first redelivery; doubled after every further failure"`
+	MaxBackoff   Duration `toml:"max_backoff" yaml:"max_backoff" help:"longest wait between delivery attempts"`
+	MaxAttempts  int      `toml:"max_attempts" yaml:"max_attempts" help:"attempts before a delivery is given up"`
+	DisableAfter int      `toml:"disable_after" yaml:"disable_after" help:"failed attempts in a row before a subscription is disabled"`
+	Retention    Duration `toml:"retention" yaml:"retention" help:"how long finished deliveries stay in the delivery log"`
+	AllowPrivate bool     `toml:"allow_private" yaml:"allow_private" help:"deliver to loopback and private addresses too; for development only"`
+}
+
+type CronConfig struct {
+	TimeZone       string   `toml:"time_zone" yaml:"time_zone" help:"time zone of the maintenance schedules, such as UTC or Europe/Berlin"`
+	Jitter         Duration `toml:"jitter" yaml:"jitter" help:"most random delay added to every scheduled run"`
+	PurgeLinks     string   `toml:"purge_links" yaml:"purge_links" help:"cron schedule for deleting expired short links; empty disables"`
+	CompactStorage string   `toml:"compact_storage" yaml:"compact_storage" help:"cron schedule for compacting the disk engine's log; empty disables"`
+	RotateAudit    string   `toml:"rotate_audit" yaml:"rotate_audit" help:"cron schedule for starting a new audit log segment; empty disables"`
+}
+
+// The sections below can be changed at runtime with a reload; Server, TLS,
+// Metrics, Tracing, Health, Audit, Storage, Blobs, Events, WebSocket, Jobs,
+// Webhooks and Cron need a restart.
+
+type LogConfig struct {
+	Level     string   `toml:"level" yaml:"level" help:"log level: debug, info, warn or error"`
+	Format    string   `toml:"format" yaml:"format" help:"log format: json or text; needs a restart"`
+	SkipPaths []string `toml:"skip_paths" yaml:"skip_paths" help:"comma-separated request paths left out of the access log"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool    `toml:"enabled" yaml:"enabled" help:"enable per-client rate limiting"`
+	RPS     float64 `toml:"rps" yaml:"rps" help:"sustained requests per second per client"`
+	Burst   int     `toml:"burst" yaml:"burst" help:"requests a client may make in a burst"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `toml:"allowed_origins" yaml:"allowed_origins" help:"comma-separated origins allowed to make cross-origin requests, or *"`
+}
+
+type MaintenanceConfig struct {
+	Enabled bool   `toml:"enabled" yaml:"enabled" help:"answer public requests with 503"`
+	Message string `toml:"message" yaml:"message" help:"message returned while in maintenance"`
+}
+
+type FlagsConfig struct {
+	UserHeader   string `toml:"user_header" yaml:"user_header" help:"request header naming the user feature flags are evaluated for"`
+	TenantHeader string `toml:"tenant_header" yaml:"tenant_header" help:"request header naming the tenant feature flags are evaluated for"`
+	// Flag can only be set in the config file. The definitions are decoded
+	// and checked by package flags, so they are kept as read here.
+	Flag []map[string]any `toml:"flag" yaml:"flag"`
+}
+
+type AdminConfig struct {
+	Addr  string `toml:"addr" yaml:"addr" help:"internal admin listen address, or unix:/path/to.sock; needs a restart"`
+	Token string `toml:"token" yaml:"token" secret:"true" help:"bearer token required by admin endpoints"`
+}
+
+type DebugConfig struct {
+	Endpoints string `toml:"endpoints" yaml:"endpoints" help:"profiling endpoints on the admin listener: auto (off in release mode), on or off"`
+}
+
+// DebugEnabled reports whether the profiling endpoints are served.
+func (c *Config) DebugEnabled() bool {
+	switch c.Debug.Endpoints {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+	return c.Server.Mode != "release"
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":5000",
+			Mode:            "debug",
+			ShutdownTimeout: Duration(10 * time.Second),
+		},
+		TLS: TLSConfig{
+			MinVersion: "1.2",
+		},
+		Metrics: MetricsConfig{
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		},
+		Tracing: TracingConfig{
+			RingSize: 1000,
+		},
+		Health: HealthConfig{
+			CacheTTL: Duration(time.Second),
+		},
+		Audit: AuditConfig{
+			Dir:             "data/audit",
+			MaxSegmentBytes: 64 << 20,
+		},
+		Storage: StorageConfig{
+			Engine:           "memory",
+			Dir:              "data/store",
+			Sync:             "always",
+			SyncInterval:     Duration(time.Second),
+			SnapshotInterval: Duration(10 * time.Minute),
+			MaxWALBytes:      64 << 20,
+		},
+		Blobs: BlobsConfig{
+			Dir:            "data/blobs",
+			MaxUploadBytes: 32 << 20,
+			AllowedTypes:   []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf", "text/plain"},
+		},
+		Events: EventsConfig{
+			History:   256,
+			Buffer:    64,
+			MaxTopics: 1000,
+			Retention: Duration(time.Hour),
+			Heartbeat: Duration(15 * time.Second),
+		},
+		WebSocket: WebSocketConfig{
+			MaxMessageBytes: 64 << 10,
+			Queue:           32,
+			PingInterval:    Duration(30 * time.Second),
+		},
+		Jobs: JobsConfig{
+			Workers:     4,
+			Queue:       1000,
+			MaxAttempts: 5,
+			Backoff:     Duration(time.Second),
+			MaxBackoff:  Duration(5 * time.Minute),
+			Timeout:     Duration(10 * time.Minute),
+			Retention:   Duration(24 * time.Hour),
+		},
+		Webhooks: WebhooksConfig{
+			Concurrency:  2,
+			Timeout:      Duration(10 * time.Second),
+			Backoff:      Duration(30 * time.Second),
+			MaxBackoff:   Duration(time.Hour),
+			MaxAttempts:  8,
+			DisableAfter: 20,
+			Retention:    Duration(7 * 24 * time.Hour),
+		},
+		Cron: CronConfig{
+			TimeZone:       "UTC",
+			Jitter:         Duration(30 * time.Second),
+			PurgeLinks:     "0 3 * * *",
+			CompactStorage: "30 3 * * *",
+			RotateAudit:    "@daily",
+		},
+		Log: LogConfig{
+			Level:     "info",
+			Format:    "json",
+			SkipPaths: []string{"/livez", "/readyz", "/healthz"},
+		},
+		RateLimit: RateLimitConfig{
+			RPS:   10,
+			Burst: 20,
+		},
+		Maintenance: MaintenanceConfig{
+			Message: "The service is down for maintenance.",
+		},
+		Flags: FlagsConfig{
+			UserHeader:   "X-User-ID",
+			TenantHeader: "X-Tenant-ID",
+		},
+		Admin: AdminConfig{
+			Addr: "127.0.0.1:5001",
+		},
+		Debug: DebugConfig{
+			Endpoints: "auto",
+		},
+	}
+}
+
+// A Check validates settings whose rules belong to another package, such as
+// cron schedules, so that config need not import it. It reports problems
+// with errs.Add.
+type Check func(c *Config, errs *ValidationError)
+
+var checks []Check
+
+// AddCheck makes Validate run check after its own. It is meant to be called
+// from init functions.
+func AddCheck(check Check) {
+	checks = append(checks, check)
+}
+
+// Validate reports every invalid setting at once, including those found by
+// the checks added with AddCheck.
+func (c *Config) Validate() error {
+	var errs ValidationError
+
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		errs.Add("server.addr", "%v", err)
+	}
+	switch c.Server.Mode {
+	case "debug", "release", "test":
+	default:
+		errs.Add("server.mode", "must be one of debug, release, test; got %q", c.Server.Mode)
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs.Add("server.shutdown_timeout", "must be positive")
+	}
+	for _, p := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			errs.Add("server.trusted_proxies", "%q is not an IP address or CIDR", p)
+		}
+	}
+
+	if _, ok := tlsVersions[c.TLS.MinVersion]; !ok {
+		errs.Add("tls.min_version", "must be 1.2 or 1.3; got %q", c.TLS.MinVersion)
+	}
+	if c.TLS.Enabled && !c.TLS.Dev {
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			errs.Add("tls", "cert_file and key_file are required unless dev is set")
+		}
+	}
+	if len(c.TLS.CipherSuiteIDs()) != len(c.TLS.CipherSuites) {
+		errs.Add("tls.cipher_suites", "unknown or insecure suite in %v", c.TLS.CipherSuites)
+	}
+	if c.TLS.RedirectAddr != "" {
+		if _, _, err := net.SplitHostPort(c.TLS.RedirectAddr); err != nil {
+			errs.Add("tls.redirect_addr", "%v", err)
+		}
+	}
+
+	if len(c.Metrics.Buckets) == 0 || !slices.IsSorted(c.Metrics.Buckets) {
+		errs.Add("metrics.buckets", "must be a non-empty ascending list")
+	}
+	if c.Tracing.RingSize < 1 {
+		errs.Add("tracing.ring_size", "must be at least 1")
+	}
+	if c.Health.CacheTTL < 0 {
+		errs.Add("health.cache_ttl", "must not be negative")
+	}
+	if c.Audit.Enabled && c.Audit.Dir == "" {
+		errs.Add("audit.dir", "is required when audit is enabled")
+	}
+	if c.Audit.MaxSegmentBytes < 1024 {
+		errs.Add("audit.max_segment_bytes", "must be at least 1024")
+	}
+
+	switch c.Storage.Engine {
+	case "memory":
+	case "disk":
+		if c.Storage.Dir == "" {
+			errs.Add("storage.dir", "is required with the disk engine")
+		}
+	default:
+		errs.Add("storage.engine", "must be memory or disk; got %q", c.Storage.Engine)
+	}
+	switch c.Storage.Sync {
+	case "always", "never":
+	case "interval":
+		if c.Storage.SyncInterval <= 0 {
+			errs.Add("storage.sync_interval", "must be positive with sync = interval")
+		}
+	default:
+		errs.Add("storage.sync", "must be always, interval or never; got %q", c.Storage.Sync)
+	}
+	if c.Storage.SnapshotInterval < 0 {
+		errs.Add("storage.snapshot_interval", "must not be negative")
+	}
+	if c.Storage.MaxWALBytes < 0 {
+		errs.Add("storage.max_wal_bytes", "must not be negative")
+	}
+
+	if c.Blobs.Dir == "" {
+		errs.Add("blobs.dir", "is required")
+	}
+	if c.Blobs.MaxUploadBytes < 1 {
+		errs.Add("blobs.max_upload_bytes", "must be positive")
+	}
+	for _, t := range c.Blobs.AllowedTypes {
+		if major, minor, ok := strings.Cut(t, "/"); !ok || major == "" || minor == "" || major == "*" {
+			errs.Add("blobs.allowed_types", "%q is not a type/subtype or type/*", t)
+		}
+	}
+
+	if c.Events.History < 0 {
+		errs.Add("events.history", "must not be negative")
+	}
+	if c.Events.Buffer < 1 {
+		errs.Add("events.buffer", "must be at least 1")
+	}
+	if c.Events.MaxTopics < 1 {
+		errs.Add("events.max_topics", "must be at least 1")
+	}
+	if c.Events.Retention <= 0 {
+		errs.Add("events.retention", "must be positive")
+	}
+	if c.Events.Heartbeat <= 0 {
+		errs.Add("events.heartbeat", "must be positive")
+	}
+
+	if c.WebSocket.MaxMessageBytes < 125 {
+		errs.Add("websocket.max_message_bytes", "must be at least 125")
+	}
+	if c.WebSocket.Queue < 1 {
+		errs.Add("websocket.queue", "must be at least 1")
+	}
+	if c.WebSocket.PingInterval <= 0 {
+		errs.Add("websocket.ping_interval", "must be positive")
+	}
+
+	if c.Jobs.Workers < 1 {
+		errs.Add("jobs.workers", "must be at least 1")
+	}
+	if c.Jobs.Queue < 1 {
+		errs.Add("jobs.queue", "must be at least 1")
+	}
+	if c.Jobs.MaxAttempts < 1 {
+		errs.Add("jobs.max_attempts", "must be at least 1")
+	}
+	if c.Jobs.Backoff <= 0 {
+		errs.Add("jobs.backoff", "must be positive")
+	}
+	if c.Jobs.MaxBackoff < c.Jobs.Backoff {
+		errs.Add("jobs.max_backoff", "must be at least jobs.backoff")
+	}
+	if c.Jobs.Timeout <= 0 {
+		errs.Add("jobs.timeout", "must be positive")
+	}
+	if c.Jobs.Retention <= 0 {
+		errs.Add("jobs.retention", "must be positive")
+	}
+
+	if c.Webhooks.Concurrency < 1 {
+		errs.Add("webhooks.concurrency", "must be at least 1")
+	}
+	if c.Webhooks.Timeout <= 0 {
+		errs.Add("webhooks.timeout", "must be positive")
+	}
+	if c.Webhooks.Backoff <= 0 {
+		errs.Add("webhooks.backoff", "must be positive")
+	}
+	if c.Webhooks.MaxBackoff < c.Webhooks.Backoff {
+		errs.Add("webhooks.max_backoff", "must be at least webhooks.backoff")
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		errs.Add("webhooks.max_attempts", "must be at least 1")
+	}
+	if c.Webhooks.DisableAfter < 1 {
+		errs.Add("webhooks.disable_after", "must be at least 1")
+	}
+	if c.Webhooks.Retention <= 0 {
+		errs.Add("webhooks.retention", "must be positive")
+	}
+
+	if _, err := time.LoadLocation(c.Cron.TimeZone); err != nil {
+		errs.Add("cron.time_zone", "%v", err)
+	}
+	if c.Cron.Jitter < 0 {
+		errs.Add("cron.jitter", "must not be negative")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs.Add("log.level", "must be one of debug, info, warn, error; got %q", c.Log.Level)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		errs.Add("log.format", "must be json or text; got %q", c.Log.Format)
+	}
+	if c.RateLimit.Enabled {
+		if c.RateLimit.RPS <= 0 {
+			errs.Add("rate_limit.rps", "must be positive")
+		}
+		if c.RateLimit.Burst < 1 {
+			errs.Add("rate_limit.burst", "must be at least 1")
+		}
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			errs.Add("cors.allowed_origins", "%q is not an http(s) origin", origin)
+		}
+	}
+
+	if path, ok := strings.CutPrefix(c.Admin.Addr, "unix:"); ok {
+		if path == "" {
+			errs.Add("admin.addr", "unix socket path is empty")
+		}
+	} else if _, _, err := net.SplitHostPort(c.Admin.Addr); err != nil {
+		errs.Add("admin.addr", "%v", err)
+	} else if c.Admin.Addr == c.Server.Addr {
+		errs.Add("admin.addr", "must differ from server.addr")
+	}
+	switch c.Debug.Endpoints {
+	case "auto", "on", "off":
+	default:
+		errs.Add("debug.endpoints", "must be auto, on or off; got %q", c.Debug.Endpoints)
+	}
+
+	for _, check := range checks {
+		check(c, &errs)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// LogLevel returns the parsed log.level; it is valid once Validate passed.
+func (c *Config) LogLevel() slog.Level {
+	var level slog.Level
+	level.UnmarshalText([]byte(c.Log.Level))
+	return level
+}
+
+// FieldError describes one invalid setting.
+type FieldError struct {
+	Key     string
+	Message string
+}
+
+// ValidationError collects the problems found by Validate.
+type ValidationError []FieldError
+
+// Add records a problem with the setting key.
+func (e *ValidationError) Add(key, format string, args ...any) {
+	*e = append(*e, FieldError{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, fe := range e {
+		fmt.Fprintf(&b, "\n  %s: %s", fe.Key, fe.Message)
+	}
+	return b.String()
+}
+
+// Duration is a time.Duration that reads and writes as a string such as "10s".
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration { return time.Duration(d) }
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
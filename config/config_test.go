@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLayering(t *testing.T) {
+	for name, data := range map[string]string{
+		"config.toml": "[server]\n  addr = ':1'\n  mode = 'release'\n[log]\n  level = 'warn'\n",
+		"config.yaml": "server:\n  addr: ':1'\n  mode: release\nlog:\n  level: warn\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(EnvPrefix+"_SERVER_ADDR", ":2")
+			t.Setenv(EnvPrefix+"_LOG_LEVEL", "error")
+			// The flag comes before -config and still wins over the file.
+			cfg, err := Load("test", []string{"-server.addr=:3", "-config=" + writeConfig(t, name, data)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Addr != ":3" {
+				t.Errorf("server.addr = %q, want the flag's", cfg.Server.Addr)
+			}
+			if cfg.Log.Level != "error" {
+				t.Errorf("log.level = %q, want the environment's", cfg.Log.Level)
+			}
+			if cfg.Server.Mode != "release" {
+				t.Errorf("server.mode = %q, want the file's", cfg.Server.Mode)
+			}
+			if cfg.Log.Format != Default().Log.Format {
+				t.Errorf("log.format = %q, want the default", cfg.Log.Format)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-config=" + writeConfig(t, "c.toml", "[server]\n  adr = ':1'\n")}, "adr"},
+		{[]string{"-config=" + writeConfig(t, "c.yaml", "server:\n  adr: ':1'\n")}, "adr"},
+		{[]string{"-config=" + writeConfig(t, "c.ini", "")}, "unsupported"},
+		{[]string{"-server.shutdown_timeout=soon"}, "shutdown_timeout"},
+		{[]string{"-jobs.workers=0", "-log.level=loud"}, "log.level"},
+		{[]string{"extra"}, "unexpected"},
+	}
+	for _, tt := range tests {
+		if _, err := Load("test", tt.args); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: err = %v, want one mentioning %s", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestExampleIsValid(t *testing.T) {
+	if _, err := Load("test", []string{"-config=../config.example.toml"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	if got := cfg.Redacted().Admin.Token; got != "" {
+		t.Errorf("unset token redacted to %q", got)
+	}
+	cfg.Admin.Token = "s3cret"
+	if got := cfg.Redacted().Admin.Token; got != redacted {
+		t.Errorf("token redacted to %q", got)
+	}
+	if cfg.Admin.Token != "s3cret" {
+		t.Error("Redacted changed the original")
+	}
+	var b strings.Builder
+	if err := cfg.Print(&b); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "s3cret") || !strings.Contains(b.String(), redacted) {
+		t.Errorf("printed token not redacted:\n%s", b.String())
+	}
+}
+
+func TestChecks(t *testing.T) {
+	defer func(saved []Check) { checks = saved }(checks)
+	AddCheck(func(c *Config, errs *ValidationError) {
+		if c.Maintenance.Message == "" {
+			errs.Add("maintenance.message", "is required")
+		}
+	})
+
+	cfg := Default()
+	cfg.Jobs.Workers = 0
+	cfg.Maintenance.Message = ""
+	var ve ValidationError
+	if err := cfg.Validate(); !errors.As(err, &ve) {
+		t.Fatalf("Validate = %v", err)
+	}
+	var keys []string
+	for _, fe := range ve {
+		keys = append(keys, fe.Key)
+	}
+	if strings.Join(keys, " ") != "jobs.workers maintenance.message" {
+		t.Errorf("problems with %v, want jobs.workers and then the check's", keys)
+	}
+}
+
+func TestReloadRejectsInvalidLimit(t *testing.T) {
+	path := writeConfig(t, "config.toml", "[rate_limit]\n  enabled = true\n  rps = 5.0\n")
+	s, err := NewStore("test", []string{"-config=" + path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloads := 0
+	s.OnReload(func(old, cur *Config) { reloads++ })
+
+	rewrite := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rewrite("[rate_limit]\n  enabled = true\n  rps = 0.0\n")
+	var ve ValidationError
+	if err := s.Reload(); !errors.As(err, &ve) || ve[0].Key != "rate_limit.rps" {
+		t.Fatalf("Reload = %v, want a rate_limit.rps problem", err)
+	}
+	if rps := s.Load().RateLimit.RPS; rps != 5 || reloads != 0 {
+		t.Errorf("after a rejected reload rps = %v and %d reload hooks ran", rps, reloads)
+	}
+
+	rewrite("[rate_limit]\n  enabled = true\n  rps = 7.0\n")
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if rps := s.Load().RateLimit.RPS; rps != 7 || reloads != 1 {
+		t.Errorf("after a reload rps = %v and %d reload hooks ran", rps, reloads)
+	}
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is prepended to every environment variable the loader reads,
+// e.g. TUTORIAL_SERVER_ADDR for server.addr.
+const EnvPrefix = "TUTORIAL"
+
+// Load builds a Config by layering, lowest precedence first: defaults, the
+// config file, environment variables and command-line flags. The file is
+// taken from -config or TUTORIAL_CONFIG. The result is validated.
+func Load(name string, args []string) (*Config, error) {
+	cfg := Default()
+	fields := fieldsOf(cfg)
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(EnvPrefix+"_CONFIG"), "path to a TOML or YAML config file")
+	set := map[string]string{}
+	for _, f := range fields {
+		fs.Var(flagValue{f, set}, f.key, f.help)
+		if f.alias != "" {
+			fs.Var(flagValue{f, set}, f.alias, "alias for -"+f.key)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	// Flags were applied to cfg while parsing; start over so the file and
+	// environment can go underneath them.
+	cfg = Default()
+	fields = fieldsOf(cfg)
+
+	if *path != "" {
+		if err := decodeFile(*path, cfg); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range fields {
+		if v, ok := os.LookupEnv(f.env()); ok {
+			if err := f.set(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.env(), err)
+			}
+		}
+	}
+	for _, f := range fields {
+		if v, ok := set[f.key]; ok {
+			if err := f.set(v); err != nil {
+				return nil, fmt.Errorf("-%s: %w", f.key, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func decodeFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		dec := toml.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+	default:
+		return fmt.Errorf("%s: unsupported config format %q", path, ext)
+	}
+	var strict *toml.StrictMissingError
+	if errors.As(err, &strict) {
+		return fmt.Errorf("%s: unknown settings:\n%s", path, strict.String())
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// flagValue applies a flag to its field and records it in set so it can be
+// replayed on top of the file and environment.
+type flagValue struct {
+	f   field
+	set map[string]string
+}
+
+func (v flagValue) String() string { return "" }
+
+func (v flagValue) IsBoolFlag() bool { return v.f.v.IsValid() && v.f.v.Kind() == reflect.Bool }
+
+func (v flagValue) Set(s string) error {
+	if err := v.f.set(s); err != nil {
+		return err
+	}
+	v.set[v.f.key] = s
+	return nil
+}
+
+// field is one leaf setting, addressed by its dotted key such as server.addr.
+type field struct {
+	key    string
+	alias  string
+	help   string
+	secret bool
+	v      reflect.Value
+}
+
+func (f field) env() string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(f.key, ".", "_"))
+}
+
+func (f field) set(s string) error {
+	if u, ok := f.v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch f.v.Kind() {
+	case reflect.String:
+		f.v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.v.SetFloat(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		switch f.v.Type().Elem().Kind() {
+		case reflect.String:
+			f.v.Set(reflect.ValueOf(items))
+		case reflect.Float64:
+			nums := make([]float64, len(items))
+			for i, item := range items {
+				n, err := strconv.ParseFloat(item, 64)
+				if err != nil {
+					return err
+				}
+				nums[i] = n
+			}
+			f.v.Set(reflect.ValueOf(nums))
+		default:
+			return fmt.Errorf("unsupported setting type %s", f.v.Type())
+		}
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.v.Type())
+	}
+	return nil
+}
+
+func fieldsOf(cfg *Config) []field {
+	return walk(reflect.ValueOf(cfg).Elem(), "", nil)
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func walk(v reflect.Value, prefix string, out []field) []field {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("toml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		fv := v.Field(i)
+		if sf.Type.Kind() == reflect.Struct && !reflect.PointerTo(sf.Type).Implements(textUnmarshaler) {
+			out = walk(fv, key+".", out)
+			continue
+		}
+		if sf.Type.Kind() == reflect.Slice && sf.Type.Elem().Kind() == reflect.Struct {
+			continue // arrays of tables only come from the config file
+		}
+		out = append(out, field{
+			key:    key,
+			alias:  sf.Tag.Get("flag"),
+			help:   sf.Tag.Get("help"),
+			secret: sf.Tag.Get("secret") == "true",
+			v:      fv,
+		})
+	}
+	return out
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+const redacted = "REDACTED"
+
+// Redacted returns a copy of c with every setting tagged secret:"true"
+// replaced by a placeholder, if it is set.
+func (c *Config) Redacted() *Config {
+	out := *c
+	for _, f := range fieldsOf(&out) {
+		if f.secret && f.v.Kind() == reflect.String && f.v.String() != "" {
+			f.v.SetString(redacted)
+		}
+	}
+	return &out
+}
+
+// Print writes the redacted configuration to w as TOML.
+func (c *Config) Print(w io.Writer) error {
+	enc := toml.NewEncoder(w)
+	enc.SetIndentTables(true)
+	return enc.Encode(c.Redacted())
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"log/slog"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Store holds the live configuration and swaps it atomically on reload.
+// Code that must observe reloads should call Load on every use instead of
+// keeping the *Config it got at startup.
+type Store struct {
+	name string
+	args []string
+
+	mu      sync.Mutex // serialises reloads
+	cur     atomic.Pointer[Config]
+	onSwaps []func(old, cur *Config)
+}
+
+// NewStore loads the configuration from args and keeps them so Reload reads
+// the same file, environment and flags again.
+func NewStore(name string, args []string) (*Store, error) {
+	cfg, err := Load(name, args)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{name: name, args: args}
+	s.cur.Store(cfg)
+	return s, nil
+}
+
+// Load returns the current configuration. It must not be modified.
+func (s *Store) Load() *Config {
+	return s.cur.Load()
+}
+
+// OnReload registers fn to be called after every successful reload.
+func (s *Store) OnReload(fn func(old, cur *Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onSwaps = append(s.onSwaps, fn)
+}
+
+// Reload re-reads and validates the configuration. If that fails the current
+// configuration is kept and the reason is logged and returned.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, err := Load(s.name, s.args)
+	if err != nil {
+		slog.Error("config reload rejected, keeping current configuration", "err", err)
+		return err
+	}
+
+	old := s.cur.Swap(cfg)
+	if needsRestart(old, cfg) {
+		slog.Warn("settings that are only read at startup changed; they take effect after a restart")
+	}
+	for _, fn := range s.onSwaps {
+		fn(old, cfg)
+	}
+	slog.Info("config reloaded")
+	return nil
+}
+
+// needsRestart reports whether a setting that is only read at startup differs.
+func needsRestart(old, cur *Config) bool {
+	return !reflect.DeepEqual(old.Server, cur.Server) ||
+		!reflect.DeepEqual(old.TLS, cur.TLS) ||
+		!reflect.DeepEqual(old.Metrics, cur.Metrics) ||
+		old.Tracing != cur.Tracing ||
+		old.Health != cur.Health ||
+		old.Audit != cur.Audit ||
+		old.Storage != cur.Storage ||
+		!reflect.DeepEqual(old.Blobs, cur.Blobs) ||
+		old.Events != cur.Events ||
+		old.WebSocket != cur.WebSocket ||
+		old.Jobs != cur.Jobs ||
+		old.Webhooks != cur.Webhooks ||
+		old.Cron != cur.Cron ||
+		old.Admin.Addr != cur.Admin.Addr ||
+		old.Log.Format != cur.Log.Format
+}
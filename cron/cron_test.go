@@ -0,0 +1,241 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	zone := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skip(err)
+		}
+		return loc
+	}
+	berlin, newYork := zone("Europe/Berlin"), zone("America/New_York")
+	santiago := zone("America/Santiago")
+	tests := []struct {
+		expr string
+		loc  *time.Location
+		from string
+		want string
+	}{
+		{"* * * * *", time.UTC, "2024-01-01T10:00:30Z", "2024-01-01T10:01:00Z"},
+		{"*/15 * * * *", time.UTC, "2024-01-01T10:15:00Z", "2024-01-01T10:30:00Z"},
+		{"0 3 * * *", time.UTC, "2024-01-01T03:00:00Z", "2024-01-02T03:00:00Z"},
+		{"30 8-10/2 * * *", time.UTC, "2024-01-01T08:31:00Z", "2024-01-01T10:30:00Z"},
+		{"0 0 1,15 * *", time.UTC, "2024-01-02T00:00:00Z", "2024-01-15T00:00:00Z"},
+		{"0 0 * * mon-fri", time.UTC, "2024-01-05T12:00:00Z", "2024-01-08T00:00:00Z"}, // Friday to Monday
+		{"0 0 * * 7", time.UTC, "2024-01-01T00:00:00Z", "2024-01-07T00:00:00Z"},
+		{"0 0 31 * *", time.UTC, "2024-04-01T00:00:00Z", "2024-05-31T00:00:00Z"},
+		{"0 0 29 feb *", time.UTC, "2024-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		// Either day field matches when both are restricted.
+		{"0 0 13 * fri", time.UTC, "2024-01-01T00:00:00Z", "2024-01-05T00:00:00Z"},
+		{"@monthly", time.UTC, "2024-01-31T23:59:00Z", "2024-02-01T00:00:00Z"},
+		{"@every 90m", time.UTC, "2024-01-01T10:00:00Z", "2024-01-01T11:30:00Z"},
+		{"0 3 * * *", berlin, "2024-01-01T00:00:00Z", "2024-01-01T02:00:00Z"},
+		{"TZ=Europe/Berlin 0 3 * * *", time.UTC, "2024-07-01T00:00:00Z", "2024-07-01T01:00:00Z"},
+		// 02:30 does not exist on the day clocks go forward, and happens
+		// twice on the day they go back.
+		{"30 2 * * *", berlin, "2024-03-31T00:00:00Z", "2024-04-01T00:30:00Z"},
+		{"30 2 * * *", berlin, "2024-10-27T00:00:00Z", "2024-10-27T01:30:00Z"},
+		{"30 2 * * *", berlin, "2024-10-27T01:30:00Z", "2024-10-28T01:30:00Z"},
+		{"* * * * *", berlin, "2024-10-27T01:30:00Z", "2024-10-27T01:31:00Z"},
+		// West of UTC, time.Date resolves the gap backwards.
+		{"0 2 * * *", newYork, "2026-03-07T17:00:00Z", "2026-03-09T06:00:00Z"},
+		{"30 2 * * *", newYork, "2026-03-08T00:00:00Z", "2026-03-09T06:30:00Z"},
+		{"* * * * *", newYork, "2026-03-08T06:59:00Z", "2026-03-08T07:00:00Z"},
+		{"0 3 * * *", newYork, "2026-03-08T05:00:00Z", "2026-03-08T07:00:00Z"},
+		{"30 1 * * *", newYork, "2026-11-01T04:00:00Z", "2026-11-01T05:30:00Z"},
+		{"30 1 * * *", newYork, "2026-11-01T05:30:00Z", "2026-11-02T06:30:00Z"},
+		{"*/20 * * * *", newYork, "2026-11-01T05:40:00Z", "2026-11-01T07:00:00Z"},
+		// Santiago skips midnight, so the day starts at 01:00.
+		{"0 * * * *", santiago, "2026-09-06T03:30:00Z", "2026-09-06T04:00:00Z"},
+		{"0 0 * * *", santiago, "2026-09-05T12:00:00Z", "2026-09-07T03:00:00Z"},
+		{"0 0 30 feb *", time.UTC, "2024-01-01T00:00:00Z", "0001-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr, tt.loc)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		from, _ := time.Parse(time.RFC3339, tt.from)
+		want, _ := time.Parse(time.RFC3339, tt.want)
+		if got := s.Next(from); !got.Equal(want) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got.UTC().Format(time.RFC3339), tt.want)
+		}
+	}
+}
+
+// TestNextAlwaysMovesOn walks a year in zones with daylight saving gaps at
+// various hours and checks that Next returns a later time within a day.
+func TestNextAlwaysMovesOn(t *testing.T) {
+	for _, name := range []string{"America/New_York", "America/Santiago", "Australia/Lord_Howe", "Europe/Berlin"} {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skip(err)
+		}
+		for _, expr := range []string{"* * * * *", "0 2 * * *", "30 0 * * *", "15 * * * *"} {
+			s, _ := Parse(expr, loc)
+			for from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC); from.Year() == 2026; from = from.Add(47 * time.Minute) {
+				next := s.Next(from)
+				if !next.After(from) || next.Sub(from) > 48*time.Hour {
+					t.Fatalf("%s %q after %s = %s", name, expr, from, next)
+				}
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@every 10ms",
+		"@every soon",
+		"@fortnightly",
+		"TZ=Nowhere/Atlantis * * * * *",
+	} {
+		if _, err := Parse(expr, time.UTC); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+}
+
+// waitRuns polls until the named task has finished n runs.
+func waitRuns(t *testing.T, s *Scheduler, name string, n int) Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, st := range s.Tasks() {
+			if st.Name == name && st.Runs >= n {
+				return st
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: %d runs not reached; tasks: %+v", name, n, s.Tasks())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSchedulerRunsAndRecovers(t *testing.T) {
+	s := New(time.UTC)
+	var ticks atomic.Int32
+	s.Add(Task{Name: "tick", Schedule: "@every 1s", Func: func(context.Context) (string, error) {
+		ticks.Add(1)
+		return "ticked", nil
+	}})
+	s.Add(Task{Name: "boom", Schedule: "@yearly", Func: func(context.Context) (string, error) {
+		panic("boom")
+	}})
+	s.Start()
+	defer s.Stop(context.Background())
+
+	if err := s.Trigger("boom"); err != nil {
+		t.Fatal(err)
+	}
+	st := waitRuns(t, s, "boom", 1)
+	if st.Failed != 1 || st.Last == nil || st.Last.Trigger != Manual || !strings.Contains(st.Last.Error, "panic: boom") {
+		t.Errorf("after a panic: %+v %+v", st, st.Last)
+	}
+	if st.Next == nil || st.Next.Before(time.Now()) {
+		t.Errorf("next = %v, want a future time", st.Next)
+	}
+
+	st = waitRuns(t, s, "tick", 1)
+	if st.Last.Trigger != Scheduled || st.Last.Result != "ticked" || st.Last.Error != "" {
+		t.Errorf("scheduled run: %+v", st.Last)
+	}
+
+	if err := s.Trigger("nope"); err != ErrNotFound {
+		t.Errorf("Trigger(unknown) = %v", err)
+	}
+}
+
+func TestSchedulerNoOverlap(t *testing.T) {
+	s := New(time.UTC)
+	release := make(chan struct{})
+	var running, maxRunning atomic.Int32
+	s.Add(Task{Name: "slow", Schedule: "@every 1s", Func: func(ctx context.Context) (string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		if n > maxRunning.Load() {
+			maxRunning.Store(n)
+		}
+		<-release
+		return "", nil
+	}})
+	s.Start()
+
+	if err := s.Trigger("slow"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Trigger("slow"); err != ErrRunning {
+		t.Errorf("second Trigger = %v, want ErrRunning", err)
+	}
+	// Let the schedule come round while the manual run is still busy.
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Tasks()[0].Skipped == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no scheduled run was skipped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	s.Stop(context.Background())
+	if maxRunning.Load() != 1 {
+		t.Errorf("%d runs at once", maxRunning.Load())
+	}
+	if err := s.Trigger("slow"); err != ErrStopped {
+		t.Errorf("Trigger after Stop = %v", err)
+	}
+}
+
+func TestStopCancelsRuns(t *testing.T) {
+	s := New(time.UTC)
+	s.Add(Task{Name: "stuck", Schedule: "@yearly", Func: func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}})
+	s.Start()
+	s.Trigger("stuck")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	s.Stop(ctx)
+	st := s.Tasks()[0]
+	if st.Running || st.Last == nil || st.Last.Error != errShutdown.Error() {
+		t.Errorf("after Stop: %+v %+v", st, st.Last)
+	}
+	if st.Next != nil {
+		t.Errorf("next run %v after Stop", st.Next)
+	}
+}
+
+func TestAddErrors(t *testing.T) {
+	s := New(time.UTC)
+	noop := func(context.Context) (string, error) { return "", nil }
+	if err := s.Add(Task{Name: "a", Schedule: "bad", Func: noop}); err == nil {
+		t.Error("added a task with a bad schedule")
+	}
+	s.Add(Task{Name: "a", Schedule: "@daily", Func: noop})
+	if err := s.Add(Task{Name: "a", Schedule: "@daily", Func: noop}); !errors.Is(err, ErrExists) {
+		t.Errorf("duplicate Add = %v", err)
+	}
+}
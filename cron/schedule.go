@@ -0,0 +1,230 @@
+// Package cron runs recurring tasks inside the process on cron schedules.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule says when a task runs next.
+type Schedule interface {
+	// Next returns the first run time after t, or the zero time if there
+	// is none.
+	Next(t time.Time) time.Time
+}
+
+// Parse reads a standard five-field cron expression (minute, hour, day of
+// month, month, day of week), evaluated in loc, or one of the shorthands
+// @yearly, @monthly, @weekly, @daily, @hourly and "@every <duration>".
+// A "TZ=<zone> " prefix overrides loc. Fields take *, numbers, ranges
+// (1-5), lists (1,15) and steps (*/10, 0-30/5); months and weekdays may be
+// given by their English three-letter names, and Sunday is 0 or 7.
+//
+// When both the day of month and the day of week are restricted, a day
+// matching either runs the task, as in Vixie cron.
+func Parse(expr string, loc *time.Location) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "TZ="); ok {
+		zone, spec, _ := strings.Cut(rest, " ")
+		l, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("cron: %w", err)
+		}
+		loc, expr = l, strings.TrimSpace(spec)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("cron: %w", err)
+		}
+		if d < time.Second {
+			return nil, errors.New("cron: @every needs at least 1s")
+		}
+		return every(d), nil
+	}
+	switch expr {
+	case "@yearly", "@annually":
+		expr = "0 0 1 1 *"
+	case "@monthly":
+		expr = "0 0 1 * *"
+	case "@weekly":
+		expr = "0 0 * * 0"
+	case "@daily", "@midnight":
+		expr = "0 0 * * *"
+	case "@hourly":
+		expr = "0 * * * *"
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron: %q has %d fields, want 5", expr, len(fields))
+	}
+	s := &spec{loc: loc}
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron: minute: %w", err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron: hour: %w", err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron: day of month: %w", err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("cron: month: %w", err)
+	}
+	if s.dow, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("cron: day of week: %w", err)
+	}
+	if s.dow.has(7) {
+		s.dow |= 1 // Sunday
+	}
+	s.domStar, s.dowStar = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+// every runs at a fixed interval from the previous run.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+
+// bits has bit n set if value n matches.
+type bits uint64
+
+func (b bits) has(n int) bool { return b&(1<<n) != 0 }
+
+var (
+	monthNames = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+func parseField(field string, lo, hi int, names []string) (bits, error) {
+	var b bits
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("bad step %q", stepStr)
+			}
+			step = n
+		}
+
+		first, last := lo, hi
+		if rng != "*" {
+			a, z, isRange := strings.Cut(rng, "-")
+			var err error
+			if first, err = parseValue(a, lo, hi, names); err != nil {
+				return 0, err
+			}
+			last = first
+			if isRange {
+				if last, err = parseValue(z, lo, hi, names); err != nil {
+					return 0, err
+				}
+				if last < first {
+					return 0, fmt.Errorf("range %q runs backwards", rng)
+				}
+			} else if hasStep {
+				last = hi // "5/15" means from 5 on
+			}
+		}
+		for n := first; n <= last; n += step {
+			b |= 1 << n
+		}
+	}
+	return b, nil
+}
+
+func parseValue(s string, lo, hi int, names []string) (int, error) {
+	for i, name := range names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", s)
+	}
+	if n < lo || n > hi {
+		return 0, fmt.Errorf("%d is outside %d-%d", n, lo, hi)
+	}
+	return n, nil
+}
+
+type spec struct {
+	minute, hour, dom, month, dow bits
+	domStar, dowStar              bool
+	loc                           *time.Location
+}
+
+// Next advances field by field, from months down to minutes, resetting the
+// smaller fields whenever a larger one moves. Wall-clock times that a
+// daylight saving change skips do not run that day, and those it repeats run
+// once.
+func (s *spec) Next(t time.Time) time.Time {
+	t = t.In(s.loc)
+	t = forward(t, s.date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1))
+	limit := t.Year() + 5 // Feb 29 on a Monday may be years away; nothing is further
+
+	for t.Year() <= limit {
+		var next time.Time
+		switch {
+		case !s.month.has(int(t.Month())):
+			next = s.date(t.Year(), t.Month()+1, 1, 0, 0)
+		case !s.dayMatches(t):
+			next = s.date(t.Year(), t.Month(), t.Day()+1, 0, 0)
+		case !s.hour.has(t.Hour()):
+			next = s.date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0)
+		case !s.minute.has(t.Minute()):
+			next = s.date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1)
+		default:
+			return t
+		}
+		t = forward(t, next)
+	}
+	return time.Time{}
+}
+
+// date is time.Date in s.loc, except that a wall-clock time skipped by a
+// daylight saving change gives the first instant after the gap; time.Date
+// resolves it to either side depending on the zone.
+func (s *spec) date(year int, month time.Month, day, hour, min int) time.Time {
+	want := time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	t := time.Date(year, month, day, hour, min, 0, 0, s.loc)
+	got := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	if got.Equal(want) {
+		return t
+	}
+	start, end := t.ZoneBounds()
+	if got.Before(want) {
+		return end // resolved to before the gap
+	}
+	return start
+}
+
+// forward returns next, or the next minute of t if next does not lie after
+// t, as with a wall-clock time repeated at the end of daylight saving time
+// that resolves to its first occurrence. Every step of Next thus moves on.
+func forward(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Truncate(time.Minute).Add(time.Minute)
+}
+
+func (s *spec) dayMatches(t time.Time) bool {
+	dom, dow := s.dom.has(t.Day()), s.dow.has(int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,326 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("no such task")
+	ErrRunning  = errors.New("task is already running")
+	ErrStopped  = errors.New("scheduler is stopped")
+	ErrExists   = errors.New("task already added")
+)
+
+// errShutdown is the cause of the context of runs interrupted by Stop.
+var errShutdown = errors.New("interrupted by shutdown")
+
+// Func is the work of a task. The string is a short account of what it did,
+// such as "purged 3 links", shown as the result of the run.
+type Func func(ctx context.Context) (string, error)
+
+// Task is a named piece of work run on a schedule.
+type Task struct {
+	Name string
+	// Schedule is a cron expression as understood by Parse.
+	Schedule string
+	// Jitter delays every scheduled run by a random duration up to Jitter,
+	// so that instances started together do not all run at once.
+	Jitter time.Duration
+	// Timeout limits one run; zero means no limit.
+	Timeout time.Duration
+	Func    Func
+}
+
+// Trigger says what started a run.
+type Trigger string
+
+const (
+	Scheduled Trigger = "schedule"
+	Manual    Trigger = "manual"
+)
+
+// Run is the outcome of one run of a task.
+type Run struct {
+	Trigger    Trigger   `json:"trigger"`
+	Started    time.Time `json:"started"`
+	DurationMS float64   `json:"duration_ms"`
+	Result     string    `json:"result,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Status describes a task for the admin API.
+type Status struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	// Next is when the next scheduled run starts, jitter included.
+	Next    *time.Time `json:"next,omitempty"`
+	Running bool       `json:"running"`
+	Runs    int        `json:"runs"`
+	Failed  int        `json:"failed"`
+	// Skipped counts scheduled runs left out because the previous run had
+	// not finished.
+	Skipped int  `json:"skipped"`
+	Last    *Run `json:"last_run,omitempty"`
+}
+
+type task struct {
+	Task
+	schedule Schedule
+
+	// Guarded by Scheduler.mu.
+	next    time.Time
+	running bool
+	runs    int
+	failed  int
+	skipped int
+	last    *Run
+}
+
+// Scheduler runs tasks in the background on their schedules. A task never
+// runs twice at the same time, and a panicking task is logged and recorded
+// as failed without affecting the others.
+type Scheduler struct {
+	loc *time.Location
+
+	mu      sync.Mutex
+	tasks   map[string]*task
+	started bool
+	stopped bool
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	stop   chan struct{}
+	loops  sync.WaitGroup
+	runs   sync.WaitGroup
+}
+
+// New returns a scheduler that evaluates cron expressions in loc unless
+// they name their own time zone.
+func New(loc *time.Location) *Scheduler {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &Scheduler{
+		loc:    loc,
+		tasks:  map[string]*task{},
+		ctx:    ctx,
+		cancel: cancel,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Add registers t. Tasks added after Start are scheduled at once.
+func (s *Scheduler) Add(t Task) error {
+	sched, err := Parse(t.Schedule, s.loc)
+	if err != nil {
+		return fmt.Errorf("task %s: %w", t.Name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return ErrStopped
+	}
+	if _, ok := s.tasks[t.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrExists, t.Name)
+	}
+	tk := &task{Task: t, schedule: sched}
+	s.tasks[t.Name] = tk
+	if s.started {
+		s.planLocked(tk, time.Now())
+		s.loops.Add(1)
+		go s.loop(tk)
+	}
+	return nil
+}
+
+// Start schedules the tasks.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+	for _, tk := range s.tasks {
+		s.planLocked(tk, time.Now())
+		s.loops.Add(1)
+		go s.loop(tk)
+	}
+}
+
+// Stop schedules no further runs and waits for the running ones to finish.
+// When ctx is done first, their contexts are cancelled and Stop waits for
+// them to return.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	s.mu.Unlock()
+	close(s.stop)
+	s.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.cancel(errShutdown)
+		<-done
+	}
+	s.cancel(errShutdown)
+	return nil
+}
+
+// Trigger runs the named task now, outside its schedule.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tk, ok := s.tasks[name]
+	if !ok {
+		return ErrNotFound
+	}
+	return s.startLocked(tk, Manual)
+}
+
+// Tasks returns the status of every task, by name.
+func (s *Scheduler) Tasks() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Status, 0, len(s.tasks))
+	for _, tk := range s.tasks {
+		st := Status{
+			Name:     tk.Name,
+			Schedule: tk.Task.Schedule,
+			Running:  tk.running,
+			Runs:     tk.runs,
+			Failed:   tk.failed,
+			Skipped:  tk.skipped,
+		}
+		if !tk.next.IsZero() {
+			next := tk.next
+			st.Next = &next
+		}
+		if tk.last != nil {
+			last := *tk.last
+			st.Last = &last
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// loop waits for each scheduled run of tk in turn.
+func (s *Scheduler) loop(tk *task) {
+	defer s.loops.Done()
+	for {
+		s.mu.Lock()
+		next := tk.next
+		s.mu.Unlock()
+		if next.IsZero() {
+			slog.Warn("cron task will not run again", "task", tk.Name)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-s.stop:
+			timer.Stop()
+			s.mu.Lock()
+			tk.next = time.Time{}
+			s.mu.Unlock()
+			return
+		}
+
+		s.mu.Lock()
+		if err := s.startLocked(tk, Scheduled); errors.Is(err, ErrRunning) {
+			tk.skipped++
+			slog.Warn("cron task still running, skipping this run", "task", tk.Name)
+		}
+		s.planLocked(tk, time.Now())
+		s.mu.Unlock()
+	}
+}
+
+// planLocked sets the time of the next scheduled run of tk after now.
+func (s *Scheduler) planLocked(tk *task, now time.Time) {
+	tk.next = tk.schedule.Next(now)
+	if !tk.next.IsZero() && tk.Jitter > 0 {
+		tk.next = tk.next.Add(time.Duration(rand.Int63n(int64(tk.Jitter))))
+	}
+}
+
+func (s *Scheduler) startLocked(tk *task, trigger Trigger) error {
+	if s.stopped {
+		return ErrStopped
+	}
+	if tk.running {
+		return ErrRunning
+	}
+	tk.running = true
+	s.runs.Add(1)
+	go s.run(tk, trigger)
+	return nil
+}
+
+func (s *Scheduler) run(tk *task, trigger Trigger) {
+	defer s.runs.Done()
+	ctx := s.ctx
+	if tk.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, tk.Timeout)
+		defer cancel()
+	}
+
+	started := time.Now()
+	result, err := call(ctx, tk)
+	r := &Run{
+		Trigger:    trigger,
+		Started:    started,
+		DurationMS: float64(time.Since(started).Microseconds()) / 1000,
+		Result:     result,
+	}
+	log := slog.With("task", tk.Name, "trigger", trigger, "duration", time.Since(started))
+	if err != nil {
+		if cause := context.Cause(ctx); cause != nil && errors.Is(err, context.Canceled) {
+			err = cause
+		}
+		r.Error = err.Error()
+		log.Error("cron task failed", "err", err)
+	} else {
+		log.Info("cron task finished", "result", result)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tk.running = false
+	tk.runs++
+	if err != nil {
+		tk.failed++
+	}
+	tk.last = r
+}
+
+// call runs tk, turning a panic into an error.
+func call(ctx context.Context, tk *task) (result string, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			slog.Error("cron task panicked", "task", tk.Name, "panic", v, "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return tk.Func(ctx)
+}
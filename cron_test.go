@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tutorial/cron"
+	"tutorial/links"
+)
+
+func TestCronAdmin(t *testing.T) {
+	a, public := newTestApp(t, "-storage.engine=disk", "-storage.dir="+t.TempDir(), "-admin.token=s3cret")
+	admin := a.setupAdminRouter(public)
+
+	past := time.Now().Add(-time.Hour)
+	a.links.Create(&links.Link{Code: "old", URL: "https://example.com", Status: 302, ExpiresAt: &past}, func(string) bool { return false })
+	a.links.Create(&links.Link{Code: "live", URL: "https://example.com", Status: 302}, func(string) bool { return false })
+
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, req)
+		return w
+	}
+	tasks := func() map[string]cron.Status {
+		w := serve("GET", "/cron", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: status %d; body: %s", w.Code, w.Body)
+		}
+		var list []cron.Status
+		json.Unmarshal(w.Body.Bytes(), &list)
+		out := map[string]cron.Status{}
+		for _, s := range list {
+			out[s.Name] = s
+		}
+		return out
+	}
+
+	got := tasks()
+	if _, ok := got["purge_links"]; !ok || len(got) != 2 {
+		t.Fatalf("tasks = %+v; want purge_links and compact_storage, no audit rotation", got)
+	}
+	if got["purge_links"].Next == nil {
+		t.Error("purge_links has no next run")
+	}
+
+	if w := serve("POST", "/cron/purge_links/run", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("trigger without token: status %d", w.Code)
+	}
+	if w := serve("POST", "/cron/nope/run", "s3cret"); w.Code != http.StatusNotFound {
+		t.Errorf("trigger unknown task: status %d", w.Code)
+	}
+	if w := serve("POST", "/cron/purge_links/run", "s3cret"); w.Code != http.StatusAccepted {
+		t.Fatalf("trigger: status %d; body: %s", w.Code, w.Body)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for tasks()["purge_links"].Runs == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("purge_links did not run")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	last := tasks()["purge_links"].Last
+	if last.Trigger != cron.Manual || last.Result != "purged 1 expired links" || last.Error != "" {
+		t.Errorf("last run = %+v", last)
+	}
+	if _, err := a.links.Get("old"); err != links.ErrNotFound {
+		t.Errorf("expired link still there: %v", err)
+	}
+	if _, err := a.links.Get("live"); err != nil {
+		t.Errorf("live link purged: %v", err)
+	}
+}
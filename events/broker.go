@@ -0,0 +1,222 @@
+// Package events is an in-process publish/subscribe broker with named
+// topics, streamed to browsers as Server-Sent Events.
+package events
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrTooManyTopics = errors.New("events: too many topics")
+	ErrClosed        = errors.New("events: broker is closed")
+)
+
+// Event is one published message. IDs increase by one per topic.
+type Event struct {
+	ID    uint64    `json:"id"`
+	Topic string    `json:"topic"`
+	Type  string    `json:"type"`
+	Data  string    `json:"data"`
+	Time  time.Time `json:"time"`
+}
+
+// Options size a Broker.
+type Options struct {
+	// History is how many recent events each topic keeps for replay.
+	History int
+	// Buffer is how many events a subscriber may fall behind before it is
+	// dropped.
+	Buffer int
+	// MaxTopics bounds the number of topics.
+	MaxTopics int
+	// Retention is how long a topic nobody subscribes to keeps its history
+	// after the last event. Once it has passed, the topic may be removed to
+	// make room for new ones. A topic without history goes as soon as its
+	// last subscriber does.
+	Retention time.Duration
+}
+
+// Broker fans events out to the subscribers of their topic. A subscriber
+// that does not keep up is dropped instead of slowing down publishers; it
+// can resubscribe from the last event it saw.
+type Broker struct {
+	opts Options
+
+	mu     sync.Mutex
+	topics map[string]*topic
+	closed bool
+
+	dropped atomic.Int64
+}
+
+type topic struct {
+	ring    []Event // the last History events, oldest first once full
+	start   int
+	lastID  uint64
+	updated time.Time // of the last event
+	subs    map[*Subscription]struct{}
+}
+
+// idle reports whether t may be removed: nobody listens and its history, if
+// any, has expired.
+func (t *topic) idle(now time.Time, retention time.Duration) bool {
+	return len(t.subs) == 0 && (len(t.ring) == 0 || now.Sub(t.updated) > retention)
+}
+
+// Subscription receives the events of one topic on C, which is closed when
+// the subscriber is dropped or the broker closes.
+type Subscription struct {
+	C     <-chan Event
+	c     chan Event
+	topic string
+}
+
+func NewBroker(opts Options) *Broker {
+	return &Broker{opts: opts, topics: map[string]*topic{}}
+}
+
+// topic returns the named topic, creating it if needed. At the limit, idle
+// topics are removed to make room. b.mu must be held.
+func (b *Broker) topic(name string) (*topic, error) {
+	if b.closed {
+		return nil, ErrClosed
+	}
+	t, ok := b.topics[name]
+	if !ok {
+		if len(b.topics) >= b.opts.MaxTopics {
+			now := time.Now()
+			for name, t := range b.topics {
+				if t.idle(now, b.opts.Retention) {
+					delete(b.topics, name)
+				}
+			}
+		}
+		if len(b.topics) >= b.opts.MaxTopics {
+			return nil, ErrTooManyTopics
+		}
+		t = &topic{subs: map[*Subscription]struct{}{}}
+		b.topics[name] = t
+	}
+	return t, nil
+}
+
+// Publish appends an event to the topic and delivers it to its subscribers.
+func (b *Broker) Publish(name, typ, data string) (Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, err := b.topic(name)
+	if err != nil {
+		return Event{}, err
+	}
+	t.lastID++
+	ev := Event{ID: t.lastID, Topic: name, Type: typ, Data: data, Time: time.Now().UTC()}
+	t.updated = ev.Time
+	if len(t.ring) < b.opts.History {
+		t.ring = append(t.ring, ev)
+	} else if b.opts.History > 0 {
+		t.ring[t.start] = ev
+		t.start = (t.start + 1) % len(t.ring)
+	}
+
+	for s := range t.subs {
+		select {
+		case s.c <- ev:
+		default:
+			delete(t.subs, s)
+			close(s.c)
+			b.dropped.Add(1)
+		}
+	}
+	b.releaseLocked(name, t)
+	return ev, nil
+}
+
+// Subscribe registers for the topic's events. Events after lastID that are
+// still in the history are returned for replay, and nothing published
+// after them is missed. A lastID from before a restart, which is ahead of
+// the topic, replays the whole history.
+func (b *Broker) Subscribe(name string, lastID uint64) (*Subscription, []Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, err := b.topic(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lastID > t.lastID {
+		lastID = 0
+	}
+	var replay []Event
+	for i := range t.ring {
+		ev := t.ring[(t.start+i)%len(t.ring)]
+		if ev.ID > lastID {
+			replay = append(replay, ev)
+		}
+	}
+
+	c := make(chan Event, b.opts.Buffer)
+	s := &Subscription{C: c, c: c, topic: name}
+	t.subs[s] = struct{}{}
+	return s, replay, nil
+}
+
+// Unsubscribe stops delivery to s. It is safe to call after s was dropped.
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[s.topic]
+	if !ok {
+		return
+	}
+	if _, ok := t.subs[s]; ok {
+		delete(t.subs, s)
+		close(s.c)
+	}
+	b.releaseLocked(s.topic, t)
+}
+
+// releaseLocked removes t if nobody listens and there is no history to
+// replay, so merely subscribing does not use up topics.
+func (b *Broker) releaseLocked(name string, t *topic) {
+	if len(t.subs) == 0 && len(t.ring) == 0 {
+		delete(b.topics, name)
+	}
+}
+
+// Close ends every subscription, so open streams finish before the server
+// waits for in-flight requests.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for _, t := range b.topics {
+		for s := range t.subs {
+			delete(t.subs, s)
+			close(s.c)
+		}
+	}
+}
+
+// Stats describe the broker for metrics.
+type Stats struct {
+	Topics      int
+	Subscribers int
+	Dropped     int64
+}
+
+func (b *Broker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := Stats{Topics: len(b.topics), Dropped: b.dropped.Load()}
+	for _, t := range b.topics {
+		st.Subscribers += len(t.subs)
+	}
+	return st
+}
@@ -0,0 +1,119 @@
+package events
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func ids(evs []Event) string {
+	s := ""
+	for _, ev := range evs {
+		s += fmt.Sprint(ev.ID, " ")
+	}
+	return s
+}
+
+func TestReplay(t *testing.T) {
+	b := NewBroker(Options{History: 3, Buffer: 10, MaxTopics: 10})
+	for i := 0; i < 5; i++ {
+		b.Publish("t", "message", fmt.Sprint(i))
+	}
+
+	tests := []struct {
+		lastID uint64
+		want   string
+	}{
+		{0, "3 4 5 "},  // everything still kept
+		{3, "4 5 "},    // resume
+		{5, ""},        // up to date
+		{1, "3 4 5 "},  // older than the history: a gap, but as much as there is
+		{99, "3 4 5 "}, // from before a restart
+	}
+	for _, tt := range tests {
+		s, replay, err := b.Subscribe("t", tt.lastID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(replay); got != tt.want {
+			t.Errorf("Subscribe after %d replayed %q, want %q", tt.lastID, got, tt.want)
+		}
+		b.Unsubscribe(s)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBroker(Options{History: 10, Buffer: 2, MaxTopics: 10})
+	slow, _, _ := b.Subscribe("t", 0)
+	fast, _, _ := b.Subscribe("t", 0)
+
+	var got []Event
+	for i := 0; i < 5; i++ {
+		b.Publish("t", "message", "x")
+		got = append(got, <-fast.C)
+	}
+	if ids(got) != "1 2 3 4 5 " {
+		t.Errorf("fast subscriber got %s", ids(got))
+	}
+
+	var slowGot []Event
+	for ev := range slow.C {
+		slowGot = append(slowGot, ev)
+	}
+	if ids(slowGot) != "1 2 " {
+		t.Errorf("slow subscriber got %s before being dropped, want 1 2", ids(slowGot))
+	}
+	if st := b.Stats(); st.Subscribers != 1 || st.Dropped != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+	b.Unsubscribe(slow) // already dropped; must not panic
+}
+
+func TestLimitsAndClose(t *testing.T) {
+	b := NewBroker(Options{History: 1, Buffer: 1, MaxTopics: 1})
+	s, _, _ := b.Subscribe("a", 0)
+	if _, err := b.Publish("b", "message", "x"); err != ErrTooManyTopics {
+		t.Errorf("second topic: err = %v, want ErrTooManyTopics", err)
+	}
+	b.Close()
+	if _, ok := <-s.C; ok {
+		t.Error("subscription still open after Close")
+	}
+	if _, _, err := b.Subscribe("a", 0); err != ErrClosed {
+		t.Errorf("Subscribe after Close: err = %v, want ErrClosed", err)
+	}
+}
+
+func TestIdleTopicsMakeRoom(t *testing.T) {
+	b := NewBroker(Options{History: 1, Buffer: 1, MaxTopics: 2, Retention: time.Hour})
+
+	// Subscribing alone does not use up topics once the subscriber leaves.
+	for i := 0; i < 5; i++ {
+		s, _, err := b.Subscribe(fmt.Sprint("anon", i), 0)
+		if err != nil {
+			t.Fatalf("subscribe %d: %v", i, err)
+		}
+		b.Unsubscribe(s)
+	}
+	if st := b.Stats(); st.Topics != 0 {
+		t.Errorf("%d topics left after every subscriber went", st.Topics)
+	}
+
+	// Topics with fresh history are kept, so a reconnect can replay.
+	b.Publish("a", "message", "x")
+	b.Publish("b", "message", "x")
+	if _, err := b.Publish("c", "message", "x"); err != ErrTooManyTopics {
+		t.Fatalf("third topic: err = %v, want ErrTooManyTopics", err)
+	}
+
+	// Expired history gives way.
+	b.mu.Lock()
+	b.topics["a"].updated = time.Now().Add(-2 * time.Hour)
+	b.mu.Unlock()
+	if _, err := b.Publish("c", "message", "x"); err != nil {
+		t.Fatalf("third topic after a expired: %v", err)
+	}
+	if _, replay, _ := b.Subscribe("b", 0); ids(replay) != "1 " {
+		t.Errorf("b replays %s, want 1", ids(replay))
+	}
+}
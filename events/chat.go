@@ -0,0 +1,21 @@
+package events
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type chatQuery struct {
+	Room string `form:"room" binding:"omitempty,max=32,alphanum"`
+}
+
+// Chat serves the chat room page. Messages are published to, and streamed
+// from, the topic "chat" plus the room name.
+func Chat(c *gin.Context) {
+	var q chatQuery
+	if err := c.ShouldBindQuery(&q); err != nil || q.Room == "" {
+		q.Room = "lobby"
+	}
+	c.HTML(http.StatusOK, "chat.html", gin.H{"Room": q.Room, "Topic": "chat" + q.Room})
+}
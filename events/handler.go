@@ -0,0 +1,134 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+	"tutorial/routes"
+)
+
+// Handler serves the event streams and the publish API.
+type Handler struct {
+	broker    *Broker
+	heartbeat time.Duration
+}
+
+// NewHandler sends a comment on idle streams every heartbeat, so proxies
+// keep them open and dead connections are noticed.
+func NewHandler(broker *Broker, heartbeat time.Duration) *Handler {
+	return &Handler{broker: broker, heartbeat: heartbeat}
+}
+
+type topicURI struct {
+	Topic string `uri:"topic" binding:"required,max=64,alphanum"`
+}
+
+type publishRequest struct {
+	Type string          `json:"type" binding:"omitempty,max=64,alphanum"`
+	Data json.RawMessage `json:"data" binding:"required,max=65536"`
+}
+
+// RegisterStream mounts GET /:topic on r, typically /events.
+func (h *Handler) RegisterStream(r routes.Router) {
+	r.GET("/:topic", routes.Meta{Name: "events.stream", Description: "Server-Sent Events of a topic; resumes after Last-Event-ID.", Auth: "none", Owner: "platform"}, h.stream)
+}
+
+// RegisterAPI mounts POST /:topic on r, typically /api/events.
+func (h *Handler) RegisterAPI(r routes.Router) {
+	r.POST("/:topic", routes.Meta{Name: "events.publish", Description: "Publishes a JSON event to a topic.", Auth: "none", Owner: "platform"}, h.publish)
+}
+
+func (h *Handler) publish(c *gin.Context) {
+	var uri topicURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	var req publishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	if req.Type == "" {
+		req.Type = "message"
+	}
+	ev, err := h.broker.Publish(uri.Topic, req.Type, string(req.Data))
+	if err != nil {
+		c.Error(brokerError(err))
+		return
+	}
+	c.JSON(http.StatusAccepted, ev)
+}
+
+func (h *Handler) stream(c *gin.Context) {
+	var uri topicURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	// EventSource sends the header when it reconnects; the query parameter
+	// is for clients that cannot set headers.
+	last := c.GetHeader("Last-Event-ID")
+	if last == "" {
+		last = c.Query("last_event_id")
+	}
+	lastID, _ := strconv.ParseUint(last, 10, 64)
+
+	sub, replay, err := h.broker.Subscribe(uri.Topic, lastID)
+	if err != nil {
+		c.Error(brokerError(err))
+		return
+	}
+	defer h.broker.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	c.Status(http.StatusOK)
+	for _, ev := range replay {
+		render(c, ev)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind, or shutting down; the client
+				// reconnects and replays what it missed.
+				return false
+			}
+			render(c, ev)
+			return true
+		case <-heartbeat.C:
+			io.WriteString(w, ": heartbeat\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func render(c *gin.Context, ev Event) {
+	c.Render(-1, sse.Event{Id: strconv.FormatUint(ev.ID, 10), Event: ev.Type, Data: ev.Data})
+}
+
+func brokerError(err error) error {
+	switch {
+	case errors.Is(err, ErrTooManyTopics):
+		return problem.New(http.StatusServiceUnavailable, "too_many_topics", "No more topics can be created.")
+	case errors.Is(err, ErrClosed):
+		return problem.New(http.StatusServiceUnavailable, "shutting_down", "The server is shutting down.")
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package flags
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Decode turns flag definitions as read from the config file, one map per
+// [[flags.flag]] table, into normalized flags. Every problem is a
+// *FieldError whose Field starts with the definition's index, such as
+// "flag[2].key"; they are returned joined.
+func Decode(defs []map[string]any) ([]Flag, error) {
+	out := make([]Flag, 0, len(defs))
+	var errs []error
+	keys := map[string]bool{}
+	for i, def := range defs {
+		at := fmt.Sprintf("flag[%d]", i)
+		f, err := decodeOne(def)
+		if err != nil {
+			errs = append(errs, &FieldError{at, err.Error()})
+			continue
+		}
+		f.Normalize()
+		var fe *FieldError
+		if err := f.Validate(); errors.As(err, &fe) {
+			errs = append(errs, &FieldError{at + "." + fe.Field, fe.Message})
+		} else if keys[f.Key] {
+			errs = append(errs, &FieldError{at + ".key", fmt.Sprintf("%q is defined twice", f.Key)})
+		} else {
+			out = append(out, f)
+		}
+		keys[f.Key] = true
+	}
+	return out, errors.Join(errs...)
+}
+
+// decodeOne goes through JSON, whose field names the definitions share, so
+// that unknown settings are refused as they are in the rest of the file.
+func decodeOne(def map[string]any) (Flag, error) {
+	b, err := json.Marshal(def)
+	if err != nil {
+		return Flag{}, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var f Flag
+	if err := dec.Decode(&f); err != nil {
+		return Flag{}, err
+	}
+	f.Source, f.Updated = "", nil
+	return f, nil
+}
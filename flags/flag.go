@@ -0,0 +1,279 @@
+// Package flags evaluates feature flags: boolean or multivariate switches
+// that serve different variants to different callers, by targeting rules
+// and sticky percentage rollouts.
+package flags
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The variants of a boolean flag.
+const (
+	On  = "on"
+	Off = "off"
+)
+
+// Attributes rules can match on; "header:<Name>" matches a request header.
+const (
+	AttrUser   = "user"
+	AttrTenant = "tenant"
+	headerAttr = "header:"
+)
+
+// Flag is a feature flag. Flags without Variants are boolean and have the
+// variants "on" and "off".
+type Flag struct {
+	Key         string `json:"key" toml:"key" yaml:"key"`
+	Description string `json:"description,omitempty" toml:"description,omitempty" yaml:"description,omitempty"`
+	// Enabled false serves OffVariant to everyone, whatever the rules say.
+	Enabled  bool     `json:"enabled" toml:"enabled" yaml:"enabled"`
+	Variants []string `json:"variants,omitempty" toml:"variants,omitempty" yaml:"variants,omitempty"`
+	// OffVariant is served while the flag is disabled; "off" for boolean
+	// flags and the first variant otherwise, unless set.
+	OffVariant string `json:"off_variant,omitempty" toml:"off_variant,omitempty" yaml:"off_variant,omitempty"`
+	// Rules are tried in order and the first that matches decides.
+	Rules []Rule `json:"rules,omitempty" toml:"rules,omitempty" yaml:"rules,omitempty"`
+	// Rollout splits the callers no rule matched between variants. Without
+	// it they get Default.
+	Rollout []Split `json:"rollout,omitempty" toml:"rollout,omitempty" yaml:"rollout,omitempty"`
+	// Default is "on" for boolean flags and the first variant otherwise,
+	// unless set.
+	Default string `json:"default,omitempty" toml:"default,omitempty" yaml:"default,omitempty"`
+
+	// Source is "config" or "api", telling where the flag is defined.
+	Source  string     `json:"source,omitempty" toml:"-" yaml:"-"`
+	Updated *time.Time `json:"updated,omitempty" toml:"-" yaml:"-"`
+}
+
+// Rule serves Variant, or splits by Rollout, when the caller's Attribute is
+// one of Values.
+type Rule struct {
+	Attribute string   `json:"attribute" toml:"attribute" yaml:"attribute"`
+	Values    []string `json:"values" toml:"values" yaml:"values"`
+	Variant   string   `json:"variant,omitempty" toml:"variant,omitempty" yaml:"variant,omitempty"`
+	Rollout   []Split  `json:"rollout,omitempty" toml:"rollout,omitempty" yaml:"rollout,omitempty"`
+}
+
+// Split gives Percent of the callers a variant. The splits of a rollout add
+// up to 100.
+type Split struct {
+	Variant string  `json:"variant" toml:"variant" yaml:"variant"`
+	Percent float64 `json:"percent" toml:"percent" yaml:"percent"`
+}
+
+// Subject is who a flag is evaluated for.
+type Subject struct {
+	User   string
+	Tenant string
+	Header http.Header
+}
+
+// attribute returns the value of a rule attribute for s.
+func (s Subject) attribute(attr string) string {
+	switch attr {
+	case AttrUser:
+		return s.User
+	case AttrTenant:
+		return s.Tenant
+	}
+	if name, ok := strings.CutPrefix(attr, headerAttr); ok && s.Header != nil {
+		return s.Header.Get(name)
+	}
+	return ""
+}
+
+// stickyKey identifies s for rollouts: the user, else the tenant.
+func (s Subject) stickyKey() string {
+	if s.User != "" {
+		return "user:" + s.User
+	}
+	if s.Tenant != "" {
+		return "tenant:" + s.Tenant
+	}
+	return ""
+}
+
+// Reasons an evaluation gives for its variant.
+const (
+	ReasonDisabled = "disabled"
+	ReasonRule     = "rule"
+	ReasonRollout  = "rollout"
+	ReasonDefault  = "default"
+	ReasonUnknown  = "unknown_flag"
+)
+
+// Evaluation is the variant a flag serves a subject, and why.
+type Evaluation struct {
+	Key     string `json:"key"`
+	Variant string `json:"variant"`
+	Reason  string `json:"reason"`
+	// RuleIndex is the matching rule with reason "rule".
+	RuleIndex *int `json:"rule_index,omitempty"`
+	on        bool
+}
+
+// On reports whether the flag serves anything but its off variant.
+func (e Evaluation) On() bool { return e.on }
+
+// Normalize fills in the variants, off variant and default of a flag that
+// leaves them out.
+func (f *Flag) Normalize() {
+	if len(f.Variants) == 0 {
+		f.Variants = []string{On, Off}
+		if f.OffVariant == "" {
+			f.OffVariant = Off
+		}
+		if f.Default == "" {
+			f.Default = On
+		}
+	}
+	if f.OffVariant == "" {
+		f.OffVariant = f.Variants[0]
+	}
+	if f.Default == "" {
+		f.Default = f.Variants[0]
+	}
+}
+
+// FieldError is a problem with one field of a flag.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string { return e.Field + ": " + e.Message }
+
+var keyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// Validate checks a normalized flag.
+func (f *Flag) Validate() error {
+	if !keyPattern.MatchString(f.Key) {
+		return &FieldError{"key", "must be 1-64 lowercase letters, digits, '.', '_' or '-'"}
+	}
+	for i, v := range f.Variants {
+		if v == "" || len(v) > 64 {
+			return &FieldError{fmt.Sprintf("variants[%d]", i), "must be 1-64 characters"}
+		}
+		if slices.Index(f.Variants, v) != i {
+			return &FieldError{fmt.Sprintf("variants[%d]", i), fmt.Sprintf("%q is listed twice", v)}
+		}
+	}
+	if err := f.checkVariant("off_variant", f.OffVariant); err != nil {
+		return err
+	}
+	if err := f.checkVariant("default", f.Default); err != nil {
+		return err
+	}
+	for i, r := range f.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		if r.Attribute != AttrUser && r.Attribute != AttrTenant &&
+			(!strings.HasPrefix(r.Attribute, headerAttr) || len(r.Attribute) == len(headerAttr)) {
+			return &FieldError{field + ".attribute", `must be "user", "tenant" or "header:<Name>"`}
+		}
+		if len(r.Values) == 0 {
+			return &FieldError{field + ".values", "must not be empty"}
+		}
+		if (r.Variant == "") == (len(r.Rollout) == 0) {
+			return &FieldError{field, "needs either a variant or a rollout"}
+		}
+		if r.Variant != "" {
+			if err := f.checkVariant(field+".variant", r.Variant); err != nil {
+				return err
+			}
+		}
+		if err := f.checkRollout(field+".rollout", r.Rollout); err != nil {
+			return err
+		}
+	}
+	return f.checkRollout("rollout", f.Rollout)
+}
+
+func (f *Flag) checkVariant(field, v string) error {
+	if !slices.Contains(f.Variants, v) {
+		return &FieldError{field, fmt.Sprintf("%q is not one of the variants %s", v, strings.Join(f.Variants, ", "))}
+	}
+	return nil
+}
+
+func (f *Flag) checkRollout(field string, splits []Split) error {
+	if len(splits) == 0 {
+		return nil
+	}
+	var total float64
+	for i, s := range splits {
+		if err := f.checkVariant(fmt.Sprintf("%s[%d].variant", field, i), s.Variant); err != nil {
+			return err
+		}
+		if s.Percent < 0 || s.Percent > 100 {
+			return &FieldError{fmt.Sprintf("%s[%d].percent", field, i), "must be between 0 and 100"}
+		}
+		total += s.Percent
+	}
+	if math.Abs(total-100) > 1e-9 {
+		return &FieldError{field, fmt.Sprintf("percentages add up to %g, not 100", total)}
+	}
+	return nil
+}
+
+// Evaluate returns the variant f serves s.
+func (f *Flag) Evaluate(s Subject) Evaluation {
+	e := f.evaluate(s)
+	e.Key = f.Key
+	e.on = e.Variant != f.OffVariant
+	return e
+}
+
+func (f *Flag) evaluate(s Subject) Evaluation {
+	if !f.Enabled {
+		return Evaluation{Variant: f.OffVariant, Reason: ReasonDisabled}
+	}
+	for i, r := range f.Rules {
+		if !slices.Contains(r.Values, s.attribute(r.Attribute)) {
+			continue
+		}
+		variant := r.Variant
+		if variant == "" {
+			variant = f.split(r.Rollout, s)
+		}
+		return Evaluation{Variant: variant, Reason: ReasonRule, RuleIndex: &i}
+	}
+	if len(f.Rollout) > 0 {
+		return Evaluation{Variant: f.split(f.Rollout, s), Reason: ReasonRollout}
+	}
+	return Evaluation{Variant: f.Default, Reason: ReasonDefault}
+}
+
+// split picks a variant for s by hashing its sticky key with the flag key
+// onto [0, 100) and walking the splits in order. A subject keeps its
+// variant between requests, and growing one split only moves subjects out
+// of the splits after it. Subjects without a user or tenant get Default.
+func (f *Flag) split(splits []Split, s Subject) string {
+	key := s.stickyKey()
+	if key == "" {
+		return f.Default
+	}
+	b := bucket(f.Key, key)
+	var upper float64
+	for _, sp := range splits {
+		upper += sp.Percent
+		if b < upper {
+			return sp.Variant
+		}
+	}
+	return splits[len(splits)-1].Variant
+}
+
+// bucket maps a flag and a subject to [0, 100) in steps of 0.001. Salting
+// with the flag key keeps the rollouts of different flags independent.
+func bucket(flagKey, subjectKey string) float64 {
+	sum := sha256.Sum256([]byte(flagKey + "\x00" + subjectKey))
+	return float64(binary.BigEndian.Uint64(sum[:8])%100_000) / 1000
+}
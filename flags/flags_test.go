@@ -0,0 +1,259 @@
+package flags
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/storage"
+)
+
+func TestEvaluate(t *testing.T) {
+	f := Flag{
+		Key:     "new-checkout",
+		Enabled: true,
+		Rules: []Rule{
+			{Attribute: AttrUser, Values: []string{"banned"}, Variant: Off},
+			{Attribute: AttrTenant, Values: []string{"acme"}, Variant: On},
+			{Attribute: "header:X-Beta", Values: []string{"1"}, Variant: On},
+		},
+	}
+	f.Normalize()
+	if err := f.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	beta := http.Header{}
+	beta.Set("X-Beta", "1")
+	tests := []struct {
+		name    string
+		sub     Subject
+		variant string
+		reason  string
+	}{
+		{"first rule wins", Subject{User: "banned", Tenant: "acme"}, Off, ReasonRule},
+		{"tenant rule", Subject{User: "u1", Tenant: "acme"}, On, ReasonRule},
+		{"header rule", Subject{Header: beta}, On, ReasonRule},
+		{"no rule matches", Subject{User: "u1", Tenant: "other"}, On, ReasonDefault},
+	}
+	for _, tt := range tests {
+		e := f.Evaluate(tt.sub)
+		if e.Variant != tt.variant || e.Reason != tt.reason || e.On() != (tt.variant == On) {
+			t.Errorf("%s: %+v, want %s (%s)", tt.name, e, tt.variant, tt.reason)
+		}
+	}
+
+	f.Enabled = false
+	if e := f.Evaluate(Subject{Tenant: "acme"}); e.Variant != Off || e.Reason != ReasonDisabled || e.On() {
+		t.Errorf("disabled flag: %+v", e)
+	}
+}
+
+// share returns the fraction of n users the flag serves variant.
+func share(f *Flag, variant string, n int) float64 {
+	hits := 0
+	for i := 0; i < n; i++ {
+		if f.Evaluate(Subject{User: fmt.Sprint("user-", i)}).Variant == variant {
+			hits++
+		}
+	}
+	return float64(hits) / float64(n)
+}
+
+func TestRollout(t *testing.T) {
+	f := Flag{
+		Key:      "theme",
+		Enabled:  true,
+		Variants: []string{"blue", "green", "red"},
+		Rollout:  []Split{{"green", 20}, {"red", 30}, {"blue", 50}},
+	}
+	f.Normalize()
+	if err := f.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for variant, want := range map[string]float64{"green": .2, "red": .3, "blue": .5} {
+		if got := share(&f, variant, 20000); math.Abs(got-want) > .02 {
+			t.Errorf("%s: %.3f of users, want about %.2f", variant, got, want)
+		}
+	}
+
+	// Sticky: the same user always gets the same variant.
+	first := f.Evaluate(Subject{User: "alice"}).Variant
+	for i := 0; i < 10; i++ {
+		if v := f.Evaluate(Subject{User: "alice"}).Variant; v != first {
+			t.Fatalf("alice got %s, then %s", first, v)
+		}
+	}
+
+	// Anonymous callers get the default.
+	if e := f.Evaluate(Subject{}); e.Variant != "blue" {
+		t.Errorf("anonymous: %+v", e)
+	}
+}
+
+func TestRolloutOnlyGrows(t *testing.T) {
+	at := func(percent float64) *Flag {
+		f := &Flag{Key: "b", Enabled: true, Rollout: []Split{{On, percent}, {Off, 100 - percent}}}
+		f.Normalize()
+		return f
+	}
+	small, large := at(10), at(40)
+	for i := 0; i < 5000; i++ {
+		sub := Subject{User: fmt.Sprint(i)}
+		if small.Evaluate(sub).On() && !large.Evaluate(sub).On() {
+			t.Fatalf("user %d lost the feature when the rollout grew", i)
+		}
+	}
+
+	// Another flag at the same percentage reaches other users.
+	other := at(10)
+	other.Key = "c"
+	same := 0
+	for i := 0; i < 5000; i++ {
+		sub := Subject{User: fmt.Sprint(i)}
+		if small.Evaluate(sub).On() && other.Evaluate(sub).On() {
+			same++
+		}
+	}
+	if same > 100 {
+		t.Errorf("%d of about 500 users have both flags; rollouts are not independent", same)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		field string
+		flag  Flag
+	}{
+		{"key", Flag{Key: "Bad Key"}},
+		{"variants[1]", Flag{Key: "k", Variants: []string{"a", "a"}}},
+		{"default", Flag{Key: "k", Variants: []string{"a", "b"}, Default: "c"}},
+		{"rules[0].attribute", Flag{Key: "k", Rules: []Rule{{Attribute: "email", Values: []string{"x"}, Variant: On}}}},
+		{"rules[0].attribute", Flag{Key: "k", Rules: []Rule{{Attribute: "header:", Values: []string{"x"}, Variant: On}}}},
+		{"rules[0].values", Flag{Key: "k", Rules: []Rule{{Attribute: AttrUser, Variant: On}}}},
+		{"rules[0]", Flag{Key: "k", Rules: []Rule{{Attribute: AttrUser, Values: []string{"x"}}}}},
+		{"rules[0].rollout", Flag{Key: "k", Rules: []Rule{{Attribute: AttrUser, Values: []string{"x"}, Rollout: []Split{{On, 50}}}}}},
+		{"rollout[0].variant", Flag{Key: "k", Rollout: []Split{{"maybe", 100}}}},
+		{"rollout[1].percent", Flag{Key: "k", Rollout: []Split{{On, 100}, {Off, -10}}}},
+	}
+	for _, tt := range tests {
+		tt.flag.Normalize()
+		var fe *FieldError
+		if err := tt.flag.Validate(); !errors.As(err, &fe) || fe.Field != tt.field {
+			t.Errorf("%+v: err = %v, want one for %s", tt.flag, err, tt.field)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	fs, err := Decode([]map[string]any{
+		{"key": "beta", "enabled": true, "rules": []any{
+			map[string]any{"attribute": "tenant", "values": []any{"acme"}, "variant": "on"},
+		}},
+		{"key": "Bad Key"},
+		{"key": "beta"},
+		{"key": "typo", "enabeld": true},
+		{"key": "color", "variants": []any{"red", "blue"}, "rollout": []any{
+			map[string]any{"variant": "red", "percent": int64(30)},
+			map[string]any{"variant": "blue", "percent": 70.0},
+		}},
+	})
+	if len(fs) != 2 || fs[0].Key != "beta" || fs[0].Rules[0].Values[0] != "acme" || fs[1].Default != "red" {
+		t.Errorf("decoded %+v", fs)
+	}
+	var fields []string
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var fe *FieldError
+		if !errors.As(err, &fe) {
+			t.Fatalf("%v is not a FieldError", err)
+		}
+		fields = append(fields, fe.Field)
+	}
+	if want := []string{"flag[1].key", "flag[2].key", "flag[3]"}; fmt.Sprint(fields) != fmt.Sprint(want) {
+		t.Errorf("errors for %v, want %v", fields, want)
+	}
+}
+
+func TestServiceLayers(t *testing.T) {
+	static := []Flag{{Key: "from-config", Enabled: true}}
+	kv := storage.NewMemory()
+	s, err := NewService(kv, func() []Flag { return static })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := s.Evaluate("from-config", Subject{}); !e.On() {
+		t.Errorf("config flag: %+v", e)
+	}
+	if err := s.Delete("from-config"); err != ErrConfigFlag {
+		t.Errorf("Delete(config flag) = %v", err)
+	}
+
+	// An API flag overrides the config flag until it is deleted.
+	f, created, err := s.Put(Flag{Key: "from-config"})
+	if err != nil || !created || f.Source != SourceAPI {
+		t.Fatalf("Put = %+v, %v, %v", f, created, err)
+	}
+	if e := s.Evaluate("from-config", Subject{}); e.On() || e.Reason != ReasonDisabled {
+		t.Errorf("overridden flag: %+v", e)
+	}
+	if _, created, _ := s.Put(Flag{Key: "from-config"}); created {
+		t.Error("replacing reported a new flag")
+	}
+
+	// API flags survive a restart.
+	again, err := NewService(kv, func() []Flag { return static })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := again.Get("from-config"); got.Source != SourceAPI {
+		t.Errorf("after reload: %+v", got)
+	}
+
+	if err := s.Delete("from-config"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get("from-config"); got.Source != SourceConfig || !s.Evaluate("from-config", Subject{}).On() {
+		t.Errorf("after delete: %+v", got)
+	}
+	if err := s.Delete("nope"); err != ErrNotFound {
+		t.Errorf("Delete(unknown) = %v", err)
+	}
+	if e := s.Evaluate("nope", Subject{}); e.On() || e.Reason != ReasonUnknown {
+		t.Errorf("unknown flag: %+v", e)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s, _ := NewService(storage.NewMemory(), func() []Flag {
+		return []Flag{{Key: "beta", Enabled: true, Default: Off, Rules: []Rule{{Attribute: AttrUser, Values: []string{"alice"}, Variant: On}}}}
+	})
+	router := gin.New()
+	router.Use(Middleware(s, func(r *http.Request) Subject { return Subject{User: r.Header.Get("X-User-ID")} }))
+	beta := router.Group("/beta", Guard("beta"))
+	beta.GET("", func(c *gin.Context) { c.String(http.StatusOK, Variant(c, "beta")) })
+	router.GET("/missing", Guard("missing"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, tt := range []struct {
+		path, user string
+		want       int
+	}{
+		{"/beta", "alice", http.StatusOK},
+		{"/beta", "bob", http.StatusNotFound},
+		{"/beta", "", http.StatusNotFound},
+		{"/missing", "alice", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("X-User-ID", tt.user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s as %q: status %d, want %d", tt.path, tt.user, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package flags
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+	"tutorial/routes"
+)
+
+// Handler serves flag management and evaluation.
+type Handler struct {
+	s *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{s: s}
+}
+
+type flagURI struct {
+	Key string `uri:"key" binding:"required,max=64"`
+}
+
+type flagRequest struct {
+	Description string   `json:"description" binding:"max=500"`
+	Enabled     bool     `json:"enabled"`
+	Variants    []string `json:"variants" binding:"max=20"`
+	OffVariant  string   `json:"off_variant"`
+	Rules       []Rule   `json:"rules" binding:"max=50"`
+	Rollout     []Split  `json:"rollout" binding:"max=20"`
+	Default     string   `json:"default"`
+}
+
+// Register mounts the management endpoints on r, typically /flags on the
+// admin listener, documenting them with meta. Callers are responsible for
+// authenticating the group.
+func (h *Handler) Register(r routes.Router, meta routes.Meta) {
+	describe := func(description string) routes.Meta {
+		m := meta
+		m.Description = description
+		return m
+	}
+	r.GET("", describe("Lists the feature flags from the config file and the API."), h.list)
+	r.GET("/:key", describe("Returns a feature flag."), h.get)
+	r.PUT("/:key", describe("Creates or replaces a feature flag; it overrides a config flag of the same key."), h.put)
+	r.DELETE("/:key", describe("Deletes a feature flag set through the API."), h.delete)
+	r.GET("/:key/evaluate", describe("Evaluates a flag for ?user, ?tenant and the request headers."), h.evaluate)
+}
+
+// RegisterEvaluations mounts the endpoint callers read their own flags
+// from, typically /api/flags. It needs Middleware to have run.
+func (h *Handler) RegisterEvaluations(r routes.Router) {
+	r.GET("", routes.Meta{Description: "Variants of every feature flag for the caller.", Auth: "none", Owner: "platform"}, func(c *gin.Context) {
+		all := All(c)
+		if all == nil {
+			all = map[string]Evaluation{}
+		}
+		c.JSON(http.StatusOK, all)
+	})
+}
+
+func (h *Handler) list(c *gin.Context) {
+	c.JSON(http.StatusOK, h.s.List())
+}
+
+func (h *Handler) get(c *gin.Context) {
+	var uri flagURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	f, err := h.s.Get(uri.Key)
+	if err != nil {
+		c.Error(flagError(err))
+		return
+	}
+	c.JSON(http.StatusOK, f)
+}
+
+func (h *Handler) put(c *gin.Context) {
+	var uri flagURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	var req flagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	f, created, err := h.s.Put(Flag{
+		Key:         uri.Key,
+		Description: req.Description,
+		Enabled:     req.Enabled,
+		Variants:    req.Variants,
+		OffVariant:  req.OffVariant,
+		Rules:       req.Rules,
+		Rollout:     req.Rollout,
+		Default:     req.Default,
+	})
+	if err != nil {
+		c.Error(flagError(err))
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		c.Header("Location", c.Request.URL.Path)
+	}
+	c.JSON(status, f)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	var uri flagURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	if err := h.s.Delete(uri.Key); err != nil {
+		c.Error(flagError(err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) evaluate(c *gin.Context) {
+	var uri flagURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	f, err := h.s.Get(uri.Key)
+	if err != nil {
+		c.Error(flagError(err))
+		return
+	}
+	c.JSON(http.StatusOK, f.Evaluate(Subject{
+		User:   c.Query("user"),
+		Tenant: c.Query("tenant"),
+		Header: c.Request.Header,
+	}))
+}
+
+// flagError maps service errors to problems; anything else becomes a 500.
+func flagError(err error) error {
+	var fe *FieldError
+	switch {
+	case errors.As(err, &fe):
+		e := problem.New(http.StatusUnprocessableEntity, "validation_failed", "The request has invalid fields.")
+		e.Fields = []problem.FieldError{{Field: fe.Field, Message: fe.Message}}
+		return e
+	case errors.Is(err, ErrNotFound):
+		return problem.NotFound("flag_not_found", "There is no such feature flag.")
+	case errors.Is(err, ErrConfigFlag):
+		return problem.Conflict("flag_in_config", "The flag is defined in the config file; remove it there.")
+	}
+	return err
+}
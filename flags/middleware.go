@@ -0,0 +1,62 @@
+package flags
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+)
+
+// Key is the gin.Context key holding the caller's flag evaluations.
+const Key = "flags"
+
+// Middleware evaluates every flag for the caller, as identified by subject,
+// and stores the evaluations in the gin.Context for Get, Variant and Guard.
+func Middleware(s *Service, subject func(*http.Request) Subject) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(Key, s.EvaluateAll(subject(c.Request)))
+		c.Next()
+	}
+}
+
+// All returns the evaluations stored by Middleware, or nil outside it.
+func All(c *gin.Context) map[string]Evaluation {
+	v, _ := c.Get(Key)
+	all, _ := v.(map[string]Evaluation)
+	return all
+}
+
+// Get returns the evaluation of flag key for the caller. Unknown flags, and
+// every flag outside Middleware, are off.
+func Get(c *gin.Context, key string) Evaluation {
+	e, ok := All(c)[key]
+	if !ok {
+		return Evaluation{Key: key, Reason: ReasonUnknown}
+	}
+	return e
+}
+
+// Variant returns the variant flag key serves the caller, or "".
+func Variant(c *gin.Context, key string) string {
+	return Get(c, key).Variant
+}
+
+// IsOn reports whether flag key serves the caller anything but its off
+// variant.
+func IsOn(c *gin.Context, key string) bool {
+	return Get(c, key).On()
+}
+
+// Guard hides the routes behind it while flag key is off for the caller:
+// they answer 404 as if they did not exist. It needs Middleware to have run.
+func Guard(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsOn(c, key) {
+			problem.NoRoute(c)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,167 @@
+package flags
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"tutorial/storage"
+)
+
+var (
+	ErrNotFound   = errors.New("flag not found")
+	ErrConfigFlag = errors.New("flag is defined in the config file")
+)
+
+// Where a flag is defined.
+const (
+	SourceConfig = "config"
+	SourceAPI    = "api"
+)
+
+const keyPrefix = "flags/"
+
+// Service holds the flags from two layers: those defined in the config
+// file, re-read on every call so a reload applies at once, and those
+// managed through the API, kept in a storage.KV. An API flag takes
+// precedence over a config flag with the same key, so a flag shipped in
+// the config can be changed at runtime and deleting the change restores
+// it.
+type Service struct {
+	kv     storage.KV
+	static func() []Flag
+
+	mu     sync.RWMutex
+	stored map[string]Flag
+}
+
+// NewService loads the API flags from kv. static returns the flags of the
+// current configuration.
+func NewService(kv storage.KV, static func() []Flag) (*Service, error) {
+	s := &Service{kv: kv, static: static, stored: map[string]Flag{}}
+	var err error
+	scanErr := kv.Scan(keyPrefix, func(_ string, v []byte) bool {
+		var f Flag
+		if err = json.Unmarshal(v, &f); err != nil {
+			return false
+		}
+		s.stored[f.Key] = f
+		return true
+	})
+	if err := errors.Join(scanErr, err); err != nil {
+		return nil, fmt.Errorf("load flags: %w", err)
+	}
+	return s, nil
+}
+
+// flags returns every flag in effect, by key.
+func (s *Service) flags() map[string]Flag {
+	out := map[string]Flag{}
+	for _, f := range s.static() {
+		f.Normalize()
+		f.Source = SourceConfig
+		out[f.Key] = f
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for k, f := range s.stored {
+		out[k] = f
+	}
+	return out
+}
+
+// List returns every flag in effect, sorted by key.
+func (s *Service) List() []Flag {
+	all := s.flags()
+	out := make([]Flag, 0, len(all))
+	for _, f := range all {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// Get returns the flag in effect for key.
+func (s *Service) Get(key string) (Flag, error) {
+	s.mu.RLock()
+	f, ok := s.stored[key]
+	s.mu.RUnlock()
+	if ok {
+		return f, nil
+	}
+	for _, f := range s.static() {
+		if f.Key == key {
+			f.Normalize()
+			f.Source = SourceConfig
+			return f, nil
+		}
+	}
+	return Flag{}, ErrNotFound
+}
+
+// Put creates or replaces the API flag f.Key and reports whether it is new.
+// The error is a *FieldError if f is invalid.
+func (s *Service) Put(f Flag) (Flag, bool, error) {
+	f.Normalize()
+	if err := f.Validate(); err != nil {
+		return Flag{}, false, err
+	}
+	now := time.Now().UTC()
+	f.Source, f.Updated = SourceAPI, &now
+	b, err := json.Marshal(f)
+	if err != nil {
+		return Flag{}, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, existed := s.stored[f.Key]
+	if err := s.kv.Put(keyPrefix+f.Key, b); err != nil {
+		return Flag{}, false, err
+	}
+	s.stored[f.Key] = f
+	return f, !existed, nil
+}
+
+// Delete removes the API flag key. A config flag of the same key takes
+// effect again; one that is only in the config cannot be deleted.
+func (s *Service) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.stored[key]; !ok {
+		for _, f := range s.static() {
+			if f.Key == key {
+				return ErrConfigFlag
+			}
+		}
+		return ErrNotFound
+	}
+	if err := s.kv.Delete(keyPrefix + key); err != nil {
+		return err
+	}
+	delete(s.stored, key)
+	return nil
+}
+
+// Evaluate returns the variant flag key serves sub. An unknown flag serves
+// the empty variant and is off.
+func (s *Service) Evaluate(key string, sub Subject) Evaluation {
+	f, err := s.Get(key)
+	if err != nil {
+		return Evaluation{Key: key, Reason: ReasonUnknown}
+	}
+	return f.Evaluate(sub)
+}
+
+// EvaluateAll evaluates every flag for sub.
+func (s *Service) EvaluateAll(sub Subject) map[string]Evaluation {
+	all := s.flags()
+	out := make(map[string]Evaluation, len(all))
+	for k, f := range all {
+		out[k] = f.Evaluate(sub)
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tutorial/flags"
+)
+
+func TestFlags(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "flags.toml")
+	os.WriteFile(file, []byte(`
+[[flags.flag]]
+  key = 'new-checkout'
+  enabled = true
+  default = 'off'
+  rules = [{attribute = 'tenant', values = ['acme'], variant = 'on'}]
+`), 0o600)
+	a, public := newTestApp(t, "-config="+file, "-admin.token=s3cret")
+	admin := a.setupAdminRouter(public)
+
+	serve := func(router http.Handler, method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	mine := func(header ...string) map[string]flags.Evaluation {
+		w := serve(public, "GET", "/api/flags", "", header...)
+		if w.Code != http.StatusOK {
+			t.Fatalf("evaluations: status %d; body: %s", w.Code, w.Body)
+		}
+		var got map[string]flags.Evaluation
+		json.Unmarshal(w.Body.Bytes(), &got)
+		return got
+	}
+	const auth = "Authorization"
+
+	if got := mine("X-Tenant-ID", "acme")["new-checkout"]; got.Variant != "on" || got.Reason != "rule" {
+		t.Errorf("config flag for acme: %+v", got)
+	}
+	if got := mine("X-Tenant-ID", "globex")["new-checkout"]; got.Variant != "off" {
+		t.Errorf("config flag for globex: %+v", got)
+	}
+
+	if w := serve(admin, "PUT", "/flags/theme", `{"enabled":true}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("put without token: status %d", w.Code)
+	}
+	w := serve(admin, "PUT", "/flags/theme", `{"enabled":true,"variants":["blue","green"],"rollout":[{"variant":"green","percent":100}]}`, auth, "Bearer s3cret")
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/flags/theme" {
+		t.Fatalf("create: status %d, Location %q; body: %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	if got := mine("X-User-ID", "u1")["theme"]; got.Variant != "green" || got.Reason != "rollout" {
+		t.Errorf("theme for u1: %+v", got)
+	}
+
+	w = serve(admin, "PUT", "/flags/theme", `{"enabled":true,"variants":["blue"],"default":"red"}`, auth, "Bearer s3cret")
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"field":"default"`) {
+		t.Errorf("invalid flag: status %d; body: %s", w.Code, w.Body)
+	}
+	if w := serve(admin, "DELETE", "/flags/new-checkout", "", auth, "Bearer s3cret"); w.Code != http.StatusConflict {
+		t.Errorf("delete config flag: status %d", w.Code)
+	}
+	w = serve(admin, "GET", "/flags/new-checkout/evaluate?tenant=acme", "", auth, "Bearer s3cret")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"variant":"on"`) {
+		t.Errorf("evaluate: status %d; body: %s", w.Code, w.Body)
+	}
+	if w := serve(admin, "DELETE", "/flags/theme", "", auth, "Bearer s3cret"); w.Code != http.StatusNoContent {
+		t.Errorf("delete: status %d", w.Code)
+	}
+	if w := serve(admin, "GET", "/flags/theme", "", auth, "Bearer s3cret"); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted flag: status %d", w.Code)
+	}
+}
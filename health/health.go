@@ -0,0 +1,188 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultTimeout = 2 * time.Second
+
+// Check is a named dependency check. A failing critical check makes the
+// service unready; a failing non-critical one only degrades it.
+type Check struct {
+	Name     string
+	Critical bool
+	Timeout  time.Duration // defaults to 2s
+	Fn       func(ctx context.Context) error
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of all checks. Status is ok, degraded or failing.
+type Report struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []Result  `json:"checks"`
+}
+
+// Registry runs the registered checks, caching the report for a short while
+// so frequent probes do not hammer dependencies.
+type Registry struct {
+	ttl          time.Duration
+	shuttingDown atomic.Bool
+
+	mu     sync.Mutex
+	checks []Check
+	cached *Report
+}
+
+func NewRegistry(ttl time.Duration) *Registry {
+	return &Registry{ttl: ttl}
+}
+
+func (r *Registry) Register(c Check) {
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, c)
+	r.cached = nil
+}
+
+// Shutdown marks the service as going away; readiness fails from now on.
+func (r *Registry) Shutdown() {
+	r.shuttingDown.Store(true)
+}
+
+// Report runs the checks concurrently, or returns the cached report if it is
+// fresh enough.
+//
+// The lock is not held while checks run, so a slow dependency does not hold
+// up Register or callers that only need the cached report.
+func (r *Registry) Report(ctx context.Context) Report {
+	r.mu.Lock()
+	if r.cached != nil && time.Since(r.cached.CheckedAt) < r.ttl {
+		rep := *r.cached
+		r.mu.Unlock()
+		return rep
+	}
+	checks := r.checks
+	r.mu.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			results[i] = run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	rep := Report{Status: "ok", CheckedAt: time.Now(), Checks: results}
+	for _, res := range results {
+		if res.Status == "ok" {
+			continue
+		}
+		if res.Critical {
+			rep.Status = "failing"
+			break
+		}
+		rep.Status = "degraded"
+	}
+
+	r.mu.Lock()
+	// Keep the newer report should another caller have finished later, and
+	// none if checks were registered meanwhile.
+	if len(r.checks) == len(checks) && (r.cached == nil || r.cached.CheckedAt.Before(rep.CheckedAt)) {
+		r.cached = &rep
+	}
+	r.mu.Unlock()
+	return rep
+}
+
+func run(ctx context.Context, c Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				errc <- panicError{p}
+			}
+		}()
+		errc <- c.Fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := Result{Name: c.Name, Status: "ok", Critical: c.Critical}
+	res.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		res.Status = "failing"
+		res.Error = err.Error()
+	}
+	return res
+}
+
+type panicError struct{ v any }
+
+func (p panicError) Error() string { return fmt.Sprintf("check panicked: %v", p.v) }
+
+// Livez reports that the process is up and serving requests.
+func (r *Registry) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz fails once shutdown has begun or a critical check fails.
+func (r *Registry) Readyz(c *gin.Context) {
+	if r.shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+		return
+	}
+	r.respond(c, r.Report(c.Request.Context()))
+}
+
+// Healthz reports the state of every check. Add ?verbose to get the per-check
+// report.
+func (r *Registry) Healthz(c *gin.Context) {
+	rep := r.Report(c.Request.Context())
+	if r.shuttingDown.Load() {
+		rep.Status = "shutting_down"
+	}
+	r.respond(c, rep)
+}
+
+func (r *Registry) respond(c *gin.Context, rep Report) {
+	status := http.StatusOK
+	if rep.Status == "failing" || rep.Status == "shutting_down" {
+		status = http.StatusServiceUnavailable
+	}
+	if _, verbose := c.GetQuery("verbose"); verbose {
+		c.JSON(status, rep)
+		return
+	}
+	c.JSON(status, gin.H{"status": rep.Status})
+}
@@ -0,0 +1,67 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReportStatus(t *testing.T) {
+	fail := func(context.Context) error { return errors.New("down") }
+	ok := func(context.Context) error { return nil }
+	tests := []struct {
+		name   string
+		checks []Check
+		want   string
+	}{
+		{"all ok", []Check{{Name: "a", Critical: true, Fn: ok}, {Name: "b", Fn: ok}}, "ok"},
+		{"non-critical fails", []Check{{Name: "a", Critical: true, Fn: ok}, {Name: "b", Fn: fail}}, "degraded"},
+		{"critical fails", []Check{{Name: "a", Critical: true, Fn: fail}, {Name: "b", Fn: ok}}, "failing"},
+		{"panic", []Check{{Name: "a", Critical: true, Fn: func(context.Context) error { panic("boom") }}}, "failing"},
+		{"timeout", []Check{{Name: "a", Critical: true, Timeout: 10 * time.Millisecond, Fn: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}}, "failing"},
+	}
+	for _, tt := range tests {
+		r := NewRegistry(0)
+		for _, c := range tt.checks {
+			r.Register(c)
+		}
+		if rep := r.Report(context.Background()); rep.Status != tt.want {
+			t.Errorf("%s: status %s, want %s; %+v", tt.name, rep.Status, tt.want, rep.Checks)
+		}
+	}
+}
+
+func TestReportDoesNotBlockOnSlowChecks(t *testing.T) {
+	r := NewRegistry(time.Minute)
+	started, release := make(chan struct{}), make(chan struct{})
+	r.Register(Check{Name: "slow", Fn: func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}})
+	done := make(chan Report)
+	go func() { done <- r.Report(context.Background()) }()
+	<-started
+
+	registered := make(chan struct{})
+	go func() {
+		r.Register(Check{Name: "fast", Fn: func(context.Context) error { return nil }})
+		close(registered)
+	}()
+	select {
+	case <-registered:
+	case <-time.After(time.Second):
+		t.Fatal("Register waited for a running check")
+	}
+	close(release)
+	<-done
+
+	// The report from before Register is not cached; the next one has both.
+	if rep := r.Report(context.Background()); len(rep.Checks) != 2 {
+		t.Errorf("checks = %+v, want slow and fast", rep.Checks)
+	}
+}
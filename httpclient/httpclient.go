@@ -0,0 +1,59 @@
+package httpclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"tutorial/requestid"
+	"tutorial/tracing"
+)
+
+// New returns the client the application uses for outbound calls. Requests
+// made with a context derived from an incoming request carry its request ID
+// and continue its trace.
+func New(timeout time.Duration, tracer *tracing.Tracer) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: tracing.Transport(tracer, requestid.Transport(http.DefaultTransport)),
+	}
+}
+
+// Public is like New for calls to URLs that users supply, such as webhook
+// endpoints: it refuses to connect to loopback, private, link-local and other
+// non-public addresses. The check runs on the address actually dialled, after
+// DNS resolution and on every redirect, so a name resolving to 127.0.0.1 is
+// refused as well. Proxies from the environment are not used, as the proxy
+// would be the one dialled.
+func Public(timeout time.Duration, tracer *tracing.Tracer) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   refuseNonPublic,
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: tracing.Transport(tracer, requestid.Transport(t)),
+	}
+}
+
+// sharedAddress is 100.64.0.0/10, carrier-grade NAT space.
+var sharedAddress = netip.MustParsePrefix("100.64.0.0/10")
+
+func refuseNonPublic(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	ip := ap.Addr().Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || sharedAddress.Contains(ip) {
+		return fmt.Errorf("httpclient: refusing to connect to non-public address %s", ip)
+	}
+	return nil
+}
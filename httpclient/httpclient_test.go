@@ -0,0 +1,133 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/requestid"
+	"tutorial/tracing"
+)
+
+func TestPropagation(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	spans := tracing.NewRing(10)
+	tracer := tracing.NewTracer(spans)
+	client := New(5*time.Second, tracer)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(requestid.Middleware(), tracing.Middleware(tracer))
+	router.GET("/proxy", func(c *gin.Context) {
+		req, _ := http.NewRequestWithContext(c.Request.Context(), "GET", upstream.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			c.AbortWithError(http.StatusBadGateway, err)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		c.Status(http.StatusNoContent)
+	})
+
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest("GET", "/proxy", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	req.Header.Set(requestid.Header, "req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status %d; body: %s", w.Code, w.Body)
+	}
+
+	// The server span ends after the client span it contains.
+	finished := spans.Spans()
+	if len(finished) != 2 || finished[0].Kind != tracing.KindClient || finished[1].Kind != tracing.KindServer {
+		t.Fatalf("spans = %+v, want a client span inside a server span", finished)
+	}
+	clientSpan, serverSpan := finished[0], finished[1]
+	if serverSpan.SpanContext.TraceID.String() != traceID || serverSpan.Parent.String() != parentID {
+		t.Errorf("server span continues %s/%s, want %s/%s", serverSpan.SpanContext.TraceID, serverSpan.Parent, traceID, parentID)
+	}
+	if clientSpan.Parent != serverSpan.SpanContext.SpanID {
+		t.Errorf("client span parent %s, want the server span %s", clientSpan.Parent, serverSpan.SpanContext.SpanID)
+	}
+
+	sc, err := tracing.ParseTraceparent(got.Get("traceparent"))
+	if err != nil {
+		t.Fatalf("upstream traceparent %q: %v", got.Get("traceparent"), err)
+	}
+	if sc.TraceID.String() != traceID {
+		t.Errorf("upstream trace-id %s, want %s", sc.TraceID, traceID)
+	}
+	if sc.SpanID != clientSpan.SpanContext.SpanID {
+		t.Errorf("upstream parent-id %s, want the client span %s", sc.SpanID, clientSpan.SpanContext.SpanID)
+	}
+	if !sc.Sampled() {
+		t.Error("upstream traceparent is not sampled")
+	}
+	if id := got.Get(requestid.Header); id != "req-1" {
+		t.Errorf("upstream request ID %q, want req-1", id)
+	}
+}
+
+func TestNoSpanNoHeader(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	resp, err := New(5*time.Second, tracing.NewTracer(nil)).Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if tp := got.Get("traceparent"); tp != "" {
+		t.Errorf("traceparent %q sent outside any request", tp)
+	}
+}
+
+func TestPublicRefusesLocalAddresses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback server")
+	}))
+	defer upstream.Close()
+
+	if _, err := Public(5*time.Second, tracing.NewTracer(nil)).Get(upstream.URL); err == nil {
+		t.Fatal("Public client connected to a loopback address")
+	}
+
+	for addr, public := range map[string]bool{
+		"93.184.216.34:443":         true,
+		"[2606:4700::1111]:443":     true,
+		"127.0.0.1:80":              false,
+		"[::1]:80":                  false,
+		"10.1.2.3:80":               false,
+		"172.16.0.1:80":             false,
+		"192.168.1.1:80":            false,
+		"169.254.169.254:80":        false,
+		"100.64.0.1:80":             false,
+		"0.0.0.0:80":                false,
+		"[fc00::1]:80":              false,
+		"[fe80::1]:80":              false,
+		"[::ffff:127.0.0.1]:80":     false,
+		"[::ffff:93.184.216.34]:80": true,
+	} {
+		if err := refuseNonPublic("tcp", addr, nil); (err == nil) != public {
+			t.Errorf("%s: err = %v, want public %v", addr, err, public)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+	"tutorial/routes"
+)
+
+// Handler serves the jobs API.
+type Handler struct {
+	q *Queue
+}
+
+func NewHandler(q *Queue) *Handler {
+	return &Handler{q: q}
+}
+
+type createRequest struct {
+	Type    string          `json:"type" binding:"required,max=64"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type idURI struct {
+	ID string `uri:"id" binding:"required,max=64,alphanum"`
+}
+
+type listQuery struct {
+	State State `form:"state" binding:"omitempty,oneof=queued running retrying succeeded cancelled dead"`
+}
+
+// created is the answer to POST: the job and where to poll it.
+type created struct {
+	Job
+	StatusURL string `json:"status_url"`
+}
+
+// Register mounts the endpoints on r, typically /api/jobs.
+func (h *Handler) Register(r routes.Router) {
+	meta := func(description string) routes.Meta {
+		return routes.Meta{Description: description, Auth: "none", Owner: "platform"}
+	}
+	r.POST("", meta("Queues a background job; answers 202 with its status URL."), h.create)
+	r.GET("", meta("Lists jobs; ?state= filters, e.g. state=dead for dead letters."), h.list)
+	r.GET("/:id", meta("Returns a job's state, progress and result."), h.get)
+	r.DELETE("/:id", meta("Cancels a job that has not finished."), h.cancel)
+	r.POST("/:id/retry", meta("Queues a dead or cancelled job again."), h.retry)
+}
+
+func (h *Handler) create(c *gin.Context) {
+	var req createRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	// Only the request's values are handed over; the job outlives c.
+	j, err := h.q.Enqueue(c.Request.Context(), req.Type, req.Payload)
+	if err != nil {
+		c.Error(h.queueError(err, ""))
+		return
+	}
+	url := c.FullPath() + "/" + j.ID
+	c.Header("Location", url)
+	c.JSON(http.StatusAccepted, created{Job: j, StatusURL: url})
+}
+
+func (h *Handler) list(c *gin.Context) {
+	var q listQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	c.JSON(http.StatusOK, h.q.List(q.State))
+}
+
+func (h *Handler) get(c *gin.Context) {
+	var uri idURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	j, err := h.q.Get(uri.ID)
+	if err != nil {
+		c.Error(h.queueError(err, uri.ID))
+		return
+	}
+	c.JSON(http.StatusOK, j)
+}
+
+func (h *Handler) cancel(c *gin.Context) {
+	var uri idURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	j, err := h.q.Cancel(uri.ID)
+	if err != nil {
+		c.Error(h.queueError(err, uri.ID))
+		return
+	}
+	if j.State == Running {
+		// Cancellation is under way; the job ends once it notices.
+		c.JSON(http.StatusAccepted, j)
+		return
+	}
+	c.JSON(http.StatusOK, j)
+}
+
+func (h *Handler) retry(c *gin.Context) {
+	var uri idURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	j, err := h.q.Retry(uri.ID)
+	if err != nil {
+		c.Error(h.queueError(err, uri.ID))
+		return
+	}
+	c.JSON(http.StatusAccepted, j)
+}
+
+// queueError maps queue errors to problems; anything else becomes a 500.
+func (h *Handler) queueError(err error, id string) error {
+	var perr *PayloadError
+	switch {
+	case errors.As(err, &perr):
+		return problem.FromBinding(perr.Err)
+	case errors.Is(err, ErrUnknownType):
+		return problem.New(http.StatusUnprocessableEntity, "unknown_job_type", "Known job types: "+strings.Join(h.q.Types(), ", ")+".")
+	case errors.Is(err, ErrNotFound):
+		return problem.NotFound("job_not_found", "There is no job with id "+id+".")
+	case errors.Is(err, ErrFinished):
+		return problem.Conflict("job_finished", "Job "+id+" has already finished.")
+	case errors.Is(err, ErrNotRetryable):
+		return problem.Conflict("job_not_retryable", "Only dead or cancelled jobs can be retried.")
+	case errors.Is(err, ErrFull):
+		return problem.New(http.StatusServiceUnavailable, "queue_full", "Too many jobs are waiting; try again later.")
+	case errors.Is(err, ErrClosed):
+		return problem.New(http.StatusServiceUnavailable, "shutting_down", "The server is shutting down.")
+	}
+	return err
+}
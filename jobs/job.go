@@ -0,0 +1,139 @@
+// Package jobs runs work in the background, outside the request that asked
+// for it, with retries, dead-lettering and cancellation.
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+type State string
+
+const (
+	Queued    State = "queued"
+	Running   State = "running"
+	Retrying  State = "retrying" // failed, waiting for its next attempt
+	Succeeded State = "succeeded"
+	Cancelled State = "cancelled"
+	Dead      State = "dead" // failed every attempt, or permanently
+)
+
+// Finished reports whether a job in state s will not run again on its own.
+func (s State) Finished() bool {
+	return s == Succeeded || s == Cancelled || s == Dead
+}
+
+// Job is one unit of background work and everything known about its runs.
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	State       State           `json:"state"`
+	Progress    int             `json:"progress"` // percent of the current run
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	// CancelRequested is set while a running job is being cancelled.
+	CancelRequested bool       `json:"cancel_requested,omitempty"`
+	RequestID       string     `json:"request_id,omitempty"`
+	Created         time.Time  `json:"created"`
+	Updated         time.Time  `json:"updated"`
+	NextRun         *time.Time `json:"next_run,omitempty"`
+}
+
+// Func does the work of one job type. It must return promptly once ctx is
+// done; ctx carries the request ID of the request that enqueued the job.
+type Func[T any] func(ctx context.Context, t *Task, args T) (any, error)
+
+// Task is what a running job knows of itself.
+type Task struct {
+	ID      string
+	Attempt int // 1 on the first run
+	q       *Queue
+}
+
+// Progress reports that done of total steps of the current run are complete.
+func (t *Task) Progress(done, total int) {
+	if total <= 0 {
+		return
+	}
+	t.q.progress(t.ID, min(max(done*100/total, 0), 100))
+}
+
+// PayloadError reports a payload that does not fit its job type.
+type PayloadError struct {
+	Err error
+}
+
+func (e *PayloadError) Error() string { return "invalid job payload: " + e.Err.Error() }
+
+func (e *PayloadError) Unwrap() error { return e.Err }
+
+// Permanent marks err as not worth retrying: the job is dead-lettered at
+// once.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
+// kind is a registered job type with its payload type erased.
+type kind struct {
+	decode func(payload json.RawMessage) (any, error)
+	run    func(ctx context.Context, t *Task, args any) (any, error)
+}
+
+// Register makes jobs of type typ run fn. The JSON payload of such jobs is
+// decoded into T and validated with its binding tags when the job is
+// enqueued, so bad payloads are refused up front. Register must be called
+// before Start.
+func Register[T any](q *Queue, typ string, fn Func[T]) {
+	if _, ok := q.kinds[typ]; ok {
+		panic("jobs: type " + typ + " registered twice")
+	}
+	q.kinds[typ] = kind{
+		decode: func(payload json.RawMessage) (any, error) {
+			var args T
+			dec := json.NewDecoder(bytes.NewReader(payload))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&args); err != nil {
+				return nil, err
+			}
+			if err := binding.Validator.ValidateStruct(&args); err != nil {
+				return nil, err
+			}
+			return args, nil
+		},
+		run: func(ctx context.Context, t *Task, args any) (any, error) {
+			return fn(ctx, t, args.(T))
+		},
+	}
+}
+
+// call runs k, turning a panic into a permanent failure.
+func (k kind) call(ctx context.Context, t *Task, payload json.RawMessage) (result any, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = Permanent(fmt.Errorf("panic: %v", v))
+		}
+	}()
+	args, err := k.decode(payload)
+	if err != nil {
+		return nil, Permanent(&PayloadError{err})
+	}
+	return k.run(ctx, t, args)
+}
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
@@ -0,0 +1,523 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"tutorial/requestid"
+	"tutorial/storage"
+)
+
+var (
+	ErrNotFound     = errors.New("job not found")
+	ErrUnknownType  = errors.New("unknown job type")
+	ErrFull         = errors.New("job queue is full")
+	ErrClosed       = errors.New("job queue is closed")
+	ErrFinished     = errors.New("job already finished")
+	ErrNotRetryable = errors.New("only dead or cancelled jobs can be retried")
+)
+
+// errCancelled and errShutdown tell why a running job's context was
+// cancelled.
+var (
+	errCancelled = errors.New("cancelled")
+	errShutdown  = errors.New("interrupted by shutdown")
+)
+
+// Options tune a Queue.
+type Options struct {
+	Workers int
+	// Size is how many jobs may wait to run, including those waiting for a
+	// retry, before Enqueue fails with ErrFull.
+	Size        int
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles with every
+	// further failure up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout limits one run of a job.
+	Timeout time.Duration
+	// Retention is how long finished jobs are kept.
+	Retention time.Duration
+}
+
+const keyPrefix = "jobs/"
+
+// Queue runs jobs on a pool of workers. Every job is kept in a storage.KV
+// whenever its state changes, so with a durable KV the jobs that were
+// waiting or running when the process stopped run again after a restart.
+type Queue struct {
+	kv    storage.KV
+	opts  Options
+	kinds map[string]kind
+
+	mu      sync.Mutex
+	wake    *sync.Cond
+	jobs    map[string]*Job
+	ready   []string // queued jobs, oldest first
+	pending int      // queued and retrying jobs
+	cancels map[string]context.CancelCauseFunc
+	timers  map[string]*time.Timer
+	closed  bool
+
+	workers sync.WaitGroup
+	stop    chan struct{}
+}
+
+// NewQueue loads the jobs kept in kv. Jobs that had not finished are queued
+// again; they run once Start is called.
+func NewQueue(kv storage.KV, opts Options) (*Queue, error) {
+	q := &Queue{
+		kv:      kv,
+		opts:    opts,
+		kinds:   map[string]kind{},
+		jobs:    map[string]*Job{},
+		cancels: map[string]context.CancelCauseFunc{},
+		timers:  map[string]*time.Timer{},
+		stop:    make(chan struct{}),
+	}
+	q.wake = sync.NewCond(&q.mu)
+
+	var err error
+	scanErr := kv.Scan(keyPrefix, func(_ string, v []byte) bool {
+		j := new(Job)
+		if err = json.Unmarshal(v, j); err != nil {
+			return false
+		}
+		q.jobs[j.ID] = j
+		return true
+	})
+	if err := errors.Join(scanErr, err); err != nil {
+		return nil, fmt.Errorf("load jobs: %w", err)
+	}
+
+	var resumed []*Job
+	for _, j := range q.jobs {
+		if !j.State.Finished() {
+			resumed = append(resumed, j)
+		}
+	}
+	sortJobs(resumed)
+	for _, j := range resumed {
+		if j.State == Running {
+			// The run was cut short; it does not count.
+			j.Attempts--
+		}
+		j.State, j.NextRun, j.CancelRequested = Queued, nil, false
+		q.ready = append(q.ready, j.ID)
+		q.pending++
+		if err := q.save(j); err != nil {
+			return nil, err
+		}
+	}
+	if len(resumed) > 0 {
+		slog.Info("resuming background jobs", "count", len(resumed))
+	}
+	return q, nil
+}
+
+// Start launches the workers.
+func (q *Queue) Start() {
+	for i := 0; i < q.opts.Workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	go q.purgeLoop()
+}
+
+// Enqueue adds a job of type typ. ctx is only read for its request ID,
+// which the job's own context carries so its logs can be correlated; the
+// job does not otherwise depend on the request. In particular, never hand
+// a *gin.Context to a job, or to any goroutine outliving the request,
+// without c.Copy().
+func (q *Queue) Enqueue(ctx context.Context, typ string, payload json.RawMessage) (Job, error) {
+	k, ok := q.kinds[typ]
+	if !ok {
+		return Job{}, ErrUnknownType
+	}
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+	if _, err := k.decode(payload); err != nil {
+		return Job{}, &PayloadError{err}
+	}
+
+	now := time.Now().UTC()
+	j := &Job{
+		ID:          newID(),
+		Type:        typ,
+		Payload:     slices.Clone(payload),
+		State:       Queued,
+		MaxAttempts: q.opts.MaxAttempts,
+		RequestID:   requestid.FromContext(ctx),
+		Created:     now,
+		Updated:     now,
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Job{}, ErrClosed
+	}
+	if q.pending >= q.opts.Size {
+		return Job{}, ErrFull
+	}
+	if err := q.save(j); err != nil {
+		return Job{}, err
+	}
+	q.jobs[j.ID] = j
+	q.pushLocked(j)
+	return *j, nil
+}
+
+// Get returns the job with id.
+func (q *Queue) Get(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return *j, nil
+}
+
+// List returns the jobs in state, or all jobs if state is empty, oldest
+// first.
+func (q *Queue) List(state State) []Job {
+	q.mu.Lock()
+	var js []*Job
+	for _, j := range q.jobs {
+		if state == "" || j.State == state {
+			js = append(js, j)
+		}
+	}
+	sortJobs(js)
+	out := make([]Job, len(js))
+	for i, j := range js {
+		out[i] = *j
+	}
+	q.mu.Unlock()
+	return out
+}
+
+// Cancel stops the job with id. A job that has not started is cancelled at
+// once; a running one has its context cancelled and is marked cancelled
+// when it returns.
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	switch j.State {
+	case Running:
+		j.CancelRequested = true
+		q.cancels[id](errCancelled)
+		return *j, nil
+	case Queued:
+		q.ready = slices.DeleteFunc(q.ready, func(r string) bool { return r == id })
+	case Retrying:
+		// Close has already stopped and dropped the timers.
+		if t, ok := q.timers[id]; ok {
+			t.Stop()
+			delete(q.timers, id)
+		}
+	default:
+		return *j, ErrFinished
+	}
+	q.pending--
+	j.State, j.Error, j.NextRun = Cancelled, errCancelled.Error(), nil
+	return *j, q.save(j)
+}
+
+// Retry queues a dead or cancelled job again with a fresh set of attempts.
+func (q *Queue) Retry(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if j.State != Dead && j.State != Cancelled {
+		return *j, ErrNotRetryable
+	}
+	if q.closed {
+		return *j, ErrClosed
+	}
+	if q.pending >= q.opts.Size {
+		return *j, ErrFull
+	}
+	j.State, j.Attempts, j.MaxAttempts = Queued, 0, q.opts.MaxAttempts
+	j.Error, j.Result, j.Progress = "", nil, 0
+	q.pushLocked(j)
+	return *j, q.save(j)
+}
+
+// Types returns the registered job types, sorted.
+func (q *Queue) Types() []string {
+	out := make([]string, 0, len(q.kinds))
+	for typ := range q.kinds {
+		out = append(out, typ)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Stats counts the jobs in each state.
+func (q *Queue) Stats() map[State]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := map[State]int{}
+	for _, j := range q.jobs {
+		out[j.State]++
+	}
+	return out
+}
+
+// Check fails once the queue is closed or while it is full, that is while
+// Enqueue would fail.
+func (q *Queue) Check(context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch {
+	case q.closed:
+		return ErrClosed
+	case q.pending >= q.opts.Size:
+		return fmt.Errorf("%w: %d jobs waiting", ErrFull, q.pending)
+	}
+	return nil
+}
+
+// Close stops taking jobs and waits for the running ones to finish until
+// ctx is done; then they are cancelled and put back in the queue, not
+// counting the interrupted run. Jobs that did not finish stay in the KV and
+// are logged.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	for id, t := range q.timers {
+		t.Stop()
+		delete(q.timers, id)
+	}
+	q.wake.Broadcast()
+	q.mu.Unlock()
+	close(q.stop)
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		q.mu.Lock()
+		for _, cancel := range q.cancels {
+			cancel(errShutdown)
+		}
+		q.mu.Unlock()
+		<-done
+	}
+
+	var unfinished []string
+	for _, j := range q.List("") {
+		if !j.State.Finished() {
+			unfinished = append(unfinished, j.Type+"/"+j.ID)
+		}
+	}
+	if len(unfinished) > 0 {
+		slog.Warn("background jobs unfinished at shutdown", "count", len(unfinished), "jobs", unfinished)
+	}
+	return nil
+}
+
+func (q *Queue) pushLocked(j *Job) {
+	q.ready = append(q.ready, j.ID)
+	q.pending++
+	q.wake.Signal()
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+	for {
+		q.mu.Lock()
+		for len(q.ready) == 0 && !q.closed {
+			q.wake.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		j := q.jobs[q.ready[0]]
+		q.ready = q.ready[1:]
+		q.pending--
+
+		ctx, cancel := context.WithCancelCause(context.Background())
+		q.cancels[j.ID] = cancel
+		j.State, j.Progress, j.NextRun = Running, 0, nil
+		j.Attempts++
+		if err := q.save(j); err != nil {
+			slog.Error("save job", "id", j.ID, "err", err)
+		}
+		run := *j
+		q.mu.Unlock()
+
+		result, err := q.run(ctx, run)
+		q.finish(j.ID, result, err, context.Cause(ctx))
+		cancel(nil)
+	}
+}
+
+func (q *Queue) run(ctx context.Context, j Job) (any, error) {
+	k, ok := q.kinds[j.Type]
+	if !ok {
+		return nil, Permanent(fmt.Errorf("%w %q", ErrUnknownType, j.Type))
+	}
+	ctx = requestid.NewContext(ctx, j.RequestID)
+	ctx, cancel := context.WithTimeout(ctx, q.opts.Timeout)
+	defer cancel()
+	return k.call(ctx, &Task{ID: j.ID, Attempt: j.Attempts, q: q}, j.Payload)
+}
+
+// finish records the outcome of a run; cause is why its context was
+// cancelled, if it was.
+func (q *Queue) finish(id string, result any, err error, cause error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.cancels, id)
+	j := q.jobs[id]
+	j.CancelRequested = false
+	log := slog.With("job", j.ID, "type", j.Type, "attempt", j.Attempts, "request_id", j.RequestID)
+
+	switch {
+	case err == nil:
+		j.State, j.Error, j.Progress = Succeeded, "", 100
+		if result != nil {
+			if j.Result, err = json.Marshal(result); err != nil {
+				j.State, j.Error = Dead, "encode result: "+err.Error()
+			}
+		}
+	case errors.Is(cause, errShutdown):
+		// Put back for the next start; workers are no longer taking jobs.
+		j.State, j.Error = Queued, cause.Error()
+		j.Attempts--
+	case errors.Is(cause, errCancelled):
+		j.State, j.Error = Cancelled, cause.Error()
+	case isPermanent(err) || j.Attempts >= j.MaxAttempts:
+		j.State, j.Error = Dead, err.Error()
+		log.Warn("job dead-lettered", "err", err)
+	default:
+		j.State, j.Error = Retrying, err.Error()
+		delay := q.backoff(j.Attempts)
+		next := time.Now().UTC().Add(delay)
+		j.NextRun = &next
+		q.pending++
+		if !q.closed {
+			q.timers[id] = time.AfterFunc(delay, func() { q.retry(id) })
+		}
+		log.Info("job failed, retrying", "err", err, "in", delay)
+	}
+	if err := q.save(j); err != nil {
+		log.Error("save job", "err", err)
+	}
+}
+
+func (q *Queue) retry(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.timers[id]; !ok {
+		return // cancelled or closed meanwhile
+	}
+	delete(q.timers, id)
+	j := q.jobs[id]
+	j.State, j.NextRun = Queued, nil
+	q.ready = append(q.ready, id)
+	q.wake.Signal()
+	if err := q.save(j); err != nil {
+		slog.Error("save job", "id", id, "err", err)
+	}
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := q.opts.Backoff
+	for i := 1; i < attempts && d < q.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, q.opts.MaxBackoff)
+}
+
+func (q *Queue) progress(id string, pct int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if j := q.jobs[id]; j != nil && j.State == Running {
+		j.Progress = pct
+	}
+}
+
+func (q *Queue) purgeLoop() {
+	t := time.NewTicker(min(q.opts.Retention, time.Minute))
+	defer t.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case now := <-t.C:
+			q.purge(now)
+		}
+	}
+}
+
+// purge forgets jobs that finished more than Retention ago.
+func (q *Queue) purge(now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for id, j := range q.jobs {
+		if j.State.Finished() && now.Sub(j.Updated) > q.opts.Retention {
+			if err := q.kv.Delete(keyPrefix + id); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				slog.Error("purge job", "id", id, "err", err)
+				return
+			}
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// save writes j to the KV; progress changes alone are not saved.
+func (q *Queue) save(j *Job) error {
+	j.Updated = time.Now().UTC()
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return q.kv.Put(keyPrefix+j.ID, data)
+}
+
+func sortJobs(js []*Job) {
+	sort.Slice(js, func(a, b int) bool {
+		if !js[a].Created.Equal(js[b].Created) {
+			return js[a].Created.Before(js[b].Created)
+		}
+		return js[a].ID < js[b].ID
+	})
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,245 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tutorial/requestid"
+	"tutorial/storage"
+)
+
+func testOptions() Options {
+	return Options{
+		Workers:     2,
+		Size:        10,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  4 * time.Millisecond,
+		Timeout:     time.Second,
+		Retention:   time.Hour,
+	}
+}
+
+type countArgs struct {
+	FailUntil int  `json:"fail_until"`
+	Permanent bool `json:"permanent"`
+	Block     bool `json:"block"`
+	N         int  `json:"n" binding:"max=10"`
+}
+
+// newTestQueue returns a started queue with a "count" job type whose runs
+// are counted in runs.
+func newTestQueue(t *testing.T, kv storage.KV, opts Options) (*Queue, *atomic.Int32) {
+	t.Helper()
+	q, err := NewQueue(kv, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var runs atomic.Int32
+	Register(q, "count", func(ctx context.Context, task *Task, args countArgs) (any, error) {
+		runs.Add(1)
+		task.Progress(1, 2)
+		if args.Block {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		if args.Permanent {
+			return nil, Permanent(errors.New("no point in trying again"))
+		}
+		if task.Attempt <= args.FailUntil {
+			return nil, errors.New("flaky")
+		}
+		return map[string]string{"request_id": requestid.FromContext(ctx)}, nil
+	})
+	q.Start()
+	t.Cleanup(func() { q.Close(context.Background()) })
+	return q, &runs
+}
+
+func enqueue(t *testing.T, q *Queue, payload string) Job {
+	t.Helper()
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	j, err := q.Enqueue(ctx, "count", json.RawMessage(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+// waitFor polls the job until it is in state.
+func waitFor(t *testing.T, q *Queue, id string, state State) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		j, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.State == state {
+			return j
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %s, want %s (error %q)", id, j.State, state, j.Error)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOutcomes(t *testing.T) {
+	tests := []struct {
+		payload  string
+		state    State
+		attempts int
+	}{
+		{`{}`, Succeeded, 1},
+		{`{"fail_until": 2}`, Succeeded, 3},
+		{`{"fail_until": 5}`, Dead, 3},
+		{`{"permanent": true}`, Dead, 1},
+	}
+	for _, tt := range tests {
+		q, _ := newTestQueue(t, storage.NewMemory(), testOptions())
+		j := waitFor(t, q, enqueue(t, q, tt.payload).ID, tt.state)
+		if j.Attempts != tt.attempts {
+			t.Errorf("%s: %d attempts, want %d", tt.payload, j.Attempts, tt.attempts)
+		}
+		if tt.state == Succeeded && (j.Progress != 100 || string(j.Result) != `{"request_id":"req-1"}`) {
+			t.Errorf("%s: progress %d, result %s", tt.payload, j.Progress, j.Result)
+		}
+		if tt.state == Dead && j.Error == "" {
+			t.Errorf("%s: dead without an error", tt.payload)
+		}
+	}
+}
+
+func TestEnqueueErrors(t *testing.T) {
+	opts := testOptions()
+	opts.Workers, opts.Size = 0, 1 // nothing runs, so the queue fills up
+	q, _ := newTestQueue(t, storage.NewMemory(), opts)
+
+	var perr *PayloadError
+	if _, err := q.Enqueue(context.Background(), "count", json.RawMessage(`{"n": 11}`)); !errors.As(err, &perr) {
+		t.Errorf("invalid payload: err = %v", err)
+	}
+	if _, err := q.Enqueue(context.Background(), "count", json.RawMessage(`{"bogus": 1}`)); !errors.As(err, &perr) {
+		t.Errorf("unknown field: err = %v", err)
+	}
+	if _, err := q.Enqueue(context.Background(), "nope", nil); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("unknown type: err = %v", err)
+	}
+	enqueue(t, q, `{}`)
+	if _, err := q.Enqueue(context.Background(), "count", nil); !errors.Is(err, ErrFull) {
+		t.Errorf("full queue: err = %v", err)
+	}
+}
+
+func TestCancelAndRetry(t *testing.T) {
+	q, runs := newTestQueue(t, storage.NewMemory(), testOptions())
+
+	running := enqueue(t, q, `{"block": true}`)
+	waitFor(t, q, running.ID, Running)
+	j, err := q.Cancel(running.ID)
+	if err != nil || !j.CancelRequested {
+		t.Fatalf("Cancel = %+v, %v", j, err)
+	}
+	waitFor(t, q, running.ID, Cancelled)
+	if _, err := q.Cancel(running.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("second Cancel: err = %v", err)
+	}
+
+	if _, err := q.Retry(running.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, q, running.ID, Running)
+	q.Cancel(running.ID)
+	waitFor(t, q, running.ID, Cancelled)
+	if n := runs.Load(); n != 2 {
+		t.Errorf("%d runs, want 2", n)
+	}
+}
+
+func TestCancelQueued(t *testing.T) {
+	opts := testOptions()
+	opts.Workers = 0
+	q, runs := newTestQueue(t, storage.NewMemory(), opts)
+	j := enqueue(t, q, `{}`)
+	if j, err := q.Cancel(j.ID); err != nil || j.State != Cancelled {
+		t.Fatalf("Cancel = %+v, %v", j, err)
+	}
+	if got := q.List(Cancelled); len(got) != 1 {
+		t.Errorf("List(cancelled) = %v", got)
+	}
+	if runs.Load() != 0 {
+		t.Error("a cancelled job ran")
+	}
+}
+
+func TestCancelRetryingAfterClose(t *testing.T) {
+	opts := testOptions()
+	opts.Backoff, opts.MaxBackoff = time.Hour, time.Hour
+	q, _ := newTestQueue(t, storage.NewMemory(), opts)
+	j := waitFor(t, q, enqueue(t, q, `{"fail_until": 1}`).ID, Retrying)
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if j, err := q.Cancel(j.ID); err != nil || j.State != Cancelled {
+		t.Fatalf("Cancel = %+v, %v", j, err)
+	}
+}
+
+func TestShutdownKeepsUnfinishedJobs(t *testing.T) {
+	kv := storage.NewMemory()
+	q, _ := newTestQueue(t, kv, testOptions())
+	blocked := enqueue(t, q, `{"block": true}`)
+	waitFor(t, q, blocked.ID, Running)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	q.Close(ctx)
+	if j, _ := q.Get(blocked.ID); j.State != Queued || j.Attempts != 0 {
+		t.Fatalf("after shutdown the job is %s after %d attempts, want queued and 0", j.State, j.Attempts)
+	}
+	if _, err := q.Enqueue(context.Background(), "count", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Enqueue after Close: err = %v", err)
+	}
+
+	// A queue started on the same KV, as after a restart, runs it again.
+	again, runs := newTestQueue(t, kv, testOptions())
+	waitFor(t, again, blocked.ID, Running)
+	again.Cancel(blocked.ID)
+	waitFor(t, again, blocked.ID, Cancelled)
+	if runs.Load() != 1 {
+		t.Errorf("%d runs after restart, want 1", runs.Load())
+	}
+}
+
+func TestPurge(t *testing.T) {
+	kv := storage.NewMemory()
+	q, _ := newTestQueue(t, kv, testOptions())
+	j := waitFor(t, q, enqueue(t, q, `{}`).ID, Succeeded)
+
+	q.purge(time.Now())
+	if _, err := q.Get(j.ID); err != nil {
+		t.Fatalf("purged a fresh job: %v", err)
+	}
+	q.purge(time.Now().Add(2 * time.Hour))
+	if _, err := q.Get(j.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after purge: err = %v", err)
+	}
+	if _, err := kv.Get(keyPrefix + j.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("job still stored: err = %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q := &Queue{opts: Options{Backoff: time.Second, MaxBackoff: 5 * time.Second}}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := q.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SleepArgs is the payload of Sleep.
+type SleepArgs struct {
+	Seconds int `json:"seconds" binding:"min=1,max=3600"`
+	// FailAttempts makes the first attempts fail, to try out retries.
+	FailAttempts int `json:"fail_attempts" binding:"gte=0"`
+}
+
+// Sleep waits for the given number of seconds, reporting progress every
+// second. It does nothing useful; it is for trying out the queue.
+func Sleep(ctx context.Context, t *Task, args SleepArgs) (any, error) {
+	if t.Attempt <= args.FailAttempts {
+		return nil, fmt.Errorf("attempt %d of %d set to fail", t.Attempt, args.FailAttempts)
+	}
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for done := 0; done < args.Seconds; done++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-tick.C:
+			t.Progress(done+1, args.Seconds)
+		}
+	}
+	return map[string]int{"slept_seconds": args.Seconds}, nil
+}
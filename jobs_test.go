@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func serveJSON(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestJobs(t *testing.T) {
+	router := newTestRouter(t)
+	serveJSON(router, "POST", "/api/v1/albums", `{"title":"Blue Train","artist":"John Coltrane","price":56.99,"year":1957}`)
+
+	w := serveJSON(router, "POST", "/api/jobs", `{"type":"albums.report"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("create: status %d; body: %s", w.Code, w.Body)
+	}
+	var created struct {
+		ID        string `json:"id"`
+		StatusURL string `json:"status_url"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if loc := w.Header().Get("Location"); loc != "/api/jobs/"+created.ID || created.StatusURL != loc {
+		t.Fatalf("Location %q, status_url %q", loc, created.StatusURL)
+	}
+
+	reportURL := created.StatusURL
+	var job struct {
+		State  string `json:"state"`
+		Result struct {
+			Albums int `json:"albums"`
+		} `json:"result"`
+	}
+	for deadline := time.Now().Add(5 * time.Second); job.State != "succeeded"; {
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s", job.State)
+		}
+		json.Unmarshal(serveJSON(router, "GET", created.StatusURL, "").Body.Bytes(), &job)
+		time.Sleep(time.Millisecond)
+	}
+	if job.Result.Albums != 1 {
+		t.Errorf("report counted %d albums, want 1", job.Result.Albums)
+	}
+
+	w = serveJSON(router, "POST", "/api/jobs", `{"type":"demo.sleep","payload":{"seconds":60}}`)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w = serveJSON(router, "DELETE", created.StatusURL, ""); w.Code != http.StatusOK && w.Code != http.StatusAccepted {
+		t.Errorf("cancel: status %d; body: %s", w.Code, w.Body)
+	}
+
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"unknown type", "POST", "/api/jobs", `{"type":"nope"}`, 422},
+		{"missing type", "POST", "/api/jobs", `{}`, 422},
+		{"invalid payload", "POST", "/api/jobs", `{"type":"demo.sleep","payload":{"seconds":0}}`, 422},
+		{"unknown payload field", "POST", "/api/jobs", `{"type":"demo.sleep","payload":{"minutes":1}}`, 400},
+		{"unknown job", "GET", "/api/jobs/ffff", "", 404},
+		{"cancel unknown job", "DELETE", "/api/jobs/ffff", "", 404},
+		{"retry a finished job", "POST", reportURL + "/retry", "", 409},
+		{"list", "GET", "/api/jobs", "", 200},
+		{"list dead letters", "GET", "/api/jobs?state=dead", "", 200},
+		{"bad state filter", "GET", "/api/jobs?state=sleeping", "", 422},
+	}
+	for _, s := range steps {
+		if w := serveJSON(router, s.method, s.path, s.body); w.Code != s.wantStatus {
+			t.Errorf("%s: status = %d, want %d; body: %s", s.name, w.Code, s.wantStatus, w.Body)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package links
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the accumulated clicks of one link. Days are UTC dates.
+type Stats struct {
+	Code       string           `json:"code"`
+	Clicks     int64            `json:"clicks"`
+	LastClick  *time.Time       `json:"last_click,omitempty"`
+	Days       map[string]int64 `json:"days"`
+	Referrers  map[string]int64 `json:"referrers"`
+	UserAgents map[string]int64 `json:"user_agents"`
+}
+
+// Click is one followed redirect.
+type Click struct {
+	Code      string
+	Referrer  string
+	UserAgent string
+	At        time.Time
+}
+
+const (
+	// maxKeys bounds the distinct referrers and user agents kept per link;
+	// the rest are counted as "other".
+	maxKeys      = 50
+	maxUserAgent = 100
+)
+
+func (s *Stats) add(c Click) {
+	if s.Days == nil {
+		s.Days, s.Referrers, s.UserAgents = map[string]int64{}, map[string]int64{}, map[string]int64{}
+	}
+	s.Clicks++
+	if s.LastClick == nil || c.At.After(*s.LastClick) {
+		at := c.At.UTC()
+		s.LastClick = &at
+	}
+	s.Days[c.At.UTC().Format(time.DateOnly)]++
+	bump(s.Referrers, referrerHost(c.Referrer))
+	ua := c.UserAgent
+	if len(ua) > maxUserAgent {
+		ua = ua[:maxUserAgent]
+	}
+	if ua == "" {
+		ua = "unknown"
+	}
+	bump(s.UserAgents, ua)
+}
+
+func (s *Stats) merge(o *Stats) {
+	s.Clicks += o.Clicks
+	if o.LastClick != nil && (s.LastClick == nil || o.LastClick.After(*s.LastClick)) {
+		s.LastClick = o.LastClick
+	}
+	if s.Days == nil {
+		s.Days, s.Referrers, s.UserAgents = map[string]int64{}, map[string]int64{}, map[string]int64{}
+	}
+	for k, n := range o.Days {
+		s.Days[k] += n
+	}
+	for k, n := range o.Referrers {
+		bumpBy(s.Referrers, k, n)
+	}
+	for k, n := range o.UserAgents {
+		bumpBy(s.UserAgents, k, n)
+	}
+}
+
+func bump(m map[string]int64, k string) { bumpBy(m, k, 1) }
+
+func bumpBy(m map[string]int64, k string, n int64) {
+	if _, ok := m[k]; !ok && len(m) >= maxKeys {
+		k = "other"
+	}
+	m[k] += n
+}
+
+func referrerHost(ref string) string {
+	if ref == "" {
+		return "direct"
+	}
+	if u, err := url.Parse(ref); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "other"
+}
+
+// Recorder counts clicks off the request path: Record never blocks, and the
+// counts are written to the store in batches.
+type Recorder struct {
+	store *Store
+	every time.Duration
+
+	mu      sync.RWMutex // guards closed against Record racing Close
+	closed  bool
+	clicks  chan Click
+	dropped atomic.Int64
+	done    chan struct{}
+}
+
+// NewRecorder buffers up to buffer clicks and writes them every flush.
+func NewRecorder(store *Store, buffer int, flush time.Duration) *Recorder {
+	r := &Recorder{
+		store:  store,
+		every:  flush,
+		clicks: make(chan Click, buffer),
+		done:   make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record queues c, dropping it if the buffer is full.
+func (r *Recorder) Record(c Click) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.clicks <- c:
+	default:
+		if r.dropped.Add(1)%1000 == 1 {
+			slog.Warn("links: click buffer full, dropping clicks", "dropped", r.dropped.Load())
+		}
+	}
+}
+
+// Close writes the clicks still queued and stops the recorder.
+func (r *Recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.clicks)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	t := time.NewTicker(r.every)
+	defer t.Stop()
+
+	pending := map[string]*Stats{}
+	for {
+		select {
+		case c, ok := <-r.clicks:
+			if !ok {
+				r.flush(pending)
+				return
+			}
+			st := pending[c.Code]
+			if st == nil {
+				st = &Stats{Code: c.Code}
+				pending[c.Code] = st
+			}
+			st.add(c)
+		case <-t.C:
+			r.flush(pending)
+			pending = map[string]*Stats{}
+		}
+	}
+}
+
+func (r *Recorder) flush(pending map[string]*Stats) {
+	for code, delta := range pending {
+		if err := r.store.addStats(code, delta); err != nil {
+			slog.Error("links: saving click stats failed", "code", code, "err", err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package links
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"tutorial/storage"
+)
+
+func TestRecorderFlushesOnClose(t *testing.T) {
+	store := NewStore(storage.NewMemory())
+	if err := store.Create(&Link{Code: "abc", URL: "https://example.com"}, func(string) bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRecorder(store, 100, time.Hour)
+	day := time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC)
+	r.Record(Click{Code: "abc", Referrer: "https://example.com/page", UserAgent: "curl", At: day})
+	r.Record(Click{Code: "abc", At: day.Add(time.Hour)})
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	r.Record(Click{Code: "abc", At: day}) // ignored after Close
+
+	st, err := store.Stats("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Clicks != 2 || st.Days["2024-03-01"] != 1 || st.Days["2024-03-02"] != 1 {
+		t.Errorf("clicks by day = %d %v", st.Clicks, st.Days)
+	}
+	if st.Referrers["example.com"] != 1 || st.Referrers["direct"] != 1 {
+		t.Errorf("referrers = %v", st.Referrers)
+	}
+	if st.UserAgents["curl"] != 1 || st.UserAgents["unknown"] != 1 {
+		t.Errorf("user agents = %v", st.UserAgents)
+	}
+}
+
+func TestStatsBoundKeys(t *testing.T) {
+	var st Stats
+	for i := 0; i < maxKeys+10; i++ {
+		st.add(Click{UserAgent: fmt.Sprint("agent ", i), At: time.Now()})
+	}
+	if len(st.UserAgents) != maxKeys+1 || st.UserAgents["other"] != 10 {
+		t.Errorf("%d user agents, %d other", len(st.UserAgents), st.UserAgents["other"])
+	}
+}
+
+func TestFlushSkipsPurgedLinks(t *testing.T) {
+	store := NewStore(storage.NewMemory())
+	past := time.Now().Add(-time.Minute)
+	if err := store.Create(&Link{Code: "gone", URL: "https://example.com", ExpiresAt: &past}, func(string) bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRecorder(store, 100, time.Hour)
+	r.Record(Click{Code: "gone", At: time.Now()})
+	if n, err := store.PurgeExpired(time.Now()); n != 1 || err != nil {
+		t.Fatalf("PurgeExpired = %d, %v", n, err)
+	}
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.kv.Get(statsPrefix + "gone"); err == nil {
+		t.Error("flush recreated the statistics of a purged link")
+	}
+}
@@ -0,0 +1,151 @@
+package links
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+	"tutorial/routes"
+)
+
+// Handler serves the links API and the redirects.
+type Handler struct {
+	store    *Store
+	clicks   *Recorder
+	reserved func(code string) bool
+}
+
+// NewHandler returns a Handler. reserved reports codes that would clash with
+// other routes served next to the redirects.
+func NewHandler(store *Store, clicks *Recorder, reserved func(code string) bool) *Handler {
+	return &Handler{store: store, clicks: clicks, reserved: reserved}
+}
+
+type createRequest struct {
+	URL       string     `json:"url" binding:"required,http_url,max=2048"`
+	Code      string     `json:"code" binding:"omitempty,min=3,max=32,alphanum"`
+	Status    int        `json:"status" binding:"omitempty,oneof=301 302"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type codeURI struct {
+	Code string `uri:"code" binding:"required,max=32,alphanum"`
+}
+
+// RegisterAPI mounts the management endpoints on r, typically /api/links.
+func (h *Handler) RegisterAPI(r routes.Router) {
+	meta := func(description string) routes.Meta {
+		return routes.Meta{Description: description, Auth: "none", Owner: "links"}
+	}
+	r.POST("", meta("Creates a short link with a random or custom code."), h.create)
+	r.GET("/:code", meta("Returns a short link."), h.get)
+	r.GET("/:code/stats", meta("Click counts by day, referrer and user agent."), h.stats)
+}
+
+// RegisterRedirect mounts GET /:code on r. Static routes registered on the
+// same engine take precedence over it.
+func (h *Handler) RegisterRedirect(r routes.Router) {
+	r.GET("/:code", routes.Meta{Name: "links.follow", Description: "Redirects a short link.", Auth: "none", Owner: "links"}, h.follow)
+}
+
+func (h *Handler) create(c *gin.Context) {
+	var req createRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	now := time.Now().UTC()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		e := problem.New(http.StatusUnprocessableEntity, "validation_failed", "The request has invalid fields.")
+		e.Fields = []problem.FieldError{{Field: "expires_at", Message: "must be in the future"}}
+		c.Error(e)
+		return
+	}
+	if req.Status == 0 {
+		req.Status = http.StatusFound
+	}
+
+	l := Link{Code: req.Code, URL: req.URL, Status: req.Status, Created: now, ExpiresAt: req.ExpiresAt}
+	if err := h.store.Create(&l, h.reserved); err != nil {
+		c.Error(storeError(err, req.Code))
+		return
+	}
+	c.Header("Location", c.FullPath()+"/"+l.Code)
+	c.JSON(http.StatusCreated, l)
+}
+
+func (h *Handler) get(c *gin.Context) {
+	l, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, l)
+}
+
+func (h *Handler) stats(c *gin.Context) {
+	l, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+	st, err := h.store.Stats(l.Code)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
+func (h *Handler) follow(c *gin.Context) {
+	l, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if l.Expired(now) {
+		c.Error(problem.New(http.StatusGone, "link_expired", "This link has expired."))
+		return
+	}
+	h.clicks.Record(Click{Code: l.Code, Referrer: c.Request.Referer(), UserAgent: c.Request.UserAgent(), At: now})
+	if l.Status == http.StatusMovedPermanently {
+		// Browsers cache permanent redirects; keep that bounded by expiry.
+		if l.ExpiresAt != nil {
+			c.Header("Cache-Control", "private, max-age="+maxAge(now, *l.ExpiresAt))
+		}
+	} else {
+		c.Header("Cache-Control", "private, no-store")
+	}
+	c.Redirect(l.Status, l.URL)
+}
+
+func (h *Handler) lookup(c *gin.Context) (Link, bool) {
+	var uri codeURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		// Nothing that fails validation can be a stored code.
+		c.Error(storeError(ErrNotFound, c.Param("code")))
+		return Link{}, false
+	}
+	l, err := h.store.Get(uri.Code)
+	if err != nil {
+		c.Error(storeError(err, uri.Code))
+		return Link{}, false
+	}
+	return l, true
+}
+
+func maxAge(now, until time.Time) string {
+	return strconv.Itoa(int(until.Sub(now).Seconds()))
+}
+
+func storeError(err error, code string) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return problem.NotFound("link_not_found", "There is no link "+code+".")
+	case errors.Is(err, ErrExists):
+		return problem.Conflict("code_taken", "The code "+code+" is already taken.")
+	}
+	return err
+}
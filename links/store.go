@@ -0,0 +1,178 @@
+// Package links is a URL shortener: short codes that redirect to long URLs,
+// with click statistics.
+package links
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"tutorial/storage"
+)
+
+var (
+	ErrNotFound = errors.New("link not found")
+	ErrExists   = errors.New("code already taken")
+)
+
+type Link struct {
+	Code      string     `json:"code"`
+	URL       string     `json:"url"`
+	Status    int        `json:"status"` // 301 or 302
+	Created   time.Time  `json:"created"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the link no longer redirects at now.
+func (l Link) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+const (
+	linkPrefix  = "links/"
+	statsPrefix = "linkstats/"
+
+	codeAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	codeLen      = 7
+	maxAttempts  = 10
+)
+
+// Store keeps links and their statistics in a storage.KV.
+type Store struct {
+	kv storage.KV
+	mu sync.Mutex // makes checking for and claiming a code, and updating stats, atomic
+}
+
+func NewStore(kv storage.KV) *Store {
+	return &Store{kv: kv}
+}
+
+func (s *Store) Get(code string) (Link, error) {
+	var l Link
+	err := s.get(linkPrefix+code, &l)
+	return l, err
+}
+
+// Create stores l under l.Code, or under a fresh random code if it is
+// empty. taken reports codes that may not be used even if free, such as
+// the names of other routes.
+func (s *Store) Create(l *Link, taken func(code string) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l.Code != "" {
+		if taken(l.Code) || s.exists(l.Code) {
+			return ErrExists
+		}
+		return s.put(linkPrefix+l.Code, l)
+	}
+	for i := 0; i < maxAttempts; i++ {
+		code, err := randomCode()
+		if err != nil {
+			return err
+		}
+		if !taken(code) && !s.exists(code) {
+			l.Code = code
+			return s.put(linkPrefix+code, l)
+		}
+	}
+	return errors.New("links: no free code found")
+}
+
+func (s *Store) Stats(code string) (Stats, error) {
+	st := Stats{Code: code}
+	err := s.get(statsPrefix+code, &st)
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	return st, err
+}
+
+// addStats merges delta into the statistics of code. Clicks on a link that
+// no longer exists are dropped rather than recreating its statistics.
+func (s *Store) addStats(code string, delta *Stats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.exists(code) {
+		return nil
+	}
+	st, err := s.Stats(code)
+	if err != nil {
+		return err
+	}
+	st.merge(delta)
+	return s.put(statsPrefix+code, st)
+}
+
+// PurgeExpired deletes the links that expired before now, together with
+// their statistics, and returns how many it deleted.
+func (s *Store) PurgeExpired(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		expired   []string
+		decodeErr error
+	)
+	err := s.kv.Scan(linkPrefix, func(_ string, v []byte) bool {
+		var l Link
+		if decodeErr = json.Unmarshal(v, &l); decodeErr != nil {
+			return false
+		}
+		if l.Expired(now) {
+			expired = append(expired, l.Code)
+		}
+		return true
+	})
+	if err := errors.Join(err, decodeErr); err != nil {
+		return 0, err
+	}
+	for i, code := range expired {
+		if err := errors.Join(s.kv.Delete(linkPrefix+code), s.kv.Delete(statsPrefix+code)); err != nil {
+			return i, err
+		}
+	}
+	return len(expired), nil
+}
+
+func (s *Store) exists(code string) bool {
+	_, err := s.kv.Get(linkPrefix + code)
+	return err == nil
+}
+
+func (s *Store) get(key string, v any) error {
+	b, err := s.kv.Get(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (s *Store) put(key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put(key, b)
+}
+
+// randomCode leaves out characters that are easily confused, such as 0 and O.
+func randomCode() (string, error) {
+	b := make([]byte, codeLen)
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = codeAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLinks(t *testing.T) {
+	router := newTestRouter(t)
+
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantHeader map[string]string
+	}{
+		{"create custom", "POST", "/api/links", `{"url":"https://go.dev/doc","code":"godoc","status":301}`, 201,
+			map[string]string{"Location": "/api/links/godoc"}},
+		{"create temporary", "POST", "/api/links", `{"url":"https://example.com/a","code":"tmp"}`, 201, nil},
+		{"create random", "POST", "/api/links", `{"url":"https://example.com/b"}`, 201, nil},
+		{"code taken", "POST", "/api/links", `{"url":"https://example.com","code":"godoc"}`, 409, nil},
+		{"code shadows a route", "POST", "/api/links", `{"url":"https://example.com","code":"todos"}`, 409, nil},
+		{"code shadows the api", "POST", "/api/links", `{"url":"https://example.com","code":"api"}`, 409, nil},
+		{"not a url", "POST", "/api/links", `{"url":"javascript:alert(1)"}`, 422, nil},
+		{"bad status", "POST", "/api/links", `{"url":"https://example.com","status":307}`, 422, nil},
+		{"expired on create", "POST", "/api/links", `{"url":"https://example.com","expires_at":"2000-01-01T00:00:00Z"}`, 422, nil},
+		{"permanent redirect", "GET", "/godoc", "", 301, map[string]string{"Location": "https://go.dev/doc"}},
+		{"temporary redirect", "GET", "/tmp", "", 302, map[string]string{"Location": "https://example.com/a", "Cache-Control": "private, no-store"}},
+		{"unknown code", "GET", "/nope", "", 404, nil},
+		{"root still served", "GET", "/", "", 200, nil},
+		{"todos still served", "GET", "/todos", "", 200, nil},
+		{"albums still served", "GET", "/api/v1/albums", "", 200, nil},
+		{"stats", "GET", "/api/links/godoc/stats", "", 200, nil},
+		{"stats of unknown code", "GET", "/api/links/nope/stats", "", 404, nil},
+	}
+
+	for _, s := range steps {
+		req := httptest.NewRequest(s.method, s.path, strings.NewReader(s.body))
+		if s.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != s.wantStatus {
+			t.Errorf("%s: status = %d, want %d; body: %s", s.name, w.Code, s.wantStatus, w.Body)
+			continue
+		}
+		for k, v := range s.wantHeader {
+			if got := w.Header().Get(k); got != v {
+				t.Errorf("%s: %s = %q, want %q", s.name, k, got, v)
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/links/godoc", nil))
+	if !strings.Contains(w.Body.String(), `"status":301`) {
+		t.Errorf("link = %s, want status 301", w.Body)
+	}
+}
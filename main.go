@@ -1,15 +1,224 @@
 package main
 
-import "github.com/gin-gonic/gin"
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
-func main() {
-	router := gin.Default()
+	"github.com/gin-gonic/gin"
+
+	"tutorial/audit"
+	"tutorial/config"
+	"tutorial/routes"
+	"tutorial/server"
+)
+
+func serve(args []string) error {
+	store, err := config.NewStore("serve", args)
+	if err != nil {
+		return err
+	}
+	cfg := store.Load()
+
+	var level slog.LevelVar
+	level.Set(cfg.LogLevel())
+	opts := &slog.HandlerOptions{Level: &level}
+	if cfg.Log.Format == "text" {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	} else {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	}
+	store.OnReload(func(_, cur *config.Config) {
+		level.Set(cur.LogLevel())
+	})
+
+	a, err := newApp(store)
+	if err != nil {
+		return err
+	}
+	router, err := a.setupRouter()
+	if err != nil {
+		return err
+	}
+	adminRouter := a.setupAdminRouter(router)
 
-	router.GET("/", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"message": "hello world",
-		})
+	srv := server.New(cfg.Server.ShutdownTimeout.Std())
+	public := srv.Listen("public", cfg.Server.Addr, router)
+	if cfg.TLS.Enabled || cfg.TLS.Dev {
+		tlsCfg, err := tlsConfig(cfg.TLS)
+		if err != nil {
+			return err
+		}
+		public.UseTLS(tlsCfg)
+		if cfg.TLS.RedirectAddr != "" {
+			srv.Listen("redirect", cfg.TLS.RedirectAddr, server.RedirectHandler(cfg.Server.Addr))
+		}
+	}
+	srv.Listen("admin", cfg.Admin.Addr, adminRouter)
+	srv.OnShutdownStart(a.health.Shutdown)
+	srv.OnShutdownStart(a.events.Close)
+	srv.OnShutdownStart(a.hub.Close)
+	for _, h := range a.hooks {
+		srv.OnShutdown(h.Name, h.Fn)
+	}
+	srv.OnShutdown("log", func(context.Context) error {
+		slog.Info("server stopped")
+		return nil
 	})
 
-	router.Run(":5000")
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for {
+			select {
+			case <-hup:
+				store.Reload()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return srv.Run(ctx)
+}
+
+func tlsConfig(c config.TLSConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:   c.Version(),
+		CipherSuites: c.CipherSuiteIDs(),
+	}
+	if c.Dev {
+		slog.Warn("serving a self-signed development certificate")
+		cert, err := server.SelfSigned()
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{*cert}
+		return tlsCfg, nil
+	}
+	certs, err := server.NewCertReloader(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg.GetCertificate = certs.GetCertificate
+	return tlsCfg, nil
+}
+
+func configCmd(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: config print [flags]")
+	}
+	cfg, err := config.Load("config print", args[1:])
+	if err != nil {
+		return err
+	}
+	return cfg.Print(os.Stdout)
+}
+
+func auditCmd(args []string) error {
+	if len(args) == 0 || args[0] != "verify" {
+		return errors.New("usage: audit verify [flags]")
+	}
+	cfg, err := config.Load("audit verify", args[1:])
+	if err != nil {
+		return err
+	}
+	rep := audit.Verify(cfg.Audit.Dir)
+	if !rep.OK {
+		return fmt.Errorf("audit log in %s is NOT intact after %d records: %s", cfg.Audit.Dir, rep.Records, rep.Error)
+	}
+	fmt.Printf("audit log in %s is intact: %d records in %d segments\n", cfg.Audit.Dir, rep.Records, rep.Segments)
+	return nil
+}
+
+func routesCmd(args []string) error {
+	fs := flag.NewFlagSet("routes", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: routes [-format table|json|markdown] [-prefix /path] [-method GET] [-listener public|admin] [-- config flags]")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", routes.FormatTable, "output format: table, json or markdown")
+	prefix := fs.String("prefix", "", "only list routes whose path starts with this")
+	method := fs.String("method", "", "only list routes with this HTTP method")
+	listener := fs.String("listener", "", "only list routes of the public or admin listener")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := config.NewStore("routes", fs.Args())
+	if err != nil {
+		return err
+	}
+	a, err := newApp(store)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, h := range a.hooks {
+			h.Fn(context.Background())
+		}
+	}()
+	// Keep gin's own route dump out of the listing.
+	gin.DefaultWriter = io.Discard
+	router, err := a.setupRouter()
+	if err != nil {
+		return err
+	}
+	adminRouter := a.setupAdminRouter(router)
+
+	listed := a.listRoutes(router, adminRouter, *listener, *prefix, *method)
+	if *format == routes.FormatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(listed)
+	}
+	for _, l := range listed {
+		fmt.Printf("## %s\n\n", l.Listener)
+		if err := routes.Write(os.Stdout, *format, l.Routes); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func main() {
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "serve":
+		err = serve(args)
+	case "config":
+		err = configCmd(args)
+	case "audit":
+		err = auditCmd(args)
+	case "routes":
+		err = routesCmd(args)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,253 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are latency buckets in seconds, from 5ms to 10s.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector writes one or more metric families when the registry is scraped.
+type Collector interface {
+	Collect(e *Encoder)
+}
+
+// Registry holds metrics and renders them in the Prometheus text exposition
+// format, in registration order.
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]bool
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// Register adds c. Metric constructors call it; use it directly for custom
+// collectors.
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) claim(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+}
+
+// Counter registers a counter with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	r.claim(name)
+	v := &CounterVec{vec: newVec[*Counter](name, help, labels, func() *Counter { return &Counter{} })}
+	r.Register(v)
+	return v
+}
+
+// Gauge registers a gauge with the given label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	r.claim(name)
+	v := &GaugeVec{vec: newVec[*Gauge](name, help, labels, func() *Gauge { return &Gauge{} })}
+	r.Register(v)
+	return v
+}
+
+// Histogram registers a histogram with the given upper bucket bounds, which
+// must be sorted, and label names.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !slices.IsSorted(buckets) {
+		panic("metrics: buckets of " + name + " are not sorted")
+	}
+	r.claim(name)
+	buckets = slices.Clone(buckets)
+	v := &HistogramVec{vec: newVec[*Histogram](name, help, labels, func() *Histogram {
+		return &Histogram{bounds: buckets, counts: make([]uint64, len(buckets))}
+	})}
+	r.Register(v)
+	return v
+}
+
+// WriteTo renders every registered metric.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	e := &Encoder{w: bufio.NewWriter(cw)}
+	for _, c := range collectors {
+		c.Collect(e)
+	}
+	err := e.w.Flush()
+	return cw.n, err
+}
+
+// Handler serves the registry for scraping.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Encoder writes metric families in the text exposition format.
+type Encoder struct {
+	w *bufio.Writer
+}
+
+// Header starts a family. typ is counter, gauge, histogram or untyped.
+func (e *Encoder) Header(name, help, typ string) {
+	fmt.Fprintf(e.w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+}
+
+// Sample writes one sample; labels alternate names and values.
+func (e *Encoder) Sample(name string, value float64, labels ...string) {
+	e.w.WriteString(name)
+	if len(labels) > 0 {
+		e.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				e.w.WriteByte(',')
+			}
+			e.w.WriteString(labels[i])
+			e.w.WriteString(`="`)
+			e.w.WriteString(escapeLabel(labels[i+1]))
+			e.w.WriteByte('"')
+		}
+		e.w.WriteByte('}')
+	}
+	e.w.WriteByte(' ')
+	e.w.WriteString(formatFloat(value))
+	e.w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+// vec holds the series of one family, keyed by label values.
+type vec[T any] struct {
+	name, help string
+	labels     []string
+	newSeries  func() T
+
+	mu     sync.RWMutex
+	series map[string]*entry[T]
+}
+
+type entry[T any] struct {
+	values []string
+	s      T
+}
+
+func newVec[T any](name, help string, labels []string, newSeries func() T) vec[T] {
+	return vec[T]{name: name, help: help, labels: labels, newSeries: newSeries, series: map[string]*entry[T]{}}
+}
+
+func (v *vec[T]) with(values []string) T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	e, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return e.s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if e, ok := v.series[key]; ok {
+		return e.s
+	}
+	e = &entry[T]{values: slices.Clone(values), s: v.newSeries()}
+	v.series[key] = e
+	return e.s
+}
+
+// sorted returns the series ordered by label values so output is stable.
+func (v *vec[T]) sorted() []*entry[T] {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]*entry[T], len(keys))
+	for i, k := range keys {
+		out[i] = v.series[k]
+	}
+	v.mu.RUnlock()
+	return out
+}
+
+// pairs zips label names with values, plus any extra name/value pairs.
+func (v *vec[T]) pairs(values []string, extra ...string) []string {
+	out := make([]string, 0, 2*len(values)+len(extra))
+	for i, name := range v.labels {
+		out = append(out, name, values[i])
+	}
+	return append(out, extra...)
+}
+
+// atomicFloat is a float64 updated with compare-and-swap.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) add(d float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+d)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) load() float64 { return math.Float64frombits(f.bits.Load()) }
+
+func (f *atomicFloat) store(v float64) { f.bits.Store(math.Float64bits(v)) }
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// exposition is a parsed scrape: sample values keyed by the series as
+// written, such as `requests_total{code="200"}`, and family types by name.
+type exposition struct {
+	samples map[string]float64
+	types   map[string]string
+}
+
+// scrape renders r and parses the output, failing on any line that is not
+// a well-formed comment or sample, or a sample of an undeclared family.
+func scrape(t *testing.T, r *Registry) exposition {
+	t.Helper()
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	exp := exposition{samples: map[string]float64{}, types: map[string]string{}}
+	sc := bufio.NewScanner(strings.NewReader(b.String()))
+	for sc.Scan() {
+		line := sc.Text()
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, typ, _ := strings.Cut(rest, " ")
+			exp.types[name] = typ
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			t.Fatalf("malformed line %q", line)
+		}
+		series, value := line[:i], line[i+1:]
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		name, _, _ := strings.Cut(series, "{")
+		if !declared(exp.types, name) {
+			t.Fatalf("sample %q comes before its TYPE line", line)
+		}
+		if _, dup := exp.samples[series]; dup {
+			t.Fatalf("duplicate series %s", series)
+		}
+		exp.samples[series] = v
+	}
+	return exp
+}
+
+func declared(types map[string]string, name string) bool {
+	if _, ok := types[name]; ok {
+		return true
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if base, ok := strings.CutSuffix(name, suffix); ok && types[base] == "histogram" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestExposition(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests.", "code")
+	inFlight := r.Gauge("in_flight", "In flight.")
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{.1, 1}, "route")
+	r.Register(CollectorFunc(func(e *Encoder) {
+		e.Header("custom", "Custom\nhelp with a \\.", "gauge")
+		e.Sample("custom", 3, "path", `a "quoted"\path`+"\n")
+	}))
+
+	requests.With("200").Inc()
+	requests.With("200").Add(2)
+	requests.With("500").Inc()
+	requests.With("500").Add(-5) // counters only go up
+	inFlight.With().Inc()
+	inFlight.With().Inc()
+	inFlight.With().Dec()
+	for _, v := range []float64{.05, .1, .5, 5} {
+		latency.With("/x").Observe(v)
+	}
+
+	exp := scrape(t, r)
+	want := map[string]float64{
+		`requests_total{code="200"}`:                   3,
+		`requests_total{code="500"}`:                   1,
+		`in_flight`:                                    1,
+		`latency_seconds_bucket{route="/x",le="0.1"}`:  2,
+		`latency_seconds_bucket{route="/x",le="1"}`:    3,
+		`latency_seconds_bucket{route="/x",le="+Inf"}`: 4,
+		`latency_seconds_sum{route="/x"}`:              5.65,
+		`latency_seconds_count{route="/x"}`:            4,
+		`custom{path="a \"quoted\"\\path\n"}`:          3,
+	}
+	for series, v := range want {
+		if got, ok := exp.samples[series]; !ok || got != v {
+			t.Errorf("%s = %v (present: %v), want %v", series, got, ok, v)
+		}
+	}
+	if len(exp.samples) != len(want) {
+		t.Errorf("%d samples, want %d: %v", len(exp.samples), len(want), exp.samples)
+	}
+	for name, typ := range map[string]string{"requests_total": "counter", "in_flight": "gauge", "latency_seconds": "histogram"} {
+		if exp.types[name] != typ {
+			t.Errorf("type of %s = %q, want %s", name, exp.types[name], typ)
+		}
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(r *Registry)
+	}{
+		{"duplicate", func(r *Registry) { r.Counter("x", ""); r.Gauge("x", "") }},
+		{"unsorted buckets", func(r *Registry) { r.Histogram("h", "", []float64{1, .5}) }},
+		{"label count", func(r *Registry) { r.Counter("c", "", "a", "b").With("only one") }},
+	}
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", tt.name)
+				}
+			}()
+			tt.fn(NewRegistry())
+		}()
+	}
+}
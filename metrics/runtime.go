@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"runtime"
+	"time"
+)
+
+// RegisterRuntime exports Go runtime statistics, read on every scrape.
+func RegisterRuntime(r *Registry) {
+	start := time.Now()
+	r.Register(CollectorFunc(func(e *Encoder) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+
+		e.Header("go_info", "Information about the Go environment.", "gauge")
+		e.Sample("go_info", 1, "version", runtime.Version())
+		e.Header("go_goroutines", "Number of goroutines that currently exist.", "gauge")
+		e.Sample("go_goroutines", float64(runtime.NumGoroutine()))
+		e.Header("go_gomaxprocs", "Number of CPUs the Go scheduler may use at once.", "gauge")
+		e.Sample("go_gomaxprocs", float64(runtime.GOMAXPROCS(0)))
+		e.Header("go_memstats_alloc_bytes", "Bytes of allocated heap objects.", "gauge")
+		e.Sample("go_memstats_alloc_bytes", float64(m.Alloc))
+		e.Header("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", "gauge")
+		e.Sample("go_memstats_sys_bytes", float64(m.Sys))
+		e.Header("go_memstats_heap_objects", "Number of allocated heap objects.", "gauge")
+		e.Sample("go_memstats_heap_objects", float64(m.HeapObjects))
+		e.Header("go_memstats_mallocs_total", "Cumulative count of heap objects allocated.", "counter")
+		e.Sample("go_memstats_mallocs_total", float64(m.Mallocs))
+		e.Header("go_gc_cycles_total", "Number of completed GC cycles.", "counter")
+		e.Sample("go_gc_cycles_total", float64(m.NumGC))
+		e.Header("go_gc_pause_seconds_total", "Cumulative time spent in GC stop-the-world pauses.", "counter")
+		e.Sample("go_gc_pause_seconds_total", float64(m.PauseTotalNs)/1e9)
+		e.Header("process_uptime_seconds", "Seconds since the process started.", "gauge")
+		e.Sample("process_uptime_seconds", time.Since(start).Seconds())
+	}))
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Counter only goes up.
+type Counter struct {
+	v atomicFloat
+}
+
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add increases the counter; negative values are ignored.
+func (c *Counter) Add(d float64) {
+	if d > 0 {
+		c.v.add(d)
+	}
+}
+
+type CounterVec struct {
+	vec[*Counter]
+}
+
+// With returns the counter for the given label values.
+func (v *CounterVec) With(values ...string) *Counter { return v.with(values) }
+
+func (v *CounterVec) Collect(e *Encoder) {
+	e.Header(v.name, v.help, "counter")
+	for _, s := range v.sorted() {
+		e.Sample(v.name, s.s.v.load(), v.pairs(s.values)...)
+	}
+}
+
+// Gauge can go up and down.
+type Gauge struct {
+	v atomicFloat
+}
+
+func (g *Gauge) Set(v float64) { g.v.store(v) }
+func (g *Gauge) Add(d float64) { g.v.add(d) }
+func (g *Gauge) Inc()          { g.v.add(1) }
+func (g *Gauge) Dec()          { g.v.add(-1) }
+
+type GaugeVec struct {
+	vec[*Gauge]
+}
+
+// With returns the gauge for the given label values.
+func (v *GaugeVec) With(values ...string) *Gauge { return v.with(values) }
+
+func (v *GaugeVec) Collect(e *Encoder) {
+	e.Header(v.name, v.help, "gauge")
+	for _, s := range v.sorted() {
+		e.Sample(v.name, s.s.v.load(), v.pairs(s.values)...)
+	}
+}
+
+// Histogram counts observations into buckets.
+type Histogram struct {
+	bounds []float64
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+type HistogramVec struct {
+	vec[*Histogram]
+}
+
+// With returns the histogram for the given label values.
+func (v *HistogramVec) With(values ...string) *Histogram { return v.with(values) }
+
+func (v *HistogramVec) Collect(e *Encoder) {
+	e.Header(v.name, v.help, "histogram")
+	for _, s := range v.sorted() {
+		h := s.s
+		h.mu.Lock()
+		counts, count, sum := append([]uint64(nil), h.counts...), h.count, h.sum
+		h.mu.Unlock()
+
+		var cum uint64
+		for i, bound := range h.bounds {
+			cum += counts[i]
+			e.Sample(v.name+"_bucket", float64(cum), v.pairs(s.values, "le", formatFloat(bound))...)
+		}
+		e.Sample(v.name+"_bucket", float64(count), v.pairs(s.values, "le", formatFloat(math.Inf(1)))...)
+		e.Sample(v.name+"_sum", sum, v.pairs(s.values)...)
+		e.Sample(v.name+"_count", float64(count), v.pairs(s.values)...)
+	}
+}
+
+// CollectorFunc adapts a function to Collector.
+type CollectorFunc func(e *Encoder)
+
+func (f CollectorFunc) Collect(e *Encoder) { f(e) }
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/audit"
+	"tutorial/config"
+	"tutorial/problem"
+)
+
+// AdminAuth requires "Authorization: Bearer <admin.token>". Admin endpoints
+// are closed entirely while no token is configured.
+func AdminAuth(live func() *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := live().Admin.Token
+		if token == "" {
+			problem.Abort(c, problem.New(http.StatusForbidden, "admin_disabled", "No admin token is configured."))
+			return
+		}
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+			problem.Abort(c, problem.New(http.StatusUnauthorized, "unauthorized", "A valid admin bearer token is required."))
+			return
+		}
+		c.Set(audit.ActorKey, "admin")
+		c.Next()
+	}
+}
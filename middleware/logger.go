@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/config"
+	"tutorial/requestid"
+)
+
+const (
+	routeKey  = "access_log.route"
+	errorsKey = "access_log.errors"
+)
+
+// AccessLog writes one structured record per request to logger. Requests for
+// paths in log.skip_paths, read from live on every request, are not logged.
+func AccessLog(logger *slog.Logger, live func() *config.Config) gin.HandlerFunc {
+	log := gin.LoggerWithConfig(gin.LoggerConfig{
+		Output: io.Discard,
+		Formatter: func(p gin.LogFormatterParams) string {
+			logAccess(logger, p)
+			return ""
+		},
+	})
+
+	return func(c *gin.Context) {
+		if slices.Contains(live().Log.SkipPaths, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		c.Set(routeKey, c.FullPath())
+		c.Set(errorsKey, func() []string { return c.Errors.Errors() })
+		log(c)
+	}
+}
+
+func logAccess(logger *slog.Logger, p gin.LogFormatterParams) {
+	level := slog.LevelInfo
+	switch {
+	case p.StatusCode >= 500:
+		level = slog.LevelError
+	case p.StatusCode >= 400:
+		level = slog.LevelWarn
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", p.Method),
+		slog.String("route", p.Keys[routeKey].(string)),
+		slog.String("path", p.Path),
+		slog.Int("status", p.StatusCode),
+		slog.Float64("latency_ms", float64(p.Latency.Microseconds())/1000),
+		slog.Int("bytes", max(p.BodySize, 0)),
+		slog.String("client_ip", p.ClientIP),
+		slog.String("user_agent", p.Request.UserAgent()),
+	}
+	if id, _ := p.Keys[requestid.Key].(string); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if errs := p.Keys[errorsKey].(func() []string)(); len(errs) > 0 {
+		attrs = append(attrs, slog.Any("errors", errs))
+	}
+
+	logger.LogAttrs(p.Request.Context(), level, "request", attrs...)
+}
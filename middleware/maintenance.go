@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/config"
+	"tutorial/problem"
+)
+
+// Maintenance answers every request with 503 while maintenance.enabled is set.
+func Maintenance(live func() *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m := live().Maintenance
+		if !m.Enabled {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", "120")
+		problem.Abort(c, problem.New(http.StatusServiceUnavailable, "maintenance", m.Message))
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/metrics"
+)
+
+// unmatchedRoute labels requests no route matched, so scanning for random
+// paths cannot create unbounded series.
+const unmatchedRoute = "unmatched"
+
+// Metrics records request count, latency and in-flight requests in reg,
+// labelled by method, route template and status class.
+func Metrics(reg *metrics.Registry, buckets []float64) gin.HandlerFunc {
+	requests := reg.Counter("http_requests_total",
+		"HTTP requests handled, by method, route and status class.",
+		"method", "route", "status")
+	duration := reg.Histogram("http_request_duration_seconds",
+		"HTTP request latency in seconds, by method, route and status class.",
+		buckets, "method", "route", "status")
+	inFlight := reg.Gauge("http_requests_in_flight",
+		"HTTP requests currently being handled, by method and route.",
+		"method", "route")
+
+	return func(c *gin.Context) {
+		method := metricMethod(c.Request.Method)
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		g := inFlight.With(method, route)
+		g.Inc()
+		start := time.Now()
+		handled := false
+		// Deferred so a panic, which Recovery turns into a 500 further up
+		// the chain, is counted and does not leave the gauge raised.
+		defer func() {
+			g.Dec()
+			code := c.Writer.Status()
+			if !handled {
+				code = http.StatusInternalServerError
+			}
+			status := strconv.Itoa(code/100) + "xx"
+			requests.With(method, route, status).Inc()
+			duration.With(method, route, status).Observe(time.Since(start).Seconds())
+		}()
+
+		c.Next()
+		handled = true
+	}
+}
+
+// metricMethod folds non-standard methods into one label value.
+func metricMethod(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return m
+	}
+	return "OTHER"
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/metrics"
+)
+
+// samples scrapes reg and returns each sample's value keyed by the series
+// as written, skipping comments.
+func samples(t *testing.T, reg *metrics.Registry) map[string]float64 {
+	t.Helper()
+	var b strings.Builder
+	reg.WriteTo(&b)
+	out := map[string]float64{}
+	sc := bufio.NewScanner(strings.NewReader(b.String()))
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			t.Fatalf("malformed sample %q", line)
+		}
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("sample %q: %v", line, err)
+		}
+		out[line[:i]] = v
+	}
+	return out
+}
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reg := metrics.NewRegistry()
+	router := gin.New()
+	router.Use(Recovery(slog.New(slog.NewTextHandler(io.Discard, nil))), Metrics(reg, []float64{1}))
+	router.GET("/items/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+	router.Handle("BREW", "/items/:id", func(c *gin.Context) { c.Status(http.StatusTeapot) })
+
+	for _, r := range []struct{ method, path string }{
+		{"GET", "/items/1"},
+		{"GET", "/items/2"},
+		{"GET", "/nope"},
+		{"POST", "/random/12345"},
+		{"GET", "/panic"},
+		{"BREW", "/items/3"},
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(r.method, r.path, nil))
+	}
+
+	got := samples(t, reg)
+	want := map[string]float64{
+		`http_requests_total{method="GET",route="/items/:id",status="2xx"}`: 2,
+		// Unmatched paths share one series whatever they are.
+		`http_requests_total{method="GET",route="unmatched",status="4xx"}`:              1,
+		`http_requests_total{method="POST",route="unmatched",status="4xx"}`:             1,
+		`http_requests_total{method="GET",route="/panic",status="5xx"}`:                 1,
+		`http_requests_total{method="OTHER",route="/items/:id",status="4xx"}`:           1,
+		`http_request_duration_seconds_count{method="GET",route="/panic",status="5xx"}`: 1,
+		// A panic must not leave the request counted as in flight.
+		`http_requests_in_flight{method="GET",route="/panic"}`:     0,
+		`http_requests_in_flight{method="GET",route="/items/:id"}`: 0,
+	}
+	for series, v := range want {
+		if g, ok := got[series]; !ok || g != v {
+			t.Errorf("%s = %v (present: %v), want %v", series, g, ok, v)
+		}
+	}
+	for series := range got {
+		if strings.Contains(series, "/nope") || strings.Contains(series, "/random") {
+			t.Errorf("raw path in series %s", series)
+		}
+	}
+}
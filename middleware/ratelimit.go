@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/config"
+	"tutorial/problem"
+)
+
+// RateLimit applies a token bucket per client IP using the rate_limit
+// settings read from live on every request.
+func RateLimit(live func() *config.Config) gin.HandlerFunc {
+	l := &limiter{buckets: map[string]*bucket{}}
+	return func(c *gin.Context) {
+		rl := live().RateLimit
+		if !rl.Enabled {
+			c.Next()
+			return
+		}
+		if wait, ok := l.allow(c.ClientIP(), rl.RPS, rl.Burst, time.Now()); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			problem.Abort(c, problem.New(http.StatusTooManyRequests, "rate_limited", "Too many requests; retry later."))
+			return
+		}
+		c.Next()
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// allow takes a token from key's bucket. If none is left it reports how long
+// until one is.
+func (l *limiter) allow(key string, rps float64, burst int, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		l.sweep(now, rps, burst)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rps)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rps * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// sweep forgets clients whose buckets have refilled, since a new bucket would
+// be identical.
+func (l *limiter) sweep(now time.Time, rps float64, burst int) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rps >= float64(burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
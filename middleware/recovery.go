@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+	"tutorial/requestid"
+)
+
+// Recovery turns a panic into a 500 problem response carrying the request ID,
+// and logs it with the stack.
+func Recovery(logger *slog.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		logger.ErrorContext(c.Request.Context(), "panic recovered",
+			"err", err,
+			"request_id", requestid.Get(c),
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"stack", string(debug.Stack()),
+		)
+		problem.Abort(c, problem.Internal(fmt.Errorf("panic: %v", err)))
+	})
+}
@@ -0,0 +1,117 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// init makes validation errors name fields after their json, uri or form
+// tag, which is what clients send, rather than the Go field name.
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		for _, tag := range []string{"json", "uri", "form"} {
+			name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return f.Name
+	})
+}
+
+// FromBinding converts an error from ShouldBind* into a problem: 422 with
+// per-field details when validation failed, 400 when the body or parameters
+// could not be decoded at all.
+func FromBinding(err error) *Error {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		e := New(http.StatusUnprocessableEntity, "validation_failed", "The request has invalid fields.")
+		for _, fe := range verrs {
+			e.Fields = append(e.Fields, FieldError{Field: fieldPath(fe), Message: message(fe)})
+		}
+		e.Err = err
+		return e
+	}
+
+	e := BadRequest("malformed_request", "The request could not be decoded.")
+	e.Err = err
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		e.Detail = fmt.Sprintf("The body is not valid JSON (at byte %d).", syntax.Offset)
+	case errors.As(err, &typ):
+		e.Fields = []FieldError{{Field: typ.Field, Message: "must be of type " + typ.Type.String()}}
+	case err.Error() == "EOF":
+		e.Detail = "The request body is empty."
+	}
+	return e
+}
+
+// fieldPath drops the top-level struct name from the namespace, so nested
+// fields read "tracks[0].title".
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if _, rest, ok := strings.Cut(ns, "."); ok {
+		return rest
+	}
+	return fe.Field()
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		if u := unit(fe); u != "" {
+			return "must have at least " + fe.Param() + " " + u
+		}
+		return "must be at least " + fe.Param()
+	case "max", "lte":
+		if u := unit(fe); u != "" {
+			return "must have at most " + fe.Param() + " " + u
+		}
+		return "must be at most " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "lt":
+		return "must be less than " + fe.Param()
+	case "len":
+		if u := unit(fe); u != "" {
+			return "must have exactly " + fe.Param() + " " + u
+		}
+		return "must be " + fe.Param()
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	case "email":
+		return "must be an email address"
+	case "url", "http_url":
+		return "must be a URL"
+	}
+	return "failed the " + fe.Tag() + " check"
+}
+
+// unit names what length limits count for fe, or "" for numbers.
+func unit(fe validator.FieldError) string {
+	switch fe.Kind() {
+	case reflect.String:
+		return "characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return "items"
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/requestid"
+)
+
+// ContentType is the media type of RFC 7807 problem details.
+const ContentType = "application/problem+json"
+
+// Error is an application error that renders as a problem details document.
+// Handlers report one with c.Error and return; Handler renders it.
+type Error struct {
+	Status int
+	Code   string // stable, machine-readable identifier such as "album_not_found"
+	Detail string
+	Fields []FieldError
+	Err    error // underlying cause; logged, never sent to the client
+}
+
+// FieldError describes one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func NotFound(code, detail string) *Error {
+	return New(http.StatusNotFound, code, detail)
+}
+
+func Conflict(code, detail string) *Error {
+	return New(http.StatusConflict, code, detail)
+}
+
+func BadRequest(code, detail string) *Error {
+	return New(http.StatusBadRequest, code, detail)
+}
+
+// Internal wraps err in an opaque 500.
+func Internal(err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: "internal", Detail: "An internal error occurred.", Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// document is the JSON body; code, request_id and errors are extension
+// members.
+type document struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// Abort stops the chain and writes e as the response.
+func Abort(c *gin.Context, e *Error) {
+	c.Abort()
+	write(c, e)
+}
+
+func write(c *gin.Context, e *Error) {
+	doc := document{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Detail,
+		Instance:  c.Request.URL.Path,
+		Code:      e.Code,
+		RequestID: requestid.Get(c),
+		Errors:    e.Fields,
+	}
+	c.Render(e.Status, jsonRender{doc})
+}
+
+// Handler renders the last error handlers added with c.Error once the chain
+// has run, unless a response was already written. Errors that are not an
+// *Error become an opaque 500.
+func Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		var pe *Error
+		if !errors.As(err, &pe) {
+			pe = Internal(err)
+		}
+		write(c, pe)
+	}
+}
+
+// NoRoute renders unmatched routes as 404 problems.
+func NoRoute(c *gin.Context) {
+	write(c, NotFound("route_not_found", "No route matches "+c.Request.Method+" "+c.Request.URL.Path+"."))
+}
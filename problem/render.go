@@ -0,0 +1,20 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// jsonRender is render.JSON with the problem+json content type.
+type jsonRender struct {
+	doc document
+}
+
+func (r jsonRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.doc)
+}
+
+func (r jsonRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+}
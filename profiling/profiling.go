@@ -0,0 +1,164 @@
+package profiling
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+	"tutorial/routes"
+)
+
+const maxTraceDuration = 60 * time.Second
+
+// Register mounts the profiling endpoints on r, documenting them with meta.
+// Callers are responsible for authenticating and gating the group.
+func Register(r routes.Router, meta routes.Meta) {
+	p := &profiler{}
+	describe := func(description string) routes.Meta {
+		m := meta
+		m.Description = description
+		return m
+	}
+
+	r.GET("/pprof/", describe("pprof index."), gin.WrapF(pprof.Index))
+	r.GET("/pprof/cmdline", describe("Command line of the process."), gin.WrapF(pprof.Cmdline))
+	r.GET("/pprof/profile", describe("CPU profile; ?seconds=N."), gin.WrapF(pprof.Profile))
+	r.GET("/pprof/symbol", describe("Symbol lookup."), gin.WrapF(pprof.Symbol))
+	r.POST("/pprof/symbol", describe("Symbol lookup."), gin.WrapF(pprof.Symbol))
+	r.GET("/pprof/trace", describe("Execution trace; ?seconds=N."), p.trace)
+	for _, name := range []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"} {
+		r.GET("/pprof/"+name, describe("pprof "+name+" profile."), gin.WrapH(pprof.Handler(name)))
+	}
+
+	r.GET("/trace", describe("Execution trace; ?seconds=N, at most 60."), p.trace)
+	r.GET("/goroutines", describe("Stacks of all goroutines."), goroutines)
+	r.GET("/gc", describe("Garbage collector and heap statistics."), gcStats)
+	r.GET("/rates", describe("Current block and mutex profiling rates."), p.getRates)
+	r.PUT("/rates", describe("Sets block and mutex profiling rates."), p.setRates)
+}
+
+type profiler struct {
+	mu        sync.Mutex
+	blockRate int
+	tracing   bool
+}
+
+// trace captures an execution trace for ?seconds=N (default 5, at most 60).
+func (p *profiler) trace(c *gin.Context) {
+	secs, err := strconv.ParseFloat(c.DefaultQuery("seconds", "5"), 64)
+	d := time.Duration(secs * float64(time.Second))
+	if err != nil || d <= 0 || d > maxTraceDuration {
+		c.Error(problem.BadRequest("invalid_duration", "seconds must be between 0 and 60."))
+		return
+	}
+
+	p.mu.Lock()
+	if p.tracing {
+		p.mu.Unlock()
+		c.Error(problem.Conflict("trace_running", "A trace is already being captured."))
+		return
+	}
+	p.tracing = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.tracing = false
+		p.mu.Unlock()
+	}()
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", `attachment; filename="trace.out"`)
+	if err := trace.Start(c.Writer); err != nil {
+		c.Header("Content-Disposition", "")
+		c.Error(problem.Conflict("trace_running", err.Error()))
+		return
+	}
+	select {
+	case <-time.After(d):
+	case <-c.Request.Context().Done():
+	}
+	trace.Stop()
+}
+
+// goroutines dumps the stack of every goroutine as text.
+func goroutines(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	rpprof.Lookup("goroutine").WriteTo(c.Writer, 2)
+}
+
+func gcStats(c *gin.Context) {
+	var gc debug.GCStats
+	gc.PauseQuantiles = make([]time.Duration, 5)
+	debug.ReadGCStats(&gc)
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	quantiles := make([]string, len(gc.PauseQuantiles))
+	for i, q := range gc.PauseQuantiles {
+		quantiles[i] = q.String()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"num_gc":          gc.NumGC,
+		"last_gc":         gc.LastGC,
+		"pause_total":     gc.PauseTotal.String(),
+		"pause_quantiles": quantiles,
+		"heap_alloc":      m.HeapAlloc,
+		"heap_sys":        m.HeapSys,
+		"heap_objects":    m.HeapObjects,
+		"next_gc":         m.NextGC,
+		"gc_cpu_fraction": m.GCCPUFraction,
+		"goroutines":      runtime.NumGoroutine(),
+	})
+}
+
+type rates struct {
+	// BlockRate is passed to runtime.SetBlockProfileRate; 0 disables block
+	// profiling.
+	BlockRate *int `json:"block_rate" binding:"omitempty,min=0"`
+	// MutexFraction is passed to runtime.SetMutexProfileFraction; 0
+	// disables mutex profiling.
+	MutexFraction *int `json:"mutex_fraction" binding:"omitempty,min=0"`
+}
+
+func (p *profiler) currentRates() gin.H {
+	return gin.H{
+		"block_rate":     p.blockRate,
+		"mutex_fraction": runtime.SetMutexProfileFraction(-1),
+	}
+}
+
+func (p *profiler) getRates(c *gin.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c.JSON(http.StatusOK, p.currentRates())
+}
+
+// setRates turns block and mutex profiling on or off; both are off by
+// default because they cost CPU on every contention event.
+func (p *profiler) setRates(c *gin.Context) {
+	var req rates
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if req.BlockRate != nil {
+		runtime.SetBlockProfileRate(*req.BlockRate)
+		p.blockRate = *req.BlockRate
+	}
+	if req.MutexFraction != nil {
+		runtime.SetMutexProfileFraction(*req.MutexFraction)
+	}
+	c.JSON(http.StatusOK, p.currentRates())
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimitClientIP(t *testing.T) {
+	limited := []string{"-rate_limit.enabled", "-rate_limit.rps=0.001", "-rate_limit.burst=2"}
+	tests := []struct {
+		name   string
+		args   []string
+		status int // of the third request
+	}{
+		// Without trusted proxies the header is the client's to forge, so
+		// every request counts against the connecting address.
+		{"untrusted", limited, http.StatusTooManyRequests},
+		{"trusted proxy", append(limited, "-server.trusted_proxies=192.0.2.0/24"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		router := newTestRouter(t, tt.args...)
+		var status int
+		for i, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+			req := httptest.NewRequest("GET", "/api/v1/albums", nil)
+			req.RemoteAddr = "192.0.2.10:40000"
+			req.Header.Set("X-Forwarded-For", ip)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if i < 2 && w.Code != http.StatusOK {
+				t.Fatalf("%s: request %d: status %d", tt.name, i+1, w.Code)
+			}
+			status = w.Code
+		}
+		if status != tt.status {
+			t.Errorf("%s: third request with a new X-Forwarded-For got %d, want %d", tt.name, status, tt.status)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header carries the request ID in both directions.
+const Header = "X-Request-ID"
+
+// Key is the gin.Context key holding the request ID.
+const Key = "request_id"
+
+const maxLen = 128
+
+type ctxKey struct{}
+
+// Middleware takes the request ID from the incoming X-Request-ID header if it
+// is acceptable and generates one otherwise. The ID is stored in the
+// gin.Context and the request's context.Context and echoed in the response.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !valid(id) {
+			id = New()
+		}
+		c.Set(Key, id)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), id))
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+// New returns a random 128-bit ID in hex.
+func New() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// valid accepts IDs of up to 128 characters from [A-Za-z0-9._:-], which
+// covers UUIDs and most tracing formats while keeping logs safe.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		switch ch := id[i]; {
+		case 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z', '0' <= ch && ch <= '9':
+		case ch == '-', ch == '_', ch == '.', ch == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the request ID of c, or "" outside Middleware.
+func Get(c *gin.Context) string {
+	return c.GetString(Key)
+}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or "".
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Transport propagates the request ID found in an outgoing request's context
+// as its X-Request-ID header.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return roundTripper{base}
+}
+
+type roundTripper struct {
+	base http.RoundTripper
+}
+
+func (t roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := FromContext(req.Context())
+	if id == "" || req.Header.Get(Header) != "" {
+		return t.base.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the caller's request.
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+	return t.base.RoundTrip(req)
+}
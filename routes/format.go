@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formats accepted by Write.
+const (
+	FormatTable    = "table"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+)
+
+// Write renders rs in the given format.
+func Write(w io.Writer, format string, rs []Route) error {
+	switch format {
+	case FormatJSON:
+		if rs == nil {
+			rs = []Route{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rs)
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "METHOD\tPATH\tHANDLER\tAUTH\tOWNER\tDEPRECATED\tMIDDLEWARE\tDESCRIPTION")
+		for _, r := range rs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				r.Method, r.Path, r.Handler, dash(r.Auth), dash(r.Owner), dash(r.Deprecated),
+				dash(strings.Join(r.Middleware, ", ")), r.Description)
+		}
+		return tw.Flush()
+	case FormatMarkdown:
+		var b strings.Builder
+		b.WriteString("| Method | Path | Description | Auth | Owner | Deprecated | Middleware |\n")
+		b.WriteString("|---|---|---|---|---|---|---|\n")
+		for _, r := range rs {
+			fmt.Fprintf(&b, "| %s | `%s` | %s | %s | %s | %s | %s |\n",
+				r.Method, r.Path, md(r.Description), md(dash(r.Auth)), md(dash(r.Owner)), dash(r.Deprecated),
+				md(strings.Join(r.Middleware, ", ")))
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	return fmt.Errorf("unknown format %q; use table, json or markdown", format)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func md(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
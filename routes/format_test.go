@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var sample = []Route{
+	{
+		Method:     "GET",
+		Path:       "/albums",
+		Handler:    "tutorial/albums.(*Handler).list-fm",
+		Middleware: []string{"tutorial/requestid.Middleware.func1", "tutorial/middleware.Metrics.func1"},
+		Meta:       Meta{Name: "albums", Description: "Lists albums.", Auth: "none", Owner: "catalog"},
+	},
+	{
+		Method:     "DELETE",
+		Path:       "/debug/cache",
+		Handler:    "main.clearCache",
+		Middleware: []string{"tutorial/middleware.AdminAuth.func1"},
+		Meta:       Meta{Description: "Empties a | b caches.", Auth: "admin token", Deprecated: "2025-01-31"},
+	},
+	{Method: "GET", Path: "/ping", Handler: "main.ping", Meta: Meta{Description: "Answers pong."}},
+}
+
+func TestWriteGolden(t *testing.T) {
+	for format, file := range map[string]string{
+		FormatJSON:     "routes.json",
+		FormatTable:    "routes.txt",
+		FormatMarkdown: "routes.md",
+	} {
+		var buf bytes.Buffer
+		if err := Write(&buf, format, sample); err != nil {
+			t.Fatal(err)
+		}
+		golden := filepath.Join("testdata", file)
+		if *update {
+			if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s output differs from %s (go test -update rewrites it):\n%s", format, golden, buf.Bytes())
+		}
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "yaml", sample); err == nil {
+		t.Error("unknown format accepted")
+	}
+	if err := Write(&buf, FormatJSON, nil); err != nil || buf.String() != "[]\n" {
+		t.Errorf("no routes as JSON = %q, %v", buf.String(), err)
+	}
+}
@@ -0,0 +1,195 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Meta documents a route. It is attached when the route is registered.
+type Meta struct {
+	Name        string `json:"name,omitempty"` // for building URLs with Catalog.URL
+	Description string `json:"description,omitempty"`
+	Auth        string `json:"auth,omitempty"`       // what a caller needs, e.g. "admin token"
+	Owner       string `json:"owner,omitempty"`      // team to ask about the route
+	Deprecated  string `json:"deprecated,omitempty"` // date (YYYY-MM-DD) the route goes away
+}
+
+// Route describes one registered route.
+type Route struct {
+	Method     string   `json:"method"`
+	Path       string   `json:"path"`
+	Handler    string   `json:"handler"`
+	Middleware []string `json:"middleware"`
+	Meta
+}
+
+// Catalog records metadata and handler chains for the routes of one engine.
+// gin only keeps the last handler's name in engine.Routes(), so the chain is
+// captured at registration time.
+type Catalog struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	named   map[string]string // route name to path
+}
+
+type entry struct {
+	meta  Meta
+	chain []string
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{entries: map[string]entry{}, named: map[string]string{}}
+}
+
+func key(method, path string) string { return method + " " + path }
+
+// Wrap returns a Router registering on g and recording into c.
+func (c *Catalog) Wrap(g *gin.RouterGroup) Router {
+	return Router{group: g, catalog: c}
+}
+
+// Router mirrors gin.RouterGroup, taking a Meta with every route.
+type Router struct {
+	group   *gin.RouterGroup
+	catalog *Catalog
+}
+
+// Group creates a sub-router with additional middleware.
+func (r Router) Group(relativePath string, handlers ...gin.HandlerFunc) Router {
+	return Router{group: r.group.Group(relativePath, handlers...), catalog: r.catalog}
+}
+
+func (r Router) Handle(method, relativePath string, meta Meta, handlers ...gin.HandlerFunc) {
+	r.group.Handle(method, relativePath, handlers...)
+
+	chain := make([]string, 0, len(r.group.Handlers)+len(handlers))
+	for _, h := range append(append([]gin.HandlerFunc(nil), r.group.Handlers...), handlers...) {
+		chain = append(chain, nameOf(h))
+	}
+	full := joinPaths(r.group.BasePath(), relativePath)
+	r.catalog.mu.Lock()
+	r.catalog.entries[key(method, full)] = entry{meta: meta, chain: chain}
+	if meta.Name != "" {
+		r.catalog.named[meta.Name] = full
+	}
+	r.catalog.mu.Unlock()
+}
+
+func (r Router) GET(relativePath string, meta Meta, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodGet, relativePath, meta, handlers...)
+}
+
+func (r Router) POST(relativePath string, meta Meta, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPost, relativePath, meta, handlers...)
+}
+
+func (r Router) PUT(relativePath string, meta Meta, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPut, relativePath, meta, handlers...)
+}
+
+func (r Router) PATCH(relativePath string, meta Meta, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPatch, relativePath, meta, handlers...)
+}
+
+func (r Router) DELETE(relativePath string, meta Meta, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodDelete, relativePath, meta, handlers...)
+}
+
+// List returns every route of engine, joined with what c recorded about it.
+// Routes registered without the catalog list only their final handler.
+func (c *Catalog) List(engine *gin.Engine) []Route {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var out []Route
+	for _, ri := range engine.Routes() {
+		rt := Route{Method: ri.Method, Path: ri.Path, Handler: ri.Handler}
+		if e, ok := c.entries[key(ri.Method, ri.Path)]; ok {
+			rt.Meta = e.meta
+			rt.Middleware = e.chain[:len(e.chain)-1]
+		}
+		out = append(out, rt)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Method < out[j].Method
+	})
+	return out
+}
+
+// URL builds the path of the route registered under name, substituting
+// params for its :name and *name segments in order.
+func (c *Catalog) URL(name string, params ...any) (string, error) {
+	c.mu.Lock()
+	p, ok := c.named[name]
+	c.mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("routes: no route named %q", name)
+	}
+
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		if len(params) == 0 {
+			return "", fmt.Errorf("routes: missing value for %s in %s", seg, p)
+		}
+		v := fmt.Sprint(params[0])
+		params = params[1:]
+		if seg[0] == ':' {
+			v = url.PathEscape(v)
+		} else {
+			v = strings.TrimPrefix(v, "/")
+		}
+		segs[i] = v
+	}
+	if len(params) > 0 {
+		return "", fmt.Errorf("routes: too many values for %s", p)
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+// Filter keeps routes whose path starts with prefix and, if method is not
+// empty, whose method matches it case-insensitively.
+func Filter(rs []Route, prefix, method string) []Route {
+	out := []Route{}
+	for _, r := range rs {
+		if !strings.HasPrefix(r.Path, prefix) {
+			continue
+		}
+		if method != "" && !strings.EqualFold(r.Method, method) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// nameOf matches how gin names handlers in engine.Routes().
+func nameOf(h gin.HandlerFunc) string {
+	return runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+}
+
+// joinPaths mirrors gin's unexported helper of the same name.
+func joinPaths(absolutePath, relativePath string) string {
+	if relativePath == "" {
+		return absolutePath
+	}
+	final := path.Join(absolutePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(final, "/") {
+		return final + "/"
+	}
+	return final
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hook is a named cleanup step run after every listener has stopped
+// accepting connections and drained in-flight requests.
+type Hook struct {
+	Name string
+	Fn   func(ctx context.Context) error
+}
+
+// Server runs one or more HTTP listeners with a shared lifecycle: they start
+// together, and when the context is cancelled or any of them fails they are
+// all shut down gracefully.
+type Server struct {
+	drain     time.Duration
+	listeners []*Listener
+	starting  []func()
+	hooks     []Hook
+}
+
+// Listener is one address served by a Server.
+type Listener struct {
+	Name string
+	Addr string
+	srv  *http.Server
+}
+
+// New returns a Server without listeners. In-flight requests get up to drain
+// to finish once shutdown begins.
+func New(drain time.Duration) *Server {
+	return &Server{drain: drain}
+}
+
+// Listen adds a listener serving handler on addr. An addr of the form
+// "unix:/path/to.sock" listens on a Unix socket.
+func (s *Server) Listen(name, addr string, handler http.Handler) *Listener {
+	l := &Listener{
+		Name: name,
+		Addr: addr,
+		srv: &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+	s.listeners = append(s.listeners, l)
+	return l
+}
+
+// UseTLS makes the listener speak HTTPS with cfg, which must provide
+// Certificates or GetCertificate.
+func (l *Listener) UseTLS(cfg *tls.Config) {
+	l.srv.TLSConfig = cfg
+}
+
+func (l *Listener) listen() (net.Listener, error) {
+	if path, ok := strings.CutPrefix(l.Addr, "unix:"); ok {
+		// A socket left behind by an unclean exit would make Listen fail.
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", l.Addr)
+}
+
+// OnShutdownStart registers fn to run as soon as shutdown begins, before the
+// listeners stop accepting connections.
+func (s *Server) OnShutdownStart(fn func()) {
+	s.starting = append(s.starting, fn)
+}
+
+// OnShutdown registers fn to run during shutdown. Hooks run in the order they
+// were registered.
+func (s *Server) OnShutdown(name string, fn func(ctx context.Context) error) {
+	s.hooks = append(s.hooks, Hook{Name: name, Fn: fn})
+}
+
+// Run serves until ctx is cancelled or a listener fails, then shuts down.
+func (s *Server) Run(ctx context.Context) error {
+	lns := make([]net.Listener, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		ln, err := l.listen()
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return errors.Join(fmt.Errorf("%s: %w", l.Name, err), s.runHooks())
+		}
+		lns = append(lns, ln)
+	}
+
+	errc := make(chan error, len(s.listeners))
+	for i, l := range s.listeners {
+		go func(l *Listener, ln net.Listener) {
+			slog.Info("listening", "name", l.Name, "addr", l.Addr, "tls", l.srv.TLSConfig != nil)
+			var err error
+			if l.srv.TLSConfig != nil {
+				err = l.srv.ServeTLS(ln, "", "")
+			} else {
+				err = l.srv.Serve(ln)
+			}
+			errc <- fmt.Errorf("%s: %w", l.Name, err)
+		}(l, lns[i])
+	}
+
+	select {
+	case err := <-errc:
+		slog.Error("listener failed, shutting down", "err", err)
+		return errors.Join(err, s.Shutdown())
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", "drain", s.drain)
+	return s.Shutdown()
+}
+
+// Shutdown stops every listener from accepting connections, waits for active
+// requests to finish within the drain deadline and then runs the shutdown
+// hooks.
+func (s *Server) Shutdown() error {
+	for _, fn := range s.starting {
+		fn()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.drain)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, l := range s.listeners {
+		wg.Add(1)
+		go func(l *Listener) {
+			defer wg.Done()
+			if err := l.srv.Shutdown(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("drain %s: %w", l.Name, err))
+				mu.Unlock()
+			}
+		}(l)
+	}
+	wg.Wait()
+
+	return errors.Join(errors.Join(errs...), s.runHooks())
+}
+
+func (s *Server) runHooks() error {
+	var errs []error
+	for _, h := range s.hooks {
+		ctx, cancel := context.WithTimeout(context.Background(), s.drain)
+		if err := h.Fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.Name, err))
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
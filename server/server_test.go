@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// unixClient returns an address for a Unix socket in a temporary directory
+// and a client that dials it.
+func unixClient(t *testing.T) (string, *http.Client) {
+	path := filepath.Join(t.TempDir(), "s.sock")
+	return "unix:" + path, &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+// waitListening polls until the server accepts requests.
+func waitListening(t *testing.T, client *http.Client) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := client.Get("http://test/ping")
+		if err == nil {
+			resp.Body.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSignalDrainsSlowRequest(t *testing.T) {
+	started := make(chan struct{})
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	record := func(step string) {
+		mu.Lock()
+		order = append(order, step)
+		mu.Unlock()
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		record("handler")
+		io.WriteString(w, "done")
+	})
+
+	addr, client := unixClient(t)
+	s := New(5 * time.Second)
+	s.Listen("public", addr, mux)
+	s.OnShutdownStart(func() { record("start") })
+	s.OnShutdown("flush", func(context.Context) error {
+		record("flush")
+		return nil
+	})
+	s.OnShutdown("close", func(context.Context) error {
+		record("close")
+		return nil
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	waitListening(t, client)
+
+	type result struct {
+		body string
+		err  error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		resp, err := client.Get("http://test/slow")
+		if err != nil {
+			resc <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		resc <- result{string(b), err}
+	}()
+
+	<-started
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after SIGTERM")
+	}
+	if res := <-resc; res.err != nil || res.body != "done" {
+		t.Errorf("slow request: body %q, err %v", res.body, res.err)
+	}
+	if want := []string{"start", "handler", "flush", "close"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	if _, err := client.Get("http://test/ping"); err == nil {
+		t.Error("server still accepts requests after shutdown")
+	}
+}
+
+func TestDrainDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/stuck", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	addr, client := unixClient(t)
+	s := New(100 * time.Millisecond)
+	s.Listen("public", addr, mux)
+	hooked := false
+	s.OnShutdown("close", func(context.Context) error {
+		hooked = true
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	waitListening(t, client)
+	go client.Get("http://test/stuck")
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "drain public") {
+			t.Errorf("Run = %v, want a drain deadline error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run waited past the drain deadline")
+	}
+	if !hooked {
+		t.Error("hooks did not run after the drain deadline")
+	}
+}
+
+func TestHookErrors(t *testing.T) {
+	s := New(time.Second)
+	var ran []string
+	s.OnShutdown("a", func(context.Context) error {
+		ran = append(ran, "a")
+		return errors.New("boom")
+	})
+	s.OnShutdown("b", func(ctx context.Context) error {
+		ran = append(ran, "b")
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("hook context has no deadline")
+		}
+		return nil
+	})
+
+	err := s.Shutdown()
+	if err == nil || err.Error() != "a: boom" {
+		t.Errorf("Shutdown = %v, want a: boom", err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran = %v, want %v; a failing hook must not stop the rest", ran, want)
+	}
+}
+
+func TestListenFailureRunsHooks(t *testing.T) {
+	s := New(time.Second)
+	s.Listen("bad", "unix:"+filepath.Join(t.TempDir(), "missing", "s.sock"), http.NotFoundHandler())
+	hooked := false
+	s.OnShutdown("close", func(context.Context) error {
+		hooked = true
+		return nil
+	})
+	if err := s.Run(context.Background()); err == nil || !strings.HasPrefix(err.Error(), "bad: ") {
+		t.Errorf("Run = %v, want a listen error", err)
+	}
+	if !hooked {
+		t.Error("hooks did not run after a listen failure")
+	}
+}
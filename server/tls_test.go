@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePair writes cert as PEM files and sets their modification time to
+// mod, so the reloader sees a change without the test waiting for the clock.
+func writePair(t *testing.T, certFile, keyFile string, cert *tls.Certificate, mod time.Time) {
+	t.Helper()
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})
+	writeFile(t, certFile, certPEM, mod)
+	writeFile(t, keyFile, keyPEM, mod)
+}
+
+func writeFile(t *testing.T, name string, data []byte, mod time.Time) {
+	t.Helper()
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func selfSigned(t *testing.T) *tls.Certificate {
+	t.Helper()
+	cert, err := SelfSigned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// serving returns the certificate r hands out now, skipping the once a
+// second limit on looking at the files.
+func serving(t *testing.T, r *CertReloader) []byte {
+	t.Helper()
+	r.mu.Lock()
+	r.lastCheck = time.Time{}
+	r.mu.Unlock()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Certificate[0]
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if _, err := NewCertReloader(certFile, keyFile); err == nil {
+		t.Error("NewCertReloader succeeded without files")
+	}
+
+	first, second := selfSigned(t), selfSigned(t)
+	start := time.Now().Add(-time.Hour)
+	writePair(t, certFile, keyFile, first, start)
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(serving(t, r), first.Certificate[0]) {
+		t.Fatal("not serving the certificate on disk")
+	}
+
+	writePair(t, certFile, keyFile, second, start.Add(time.Minute))
+	if !bytes.Equal(serving(t, r), second.Certificate[0]) {
+		t.Fatal("rotated certificate not picked up")
+	}
+
+	// A key that does not match, as when the certificate has been replaced
+	// but the key not yet, keeps the previous pair in service.
+	writePair(t, certFile, keyFile, first, start.Add(2*time.Minute))
+	writeFile(t, keyFile, []byte("not a key"), start.Add(2*time.Minute))
+	if !bytes.Equal(serving(t, r), second.Certificate[0]) {
+		t.Fatal("failed reload replaced the certificate")
+	}
+	writePair(t, certFile, keyFile, first, start.Add(3*time.Minute))
+	if !bytes.Equal(serving(t, r), first.Certificate[0]) {
+		t.Fatal("repaired pair not picked up")
+	}
+
+	// Within a second of the last look the files are not checked again.
+	writePair(t, certFile, keyFile, second, start.Add(4*time.Minute))
+	if cert, _ := r.GetCertificate(nil); !bytes.Equal(cert.Certificate[0], first.Certificate[0]) {
+		t.Error("files checked again within a second")
+	}
+}
+
+func TestSelfSigned(t *testing.T) {
+	cert := selfSigned(t)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: pool}); err != nil {
+			t.Errorf("%s: %v", host, err)
+		}
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: pool}); err == nil {
+		t.Error("certificate valid for example.com")
+	}
+	if d := time.Until(leaf.NotAfter); d < 6*24*time.Hour || d > 7*24*time.Hour {
+		t.Errorf("expires in %v, want about a week", d)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writePair(t, certFile, keyFile, cert, time.Now())
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		t.Errorf("key does not match certificate: %v", err)
+	}
+}
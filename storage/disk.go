@@ -0,0 +1,381 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SyncPolicy decides when the write-ahead log is flushed to stable storage.
+type SyncPolicy string
+
+const (
+	// SyncAlways fsyncs after every write: nothing acknowledged is lost.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsyncs every Options.SyncInterval: a crash loses at most
+	// that much.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system.
+	SyncNever SyncPolicy = "never"
+)
+
+// Options tune a Disk store.
+type Options struct {
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+	// SnapshotInterval is how often the log is compacted into a snapshot;
+	// zero disables periodic snapshots.
+	SnapshotInterval time.Duration
+	// MaxWALBytes compacts as soon as the log grows past it; zero disables
+	// the limit.
+	MaxWALBytes int64
+}
+
+const (
+	walFile      = "wal"
+	snapshotFile = "snapshot"
+)
+
+// Disk is a KV kept in memory and made durable by an append-only
+// write-ahead log in dir. The log is periodically compacted into a snapshot
+// of the whole store. Open recovers the state from the latest snapshot plus
+// the log, discarding a torn record at the end of the log.
+type Disk struct {
+	dir  string
+	opts Options
+
+	mu      sync.RWMutex
+	data    map[string][]byte
+	wal     logFile
+	walSize int64
+	dirty   bool // written since the last fsync
+	closed  bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// logFile is what Disk needs of the log's *os.File; tests substitute one
+// that fails.
+type logFile interface {
+	io.WriteSeeker
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// Open opens or creates the store in dir.
+func Open(dir string, opts Options) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	d := &Disk{dir: dir, opts: opts, data: map[string][]byte{}, stop: make(chan struct{})}
+
+	// A snapshot only ever appears by rename, so a leftover temporary file is
+	// an interrupted compaction and the old snapshot is still valid.
+	os.Remove(filepath.Join(dir, snapshotFile+".tmp"))
+	if err := d.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := d.openWAL(); err != nil {
+		return nil, err
+	}
+
+	if opts.Sync == SyncInterval && opts.SyncInterval > 0 || opts.SnapshotInterval > 0 {
+		d.wg.Add(1)
+		go d.loop()
+	}
+	return d, nil
+}
+
+func (d *Disk) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(d.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	for {
+		r, _, err := readRecord(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		r.apply(d.data)
+	}
+}
+
+// openWAL replays the log and truncates it after the last complete record.
+func (d *Disk) openWAL() error {
+	f, err := os.OpenFile(filepath.Join(d.dir, walFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(f)
+	var off int64
+	for {
+		r, n, err := readRecord(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			info, statErr := f.Stat()
+			if statErr != nil {
+				f.Close()
+				return statErr
+			}
+			slog.Warn("storage: discarding torn write-ahead log tail",
+				"dir", d.dir, "offset", off, "bytes", info.Size()-off)
+			if err := f.Truncate(off); err != nil {
+				f.Close()
+				return err
+			}
+			break
+		}
+		r.apply(d.data)
+		off += int64(n)
+	}
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	d.wal, d.walSize = f, off
+	return nil
+}
+
+func (d *Disk) Get(key string) ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return nil, ErrClosed
+	}
+	v, ok := d.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(v), nil
+}
+
+func (d *Disk) Put(key string, value []byte) error {
+	return d.write(record{op: opPut, key: key, value: clone(value)})
+}
+
+func (d *Disk) Delete(key string) error {
+	return d.write(record{op: opDelete, key: key})
+}
+
+// Apply logs ops as a single record, so a torn write loses all of them.
+func (d *Disk) Apply(ops ...Op) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	r := record{op: opBatch, batch: make([]record, len(ops))}
+	for i, op := range ops {
+		if op.Delete {
+			r.batch[i] = record{op: opDelete, key: op.Key}
+		} else {
+			r.batch[i] = record{op: opPut, key: op.Key, value: clone(op.Value)}
+		}
+	}
+	return d.write(r)
+}
+
+func (d *Disk) Scan(prefix string, fn func(key string, value []byte) bool) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+	scan(d.data, prefix, fn)
+	return nil
+}
+
+// write logs r and then applies it, so nothing is visible that is not in the
+// log.
+func (d *Disk) write(r record) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+
+	buf := r.encode()
+	if _, err := d.wal.Write(buf); err != nil {
+		// Cut off a partial record so later appends stay readable.
+		d.rewind()
+		return err
+	}
+	if d.opts.Sync == SyncAlways {
+		if err := d.wal.Sync(); err != nil {
+			// The caller is told the write failed, so it must not come
+			// back on replay either.
+			d.rewind()
+			return err
+		}
+	} else {
+		d.dirty = true
+	}
+	d.walSize += int64(len(buf))
+	r.apply(d.data)
+
+	if d.opts.MaxWALBytes > 0 && d.walSize >= d.opts.MaxWALBytes {
+		if err := d.compact(); err != nil {
+			slog.Error("storage: compaction failed", "dir", d.dir, "err", err)
+		}
+	}
+	return nil
+}
+
+// rewind drops whatever was written to the log after the last complete
+// write.
+func (d *Disk) rewind() {
+	d.wal.Truncate(d.walSize)
+	d.wal.Seek(d.walSize, io.SeekStart)
+}
+
+// Compact writes a snapshot of the whole store and empties the log.
+func (d *Disk) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	return d.compact()
+}
+
+func (d *Disk) compact() error {
+	tmp := filepath.Join(d.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(d.data))
+	for k := range d.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	bw := bufio.NewWriter(f)
+	for _, k := range keys {
+		bw.Write(record{op: opPut, key: k, value: d.data[k]}.encode())
+	}
+	err = bw.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(d.dir, snapshotFile))
+	}
+	if err == nil {
+		err = syncDir(d.dir)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// The snapshot holds everything; replaying the old log on top of it after
+	// a crash right here would be harmless, so it is safe to cut now.
+	if err := d.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := d.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	d.walSize, d.dirty = 0, false
+	slog.Debug("storage: compacted", "dir", d.dir, "keys", len(keys))
+	return d.wal.Sync()
+}
+
+func (d *Disk) loop() {
+	defer d.wg.Done()
+
+	var syncC, snapC <-chan time.Time
+	if d.opts.Sync == SyncInterval && d.opts.SyncInterval > 0 {
+		t := time.NewTicker(d.opts.SyncInterval)
+		defer t.Stop()
+		syncC = t.C
+	}
+	if d.opts.SnapshotInterval > 0 {
+		t := time.NewTicker(d.opts.SnapshotInterval)
+		defer t.Stop()
+		snapC = t.C
+	}
+
+	for {
+		select {
+		case <-syncC:
+			if err := d.Sync(); err != nil {
+				slog.Error("storage: sync failed", "dir", d.dir, "err", err)
+			}
+		case <-snapC:
+			d.mu.Lock()
+			var err error
+			if !d.closed && d.walSize > 0 {
+				err = d.compact()
+			}
+			d.mu.Unlock()
+			if err != nil {
+				slog.Error("storage: compaction failed", "dir", d.dir, "err", err)
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// Sync flushes the log to stable storage if anything was written since the
+// last flush.
+func (d *Disk) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed || !d.dirty {
+		return nil
+	}
+	d.dirty = false
+	return d.wal.Sync()
+}
+
+// Close stops background work, flushes the log and closes it.
+func (d *Disk) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	close(d.stop)
+	d.wg.Wait()
+
+	err := d.wal.Sync()
+	if cerr := d.wal.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTest(t *testing.T, dir string) *Disk {
+	t.Helper()
+	d, err := Open(dir, Options{Sync: SyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func mustGet(t *testing.T, kv KV, key, want string) {
+	t.Helper()
+	v, err := kv.Get(key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	if string(v) != want {
+		t.Fatalf("Get(%q) = %q, want %q", key, v, want)
+	}
+}
+
+func TestDiskRecovers(t *testing.T) {
+	dir := t.TempDir()
+	d := openTest(t, dir)
+	d.Put("a", []byte("1"))
+	d.Put("b", []byte("2"))
+	d.Put("a", []byte("3"))
+	d.Delete("b")
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d = openTest(t, dir)
+	defer d.Close()
+	mustGet(t, d, "a", "3")
+	if _, err := d.Get("b"); err != ErrNotFound {
+		t.Fatalf("Get(b) err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDiskTornTail(t *testing.T) {
+	// Each case damages the log after the record for "kept"; lost says
+	// whether the record for "torn" is damaged too.
+	tails := map[string]struct {
+		tear func(wal []byte, last int) []byte
+		lost bool
+	}{
+		"truncated header":  {func(wal []byte, last int) []byte { return wal[:last+3] }, true},
+		"truncated payload": {func(wal []byte, last int) []byte { return wal[:len(wal)-2] }, true},
+		"corrupt payload": {func(wal []byte, last int) []byte {
+			wal[len(wal)-1] ^= 0xff
+			return wal
+		}, true},
+		"zeroed tail":  {func(wal []byte, last int) []byte { return append(wal, make([]byte, 512)...) }, false},
+		"garbage tail": {func(wal []byte, last int) []byte { return append(wal, "not a record at all"...) }, false},
+	}
+	for name, tc := range tails {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			d := openTest(t, dir)
+			d.Put("kept", []byte("yes"))
+			last := int(d.walSize)
+			d.Put("torn", []byte("maybe"))
+			d.Close()
+
+			path := filepath.Join(dir, walFile)
+			wal, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tc.tear(wal, last), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			d = openTest(t, dir)
+			mustGet(t, d, "kept", "yes")
+			if tc.lost {
+				if _, err := d.Get("torn"); err != ErrNotFound {
+					t.Fatalf("Get(torn) err = %v, want ErrNotFound", err)
+				}
+			} else {
+				mustGet(t, d, "torn", "maybe")
+			}
+
+			// The tail must have been cut so new writes survive the next
+			// restart.
+			d.Put("after", []byte("ok"))
+			d.Close()
+			d = openTest(t, dir)
+			defer d.Close()
+			mustGet(t, d, "kept", "yes")
+			mustGet(t, d, "after", "ok")
+		})
+	}
+}
+
+// syncFailer fails the next fsync of the log, as a full or failing disk can.
+type syncFailer struct {
+	logFile
+	fail bool
+}
+
+func (f *syncFailer) Sync() error {
+	if f.fail {
+		f.fail = false
+		return errors.New("input/output error")
+	}
+	return f.logFile.Sync()
+}
+
+func TestDiskSyncFailure(t *testing.T) {
+	dir := t.TempDir()
+	d := openTest(t, dir)
+	d.Put("kept", []byte("1"))
+	d.wal = &syncFailer{logFile: d.wal, fail: true}
+	if err := d.Put("failed", []byte("2")); err == nil {
+		t.Fatal("Put succeeded although the log could not be synced")
+	}
+	if _, err := d.Get("failed"); err != ErrNotFound {
+		t.Fatalf("failed write visible: %v", err)
+	}
+	d.Put("after", []byte("3"))
+	fi, err := os.Stat(filepath.Join(dir, walFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != d.walSize {
+		t.Fatalf("log is %d bytes, walSize %d", fi.Size(), d.walSize)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d = openTest(t, dir)
+	defer d.Close()
+	mustGet(t, d, "kept", "1")
+	mustGet(t, d, "after", "3")
+	if _, err := d.Get("failed"); err != ErrNotFound {
+		t.Fatalf("replay applied the failed write: %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir := t.TempDir()
+	d := openTest(t, dir)
+	d.Put("old", []byte("1"))
+	if err := d.Apply(Op{Key: "a", Value: []byte("x")}, Op{Key: "old", Delete: true}, Op{Key: "b", Value: nil}); err != nil {
+		t.Fatal(err)
+	}
+	last := int(d.walSize)
+	d.Apply(Op{Key: "c", Value: []byte("1")}, Op{Key: "a", Delete: true})
+	d.Close()
+
+	// Tearing the second batch anywhere loses all of it.
+	path := filepath.Join(dir, walFile)
+	wal, _ := os.ReadFile(path)
+	os.WriteFile(path, wal[:len(wal)-3], 0o644)
+
+	d = openTest(t, dir)
+	defer d.Close()
+	mustGet(t, d, "a", "x")
+	mustGet(t, d, "b", "")
+	for _, key := range []string{"old", "c"} {
+		if _, err := d.Get(key); err != ErrNotFound {
+			t.Errorf("Get(%s) err = %v, want ErrNotFound", key, err)
+		}
+	}
+	if int(d.walSize) != last {
+		t.Errorf("log is %d bytes after recovery, want %d", d.walSize, last)
+	}
+
+	m := NewMemory()
+	m.Apply(Op{Key: "a", Value: []byte("x")}, Op{Key: "a", Delete: true}, Op{Key: "b", Value: []byte("y")})
+	if _, err := m.Get("a"); err != ErrNotFound {
+		t.Errorf("memory Get(a) err = %v, want ErrNotFound", err)
+	}
+	mustGet(t, m, "b", "y")
+}
+
+func TestDiskCompact(t *testing.T) {
+	dir := t.TempDir()
+	d := openTest(t, dir)
+	for i := 0; i < 100; i++ {
+		d.Put(fmt.Sprintf("k%03d", i), []byte(fmt.Sprint(i)))
+	}
+	for i := 0; i < 100; i += 2 {
+		d.Delete(fmt.Sprintf("k%03d", i))
+	}
+	if err := d.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, walFile)); info.Size() != 0 {
+		t.Fatalf("wal size after compaction = %d, want 0", info.Size())
+	}
+	d.Put("k001", []byte("changed"))
+	d.Close()
+
+	d = openTest(t, dir)
+	defer d.Close()
+	mustGet(t, d, "k001", "changed")
+	mustGet(t, d, "k099", "99")
+	if _, err := d.Get("k000"); err != ErrNotFound {
+		t.Fatalf("Get(k000) err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDiskCompactsAtMaxWALBytes(t *testing.T) {
+	dir := t.TempDir()
+	d, err := Open(dir, Options{Sync: SyncNever, MaxWALBytes: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for i := 0; i < 100; i++ {
+		d.Put("key", make([]byte, 100))
+	}
+	if d.walSize >= 1024 {
+		t.Fatalf("wal size = %d, want below 1024", d.walSize)
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	for name, kv := range map[string]KV{"memory": NewMemory(), "disk": openTest(t, t.TempDir())} {
+		t.Run(name, func(t *testing.T) {
+			defer kv.Close()
+			for _, k := range []string{"b/2", "a/1", "b/1", "c", "b/3"} {
+				kv.Put(k, []byte(k))
+			}
+			var got []string
+			kv.Scan("b/", func(k string, v []byte) bool {
+				got = append(got, k)
+				return len(got) < 2
+			})
+			if fmt.Sprint(got) != "[b/1 b/2]" {
+				t.Fatalf("Scan = %v, want [b/1 b/2]", got)
+			}
+		})
+	}
+}
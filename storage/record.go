@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Records are framed as
+//
+//	crc32c(payload) uint32 | len(payload) uint32 | payload
+//
+// with the payload being op byte | uvarint len(key) | key | value. A batch
+// payload is opBatch followed by, for each write, op byte | uvarint len(key)
+// | key | uvarint len(value) | value. Both the write-ahead log and snapshots
+// are sequences of records; snapshots hold no batches.
+
+const (
+	opPut    byte = 1
+	opDelete byte = 2
+	opBatch  byte = 3
+
+	headerSize = 8
+	maxRecord  = 64 << 20
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// errTorn means the input ends in an incomplete or corrupt record, as left
+// behind by a crash in the middle of a write.
+var errTorn = errors.New("storage: torn or corrupt record")
+
+type record struct {
+	op    byte
+	key   string
+	value []byte
+	batch []record // for opBatch
+}
+
+func (r record) encode() []byte {
+	var payload []byte
+	if r.op == opBatch {
+		payload = append(payload, opBatch)
+		for _, b := range r.batch {
+			payload = append(payload, b.op)
+			payload = binary.AppendUvarint(payload, uint64(len(b.key)))
+			payload = append(payload, b.key...)
+			payload = binary.AppendUvarint(payload, uint64(len(b.value)))
+			payload = append(payload, b.value...)
+		}
+	} else {
+		payload = make([]byte, 0, 1+binary.MaxVarintLen64+len(r.key)+len(r.value))
+		payload = append(payload, r.op)
+		payload = binary.AppendUvarint(payload, uint64(len(r.key)))
+		payload = append(payload, r.key...)
+		payload = append(payload, r.value...)
+	}
+
+	buf := make([]byte, headerSize, headerSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], crc32.Checksum(payload, castagnoli))
+	binary.BigEndian.PutUint32(buf[4:8], uint32(len(payload)))
+	return append(buf, payload...)
+}
+
+// readRecord reads the next record and its size on disk. It returns io.EOF
+// at a clean end of input and errTorn if the remaining bytes do not form a
+// valid record.
+func readRecord(br *bufio.Reader) (record, int, error) {
+	var hdr [headerSize]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		if err == io.EOF {
+			return record{}, 0, io.EOF
+		}
+		return record{}, 0, errTorn
+	}
+	sum := binary.BigEndian.Uint32(hdr[0:4])
+	n := binary.BigEndian.Uint32(hdr[4:8])
+	if n == 0 || n > maxRecord {
+		return record{}, 0, errTorn
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return record{}, 0, errTorn
+	}
+	if crc32.Checksum(payload, castagnoli) != sum {
+		return record{}, 0, errTorn
+	}
+
+	if payload[0] == opBatch {
+		r, ok := decodeBatch(payload[1:])
+		if !ok {
+			return record{}, 0, errTorn
+		}
+		return r, headerSize + int(n), nil
+	}
+	r := record{op: payload[0]}
+	klen, w := binary.Uvarint(payload[1:])
+	if w <= 0 || uint64(len(payload)-1-w) < klen || (r.op != opPut && r.op != opDelete) {
+		return record{}, 0, errTorn
+	}
+	rest := payload[1+w:]
+	r.key = string(rest[:klen])
+	r.value = rest[klen:]
+	return r, headerSize + int(n), nil
+}
+
+func decodeBatch(b []byte) (record, bool) {
+	r := record{op: opBatch}
+	field := func() ([]byte, bool) {
+		n, w := binary.Uvarint(b)
+		if w <= 0 || uint64(len(b)-w) < n {
+			return nil, false
+		}
+		f := b[w : w+int(n)]
+		b = b[w+int(n):]
+		return f, true
+	}
+	for len(b) > 0 {
+		op := b[0]
+		b = b[1:]
+		key, ok := field()
+		if !ok {
+			return record{}, false
+		}
+		value, ok := field()
+		if !ok || (op != opPut && op != opDelete) {
+			return record{}, false
+		}
+		r.batch = append(r.batch, record{op: op, key: string(key), value: value})
+	}
+	return r, true
+}
+
+// apply replays r onto data.
+func (r record) apply(data map[string][]byte) {
+	switch r.op {
+	case opBatch:
+		for _, b := range r.batch {
+			b.apply(data)
+		}
+		return
+	case opDelete:
+		delete(data, r.key)
+		return
+	}
+	data[r.key] = r.value
+}
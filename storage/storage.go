@@ -0,0 +1,157 @@
+// Package storage provides a small embedded key/value store, either in memory
+// or durable on local disk.
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("storage: key not found")
+	ErrClosed   = errors.New("storage: store is closed")
+)
+
+// KV is an ordered key/value store. Implementations are safe for concurrent
+// use; values passed in and returned are copies the caller may keep.
+type KV interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+	// Scan calls fn for every key starting with prefix, in key order, until
+	// fn returns false. fn must not modify the store.
+	Scan(prefix string, fn func(key string, value []byte) bool) error
+	// Apply makes every write in ops, in order, as one: readers and a
+	// restart after a crash see all of them or none.
+	Apply(ops ...Op) error
+	Close() error
+}
+
+// Op is one write of a batch passed to KV.Apply.
+type Op struct {
+	Key    string
+	Value  []byte
+	Delete bool // remove Key; Value is ignored
+}
+
+// Memory is a KV that keeps everything in memory.
+type Memory struct {
+	mu     sync.RWMutex
+	data   map[string][]byte
+	closed bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{data: map[string][]byte{}}
+}
+
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	v, ok := m.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(v), nil
+}
+
+func (m *Memory) Put(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.data[key] = clone(value)
+	return nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	delete(m.data, key)
+	return nil
+}
+
+func (m *Memory) Apply(ops ...Op) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	for _, op := range ops {
+		if op.Delete {
+			delete(m.data, op.Key)
+		} else {
+			m.data[op.Key] = clone(op.Value)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Scan(prefix string, fn func(key string, value []byte) bool) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return ErrClosed
+	}
+	scan(m.data, prefix, fn)
+	return nil
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+// pingKey is written and removed again by Ping.
+const pingKey = "health/ping"
+
+// Ping writes a key to kv, reads it back and deletes it, failing if kv
+// cannot take writes.
+func Ping(kv KV) error {
+	want := []byte(time.Now().UTC().Format(time.RFC3339Nano))
+	if err := kv.Put(pingKey, want); err != nil {
+		return err
+	}
+	got, err := kv.Get(pingKey)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return errors.New("storage: read back a different value than written")
+	}
+	return kv.Delete(pingKey)
+}
+
+// scan visits the keys of data starting with prefix in order.
+func scan(data map[string][]byte, prefix string, fn func(string, []byte) bool) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !fn(k, clone(data[k])) {
+			return
+		}
+	}
+}
+
+func clone(b []byte) []byte {
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,112 @@
+package todos
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+	"tutorial/routes"
+)
+
+const maxTitle = 200
+
+// Handler serves the todo pages. Forms post back and are redirected to the
+// list, so reloading the page never resubmits them.
+type Handler struct {
+	store *Store
+	urls  *routes.Catalog
+}
+
+func NewHandler(store *Store, urls *routes.Catalog) *Handler {
+	return &Handler{store: store, urls: urls}
+}
+
+// page is the data of todos.html.
+type page struct {
+	Todos []Todo
+	Open  int
+	Error string
+	Title string // rejected form value, shown again for correction
+}
+
+func (h *Handler) Register(r routes.Router) {
+	meta := func(name, description string) routes.Meta {
+		return routes.Meta{Name: name, Description: description, Auth: "none", Owner: "platform"}
+	}
+	r.GET("", meta("todos.list", "Todo list page."), h.list)
+	r.POST("", meta("todos.create", "Adds a todo from the form field title."), h.create)
+	r.POST("/:id/toggle", meta("todos.toggle", "Marks a todo done or open."), h.toggle)
+	r.POST("/:id/delete", meta("todos.delete", "Deletes a todo."), h.delete)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	h.render(c, http.StatusOK, page{})
+}
+
+func (h *Handler) create(c *gin.Context) {
+	title := strings.TrimSpace(c.PostForm("title"))
+	switch {
+	case title == "":
+		h.render(c, http.StatusUnprocessableEntity, page{Error: "Enter what needs doing."})
+		return
+	case utf8.RuneCountInString(title) > maxTitle:
+		h.render(c, http.StatusUnprocessableEntity, page{Error: "Keep it under 200 characters.", Title: title})
+		return
+	}
+	if _, err := h.store.Add(title); err != nil {
+		c.Error(err)
+		return
+	}
+	h.redirect(c)
+}
+
+func (h *Handler) toggle(c *gin.Context) {
+	if err := h.store.Toggle(c.Param("id")); err != nil {
+		c.Error(storeError(err))
+		return
+	}
+	h.redirect(c)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	if err := h.store.Delete(c.Param("id")); err != nil {
+		c.Error(storeError(err))
+		return
+	}
+	h.redirect(c)
+}
+
+func (h *Handler) render(c *gin.Context, status int, p page) {
+	todos, err := h.store.List()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	p.Todos = todos
+	for _, t := range todos {
+		if !t.Done {
+			p.Open++
+		}
+	}
+	c.HTML(status, "todos.html", p)
+}
+
+func (h *Handler) redirect(c *gin.Context) {
+	to, err := h.urls.URL("todos.list")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, to)
+}
+
+func storeError(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return problem.NotFound("todo_not_found", "There is no such todo.")
+	}
+	return err
+}
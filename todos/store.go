@@ -0,0 +1,101 @@
+// Package todos is a small todo list served as HTML pages.
+package todos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"tutorial/storage"
+)
+
+var ErrNotFound = errors.New("todo not found")
+
+type Todo struct {
+	ID      string    `json:"id"`
+	Title   string    `json:"title"`
+	Done    bool      `json:"done"`
+	Created time.Time `json:"created"`
+}
+
+const keyPrefix = "todos/"
+
+// Store keeps todos as JSON in a storage.KV. IDs grow with creation time, so
+// listing returns todos oldest first.
+type Store struct {
+	kv   storage.KV
+	mu   sync.Mutex // serialises read-modify-write updates
+	last int64
+}
+
+func NewStore(kv storage.KV) *Store {
+	return &Store{kv: kv}
+}
+
+func (s *Store) List() ([]Todo, error) {
+	var out []Todo
+	var err error
+	scanErr := s.kv.Scan(keyPrefix, func(_ string, v []byte) bool {
+		var t Todo
+		if err = json.Unmarshal(v, &t); err != nil {
+			return false
+		}
+		out = append(out, t)
+		return true
+	})
+	return out, errors.Join(scanErr, err)
+}
+
+func (s *Store) Add(title string) (Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	id := now.UnixNano()
+	if id <= s.last {
+		id = s.last + 1
+	}
+	s.last = id
+	t := Todo{ID: fmt.Sprintf("%016x", id), Title: title, Created: now.UTC()}
+	return t, s.put(t)
+}
+
+// Toggle flips whether the todo is done.
+func (s *Store) Toggle(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, err := s.kv.Get(keyPrefix + id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	var t Todo
+	if err := json.Unmarshal(v, &t); err != nil {
+		return err
+	}
+	t.Done = !t.Done
+	return s.put(t)
+}
+
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.kv.Get(keyPrefix + id); errors.Is(err, storage.ErrNotFound) {
+		return ErrNotFound
+	}
+	return s.kv.Delete(keyPrefix + id)
+}
+
+func (s *Store) put(t Todo) error {
+	v, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put(keyPrefix+t.ID, v)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTodosPages(t *testing.T) {
+	router := newTestRouter(t)
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := post("/todos", url.Values{"title": {"Buy milk"}}); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/todos" {
+		t.Fatalf("create: %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	w := post("/todos", url.Values{"title": {"  "}})
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `class="error"`) {
+		t.Fatalf("create empty: %d %s", w.Code, w.Body)
+	}
+
+	w = get("/todos")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("list: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{"<title>Todos (1 open)</title>", "Buy milk", `href="/static/css/app.css?v=`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("list does not contain %s", want)
+		}
+	}
+
+	_, rest, _ := strings.Cut(body, `action="/todos/`)
+	id, _, _ := strings.Cut(rest, "/")
+	if w := post("/todos/"+id+"/toggle", nil); w.Code != http.StatusSeeOther {
+		t.Fatalf("toggle: %d %s", w.Code, w.Body)
+	}
+	if body := get("/todos").Body.String(); !strings.Contains(body, `<li class="done">`) {
+		t.Errorf("toggled todo is not done:\n%s", body)
+	}
+	if w := post("/todos/"+id+"/delete", nil); w.Code != http.StatusSeeOther {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if w := post("/todos/"+id+"/delete", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("delete again: %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Header names from W3C Trace Context.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+const flagSampled = 0x01
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+func newTraceID() (t TraceID) {
+	rand.Read(t[:])
+	return t
+}
+
+func newSpanID() (s SpanID) {
+	rand.Read(s[:])
+	return s
+}
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	Remote     bool
+}
+
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+func (sc SpanContext) Sampled() bool { return sc.Flags&flagSampled != 0 }
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+var errTraceparent = errors.New("tracing: malformed traceparent")
+
+// ParseTraceparent parses a traceparent header value. Versions above 00 are
+// accepted as long as their first four fields have the version 00 layout.
+func ParseTraceparent(s string) (SpanContext, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 55 || (len(s) > 55 && (s[:2] == "00" || s[55] != '-')) {
+		return SpanContext{}, errTraceparent
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return SpanContext{}, errTraceparent
+	}
+	version, ok := decodeHex(s[0:2], 1)
+	if !ok || version[0] == 0xff {
+		return SpanContext{}, errTraceparent
+	}
+
+	var sc SpanContext
+	traceID, ok1 := decodeHex(s[3:35], 16)
+	spanID, ok2 := decodeHex(s[36:52], 8)
+	flags, ok3 := decodeHex(s[53:55], 1)
+	if !ok1 || !ok2 || !ok3 {
+		return SpanContext{}, errTraceparent
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	sc.Remote = true
+	if !sc.IsValid() {
+		return SpanContext{}, errTraceparent
+	}
+	return sc, nil
+}
+
+// decodeHex accepts only lowercase hex, as the specification requires.
+func decodeHex(s string, n int) ([]byte, bool) {
+	if len(s) != 2*n || strings.ToLower(s) != s {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span as the current span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
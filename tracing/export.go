@@ -0,0 +1,168 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Exporter receives finished, sampled spans. Export must not block for long.
+type Exporter interface {
+	Export(SpanData)
+}
+
+// Exporters fans spans out to several exporters.
+type Exporters []Exporter
+
+func (es Exporters) Export(s SpanData) {
+	for _, e := range es {
+		e.Export(s)
+	}
+}
+
+// MarshalJSON renders the span in the shape of an OTLP/JSON span.
+func (s SpanData) MarshalJSON() ([]byte, error) {
+	type anyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+	type keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+	type status struct {
+		Code    string `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	out := struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		TraceState        string     `json:"traceState,omitempty"`
+		Name              string     `json:"name"`
+		Kind              string     `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes,omitempty"`
+		Status            status     `json:"status"`
+	}{
+		TraceID:           s.SpanContext.TraceID.String(),
+		SpanID:            s.SpanContext.SpanID.String(),
+		TraceState:        s.SpanContext.TraceState,
+		Name:              s.Name,
+		Kind:              s.Kind.String(),
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Status:            status{Code: s.Status.String(), Message: s.Message},
+	}
+	if s.Parent.IsValid() {
+		out.ParentSpanID = s.Parent.String()
+	}
+	for _, a := range s.Attributes {
+		var v anyValue
+		switch x := a.Value.(type) {
+		case string:
+			v.StringValue = &x
+		case bool:
+			v.BoolValue = &x
+		case int:
+			n := strconv.Itoa(x)
+			v.IntValue = &n
+		case int64:
+			n := strconv.FormatInt(x, 10)
+			v.IntValue = &n
+		case float64:
+			v.DoubleValue = &x
+		default:
+			str := jsonString(x)
+			v.StringValue = &str
+		}
+		out.Attributes = append(out.Attributes, keyValue{a.Key, v})
+	}
+	return json.Marshal(out)
+}
+
+func jsonString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// Ring keeps the most recent spans in memory.
+type Ring struct {
+	mu    sync.Mutex
+	spans []SpanData
+	next  int
+	full  bool
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{spans: make([]SpanData, size)}
+}
+
+func (r *Ring) Export(s SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans[r.next] = s
+	r.next = (r.next + 1) % len(r.spans)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Spans returns the retained spans, oldest first.
+func (r *Ring) Spans() []SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]SpanData(nil), r.spans[:r.next]...)
+	}
+	return append(append([]SpanData(nil), r.spans[r.next:]...), r.spans[:r.next]...)
+}
+
+// FileExporter appends spans to a file as JSON lines.
+type FileExporter struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (e *FileExporter) Export(s SpanData) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		slog.Error("span export failed", "err", err)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(b)
+	e.w.WriteByte('\n')
+	// Flush whole lines so the file can be tailed; the buffer only batches
+	// the line and its newline into one write.
+	if err := e.w.Flush(); err != nil {
+		slog.Error("span export failed", "err", err)
+	}
+}
+
+// Close flushes and closes the file.
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.w.Flush(); err != nil {
+		e.f.Close()
+		return err
+	}
+	return e.f.Close()
+}
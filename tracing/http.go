@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware starts a server span for every request, continuing the trace
+// from an incoming traceparent header. The span is named after the route
+// template and returned to the client in the traceparent response header.
+func Middleware(t *Tracer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if sc, err := ParseTraceparent(c.GetHeader(TraceparentHeader)); err == nil {
+			sc.TraceState = c.GetHeader(TracestateHeader)
+			ctx = ContextWithRemoteParent(ctx, sc)
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := t.Start(ctx, c.Request.Method+" "+route, KindServer)
+		defer span.End()
+		span.SetAttr("http.method", c.Request.Method)
+		span.SetAttr("http.route", route)
+		span.SetAttr("http.target", c.Request.URL.RequestURI())
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(TraceparentHeader, span.SpanContext().Traceparent())
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttr("http.status_code", status)
+		if status >= 500 {
+			span.SetStatus(StatusError, http.StatusText(status))
+		}
+		if len(c.Errors) > 0 {
+			span.SetAttr("error.message", c.Errors.String())
+		}
+	}
+}
+
+// Transport wraps outgoing requests in client spans and propagates the trace
+// through the traceparent and tracestate headers.
+func Transport(t *Tracer, base http.RoundTripper) http.RoundTripper {
+	return roundTripper{t, base}
+}
+
+type roundTripper struct {
+	tracer *Tracer
+	base   http.RoundTripper
+}
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if SpanFromContext(req.Context()) == nil {
+		return rt.base.RoundTrip(req)
+	}
+
+	ctx, span := rt.tracer.Start(req.Context(), "HTTP "+req.Method, KindClient)
+	defer span.End()
+	span.SetAttr("http.method", req.Method)
+	span.SetAttr("http.url", req.URL.Redacted())
+
+	sc := span.SpanContext()
+	req = req.Clone(ctx)
+	req.Header.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		req.Header.Set(TracestateHeader, sc.TraceState)
+	}
+
+	resp, err := rt.base.RoundTrip(req)
+	if err != nil {
+		span.SetStatus(StatusError, err.Error())
+		return nil, err
+	}
+	span.SetAttr("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		span.SetStatus(StatusError, strconv.Itoa(resp.StatusCode))
+	}
+	return resp, nil
+}
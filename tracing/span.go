@@ -0,0 +1,181 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type SpanKind int
+
+const (
+	KindInternal SpanKind = iota
+	KindServer
+	KindClient
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case KindServer:
+		return "SPAN_KIND_SERVER"
+	case KindClient:
+		return "SPAN_KIND_CLIENT"
+	}
+	return "SPAN_KIND_INTERNAL"
+}
+
+// Span is one timed operation. Its methods are safe for concurrent use and
+// do nothing once End has been called.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	kind   SpanKind
+	name   string
+	start  time.Time
+
+	mu      sync.Mutex
+	ended   bool
+	attrs   []Attribute
+	status  StatusCode
+	message string
+}
+
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+func (c StatusCode) String() string {
+	switch c {
+	case StatusOK:
+		return "STATUS_CODE_OK"
+	case StatusError:
+		return "STATUS_CODE_ERROR"
+	}
+	return "STATUS_CODE_UNSET"
+}
+
+func (s *Span) SpanContext() SpanContext { return s.sc }
+
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.name = name
+	}
+}
+
+// SetAttr records a string, bool, integer or float attribute.
+func (s *Span) SetAttr(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.attrs = append(s.attrs, Attribute{key, value})
+	}
+}
+
+func (s *Span) SetStatus(code StatusCode, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.status, s.message = code, message
+	}
+}
+
+// End finishes the span and hands it to the exporter if it is sampled.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		SpanContext: s.sc,
+		Parent:      s.parent,
+		Kind:        s.kind,
+		Name:        s.name,
+		Start:       s.start,
+		End:         time.Now(),
+		Attributes:  s.attrs,
+		Status:      s.status,
+		Message:     s.message,
+	}
+	s.mu.Unlock()
+
+	if s.sc.Sampled() && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+// SpanData is a finished span.
+type SpanData struct {
+	SpanContext SpanContext
+	Parent      SpanID
+	Kind        SpanKind
+	Name        string
+	Start, End  time.Time
+	Attributes  []Attribute
+	Status      StatusCode
+	Message     string
+}
+
+// Tracer creates spans and sends finished ones to an exporter.
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer returns a Tracer exporting to e, which may be nil to only
+// propagate context.
+func NewTracer(e Exporter) *Tracer {
+	return &Tracer{exporter: e}
+}
+
+// Start begins a span as a child of the span in ctx, or of a remote parent
+// placed there by ContextWithRemoteParent, or as a new sampled root.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+
+	var parent SpanContext
+	if p := SpanFromContext(ctx); p != nil {
+		parent = p.sc
+	} else if p, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		parent = p
+	}
+
+	if parent.IsValid() {
+		span.sc = SpanContext{TraceID: parent.TraceID, Flags: parent.Flags, TraceState: parent.TraceState}
+		span.parent = parent.SpanID
+	} else {
+		span.sc = SpanContext{TraceID: newTraceID(), Flags: flagSampled}
+	}
+	span.sc.SpanID = newSpanID()
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// Start begins a span with the tracer of the span in ctx. Handlers use it to
+// create child spans; without a current span the returned span is a no-op.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	if p := SpanFromContext(ctx); p != nil {
+		return p.tracer.Start(ctx, name, KindInternal)
+	}
+	return ctx, &Span{tracer: &Tracer{}, ended: true}
+}
+
+type remoteKey struct{}
+
+// ContextWithRemoteParent makes sc, usually parsed from an incoming request,
+// the parent of the next span started from ctx.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
@@ -0,0 +1,64 @@
+package views
+
+import (
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// helpers returns the functions available to every template. "url" is a
+// placeholder until the caller supplies one through Options.Funcs, since
+// only it knows the route names.
+func helpers(a *assets) template.FuncMap {
+	return template.FuncMap{
+		"date": func(t time.Time, layout ...string) string {
+			if t.IsZero() {
+				return ""
+			}
+			if len(layout) > 0 {
+				return t.Format(layout[0])
+			}
+			return t.Format("2 Jan 2006 15:04")
+		},
+		"url": func(name string, params ...any) (string, error) {
+			return "", fmt.Errorf("views: no url function configured for route %q", name)
+		},
+		"now":   time.Now,
+		"asset": a.path,
+	}
+}
+
+// assets maps static file names to URLs that change with their content, so
+// they can be cached forever.
+type assets struct {
+	fs     fs.FS
+	reload bool
+
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+func (a *assets) path(name string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	h, ok := a.hashes[name]
+	if !ok || a.reload {
+		b, err := fs.ReadFile(a.fs, name)
+		if err != nil {
+			return "", err
+		}
+		sum := sha3.Sum256(b)
+		h = hex.EncodeToString(sum[:4])
+		if a.hashes == nil {
+			a.hashes = map[string]string{}
+		}
+		a.hashes[name] = h
+	}
+	return "/static/" + name + "?v=" + h, nil
+}
@@ -0,0 +1,145 @@
+// Package views renders server-side HTML pages. Every page in pages/ is
+// parsed together with the layouts/ and partials/ templates and executed
+// through the base.html layout, so pages only fill in its blocks.
+package views
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// Files holds the templates/ and static/ directories compiled into the
+// binary.
+//
+//go:embed templates static
+var Files embed.FS
+
+// Layout is the file in layouts/ every page is executed through.
+const Layout = "base.html"
+
+// Options configure a Renderer.
+type Options struct {
+	// FS holds templates/ and static/; Files by default.
+	FS fs.FS
+	// Funcs are added to the helper functions and may override them.
+	Funcs template.FuncMap
+	// Reload reparses the templates on every render so edits show up
+	// without a restart. Meant for debug mode with FS on the source tree.
+	Reload bool
+}
+
+// Renderer is a gin render.HTMLRender for layout-based pages.
+type Renderer struct {
+	fs     fs.FS
+	funcs  template.FuncMap
+	reload bool
+	assets *assets
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+}
+
+// Install parses the templates and makes them what c.HTML renders on engine.
+// Template errors are reported here rather than on the first request.
+func Install(engine *gin.Engine, opts Options) (*Renderer, error) {
+	if opts.FS == nil {
+		opts.FS = Files
+	}
+	r := &Renderer{fs: opts.FS, reload: opts.Reload}
+	static, err := fs.Sub(opts.FS, "static")
+	if err != nil {
+		return nil, err
+	}
+	r.assets = &assets{fs: static, reload: opts.Reload}
+
+	funcs := helpers(r.assets)
+	for name, fn := range opts.Funcs {
+		funcs[name] = fn
+	}
+	engine.SetFuncMap(funcs)
+	r.funcs = engine.FuncMap
+
+	if r.pages, err = r.parse(); err != nil {
+		return nil, err
+	}
+	engine.HTMLRender = r
+	return r, nil
+}
+
+// Static serves the static/ directory, for mounting on "/static/*filepath".
+func (r *Renderer) Static() gin.HandlerFunc {
+	static, _ := fs.Sub(r.fs, "static")
+	fileServer := http.StripPrefix("/static", http.FileServer(http.FS(static)))
+	return func(c *gin.Context) {
+		if c.Query("v") != "" {
+			// Versioned by asset, so the content never changes.
+			c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		fileServer.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+func (r *Renderer) parse() (map[string]*template.Template, error) {
+	shared, err := template.New("").Funcs(r.funcs).ParseFS(r.fs, "templates/layouts/*.html")
+	if err != nil {
+		return nil, err
+	}
+	if partials, _ := fs.Glob(r.fs, "templates/partials/*.html"); len(partials) > 0 {
+		if _, err := shared.ParseFS(r.fs, partials...); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := fs.Glob(r.fs, "templates/pages/*.html")
+	if err != nil {
+		return nil, err
+	}
+	pages := make(map[string]*template.Template, len(files))
+	for _, file := range files {
+		t, err := shared.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.ParseFS(r.fs, file); err != nil {
+			return nil, err
+		}
+		pages[path.Base(file)] = t
+	}
+	return pages, nil
+}
+
+// Instance implements render.HTMLRender; name is a file in pages/.
+func (r *Renderer) Instance(name string, data any) render.Render {
+	if r.reload {
+		pages, err := r.parse()
+		if err != nil {
+			return errorRender{err}
+		}
+		r.mu.Lock()
+		r.pages = pages
+		r.mu.Unlock()
+	}
+
+	r.mu.RLock()
+	t, ok := r.pages[name]
+	r.mu.RUnlock()
+	if !ok {
+		return errorRender{fmt.Errorf("views: no page %q", name)}
+	}
+	return render.HTML{Template: t, Name: Layout, Data: data}
+}
+
+// errorRender fails without writing, so the error handler can still answer.
+type errorRender struct{ err error }
+
+func (e errorRender) Render(http.ResponseWriter) error { return e.err }
+
+func (e errorRender) WriteContentType(http.ResponseWriter) {}
@@ -0,0 +1,202 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// maxResponse is how much of a receiver's response is kept in the log.
+const maxResponse = 256
+
+func (d *Dispatcher) run() {
+	defer d.loop.Done()
+	for {
+		t := time.NewTimer(d.dispatch(time.Now()))
+		select {
+		case <-d.stop:
+			t.Stop()
+			return
+		case <-d.wake:
+		case <-t.C:
+		}
+		t.Stop()
+	}
+}
+
+// dispatch starts every due delivery its subscription has room for and
+// returns how long to wait before the next one is due.
+func (d *Dispatcher) dispatch(now time.Time) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.lastPurge) > time.Minute {
+		d.purgeLocked(now)
+		d.lastPurge = now
+	}
+	if err := d.fanOutLocked(); err != nil {
+		slog.Error("webhook events not queued; retrying", "err", err)
+	}
+
+	var due []*Delivery
+	for _, dl := range d.deliveries {
+		// Deliveries of disabled subscriptions wait until they are
+		// activated again.
+		if s := d.subs[dl.SubscriptionID]; dl.State == Pending && !d.inflight[dl.ID] && s != nil && s.Active {
+			due = append(due, dl)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttempt.Equal(*due[j].NextAttempt) {
+			return due[i].NextAttempt.Before(*due[j].NextAttempt)
+		}
+		return due[i].ID < due[j].ID
+	})
+
+	wait := time.Minute // also the purge interval
+	for _, dl := range due {
+		if dl.NextAttempt.After(now) {
+			wait = min(wait, dl.NextAttempt.Sub(now))
+			continue
+		}
+		s := d.subs[dl.SubscriptionID]
+		if d.busy[s.ID] >= d.opts.Concurrency {
+			continue // woken again when one of them finishes
+		}
+		d.busy[s.ID]++
+		d.inflight[dl.ID] = true
+		d.sending.Add(1)
+		go d.send(dl.ID, dl.Event, *s)
+	}
+	return wait
+}
+
+// send makes one attempt to deliver ev to s.
+func (d *Dispatcher) send(id string, ev Event, s Subscription) {
+	defer d.sending.Done()
+	att, ok := d.post(id, ev, s)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.busy[s.ID]--
+	delete(d.inflight, id)
+	d.notify()
+	if d.ctx.Err() != nil {
+		return // interrupted by shutdown; it does not count
+	}
+	if err := d.recordLocked(id, att, ok); err != nil {
+		slog.Error("save webhook delivery", "delivery", id, "err", err)
+	}
+}
+
+func (d *Dispatcher) post(id string, ev Event, s Subscription) (Attempt, bool) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return Attempt{At: time.Now().UTC(), Error: err.Error()}, false
+	}
+	ctx, cancel := context.WithTimeout(d.ctx, d.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return Attempt{At: time.Now().UTC(), Error: err.Error()}, false
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tutorial-webhooks/1")
+	req.Header.Set(HeaderID, id)
+	req.Header.Set(HeaderEvent, ev.Type)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(s.Secret, ts, body))
+
+	start := time.Now()
+	att := Attempt{At: start.UTC()}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		att.Error = err.Error()
+		att.DurationMS = msSince(start)
+		return att, false
+	}
+	defer resp.Body.Close()
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // lets the connection be reused
+	att.DurationMS = msSince(start)
+	att.Status = resp.StatusCode
+	if utf8.Valid(head) {
+		att.Response = string(head)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		att.Error = "unexpected status " + resp.Status
+		return att, false
+	}
+	return att, true
+}
+
+// recordLocked adds an attempt to a delivery and schedules a retry, gives
+// up or disables the subscription as needed.
+func (d *Dispatcher) recordLocked(id string, att Attempt, ok bool) error {
+	dl, found := d.deliveries[id]
+	if !found {
+		return nil // unsubscribed meanwhile
+	}
+	s := d.subs[dl.SubscriptionID]
+	now := time.Now().UTC()
+	dl.Attempts = append(dl.Attempts, att)
+	dl.NextAttempt = nil
+	dl.Updated = now
+	log := slog.With("delivery", id, "subscription", s.ID, "event", dl.Event.Type)
+
+	if ok {
+		dl.State = Delivered
+		s.ConsecutiveFailures = 0
+	} else {
+		s.ConsecutiveFailures++
+		if s.Active && s.ConsecutiveFailures >= d.opts.DisableAfter {
+			s.Active = false
+			s.DisabledReason = fmt.Sprintf("disabled after %d failed attempts in a row; last: %s", s.ConsecutiveFailures, att.Error)
+			log.Warn("webhook subscription disabled", "failures", s.ConsecutiveFailures)
+		}
+		if len(dl.Attempts) >= d.opts.MaxAttempts {
+			dl.State = Failed
+			log.Warn("webhook delivery failed", "attempts", len(dl.Attempts), "err", att.Error)
+		} else {
+			next := now.Add(d.backoff(len(dl.Attempts)))
+			dl.NextAttempt = &next
+		}
+	}
+	s.Updated = now
+	return errors.Join(d.saveDelivery(dl), d.saveSub(s))
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	b := d.opts.Backoff
+	for i := 1; i < attempts && b < d.opts.MaxBackoff; i++ {
+		b *= 2
+	}
+	return min(b, d.opts.MaxBackoff)
+}
+
+// purgeLocked drops finished deliveries older than Retention from the log.
+func (d *Dispatcher) purgeLocked(now time.Time) {
+	for id, dl := range d.deliveries {
+		if dl.State != Pending && now.Sub(dl.Updated) > d.opts.Retention {
+			if err := d.kv.Delete(deliveryPrefix + id); err != nil {
+				slog.Error("purge webhook delivery", "delivery", id, "err", err)
+				return
+			}
+			delete(d.deliveries, id)
+		}
+	}
+}
+
+func msSince(t time.Time) float64 {
+	return float64(time.Since(t).Microseconds()) / 1000
+}
@@ -0,0 +1,539 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"tutorial/storage"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrDeliveryNotFound     = errors.New("delivery not found")
+	ErrUnknownEvent         = errors.New("unknown event type")
+	ErrDisabled             = errors.New("subscription is disabled")
+)
+
+// Options tune a Dispatcher.
+type Options struct {
+	// EventTypes are the types that can be subscribed to.
+	EventTypes []string
+	// Concurrency is how many deliveries may be in flight to one
+	// subscription at a time.
+	Concurrency int
+	// Timeout limits one attempt.
+	Timeout time.Duration
+	// Backoff is the wait before the first retry; it doubles with every
+	// further failure up to MaxBackoff.
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+	// DisableAfter is how many attempts in a row may fail before the
+	// subscription is disabled.
+	DisableAfter int
+	// Retention is how long finished deliveries are kept in the log.
+	Retention time.Duration
+}
+
+const (
+	subPrefix      = "webhooks/subscriptions/"
+	deliveryPrefix = "webhooks/deliveries/"
+	outboxPrefix   = "webhooks/outbox/"
+)
+
+// Dispatcher manages subscriptions and delivers events to them. Events are
+// first staged in an outbox in the KV, written together with the change
+// they describe, and then turned into deliveries, which are written to the
+// KV before anything is sent: whatever was staged or pending when the
+// process stopped is sent after a restart.
+type Dispatcher struct {
+	kv     storage.KV
+	client *http.Client
+	opts   Options
+
+	mu         sync.Mutex
+	subs       map[string]*Subscription
+	deliveries map[string]*Delivery
+	busy       map[string]int // in-flight deliveries per subscription
+	inflight   map[string]bool
+	lastID     int64
+	lastPurge  time.Time
+
+	wake    chan struct{}
+	stop    chan struct{}
+	ctx     context.Context // cancelled to abort in-flight requests
+	cancel  context.CancelFunc
+	loop    sync.WaitGroup
+	sending sync.WaitGroup
+}
+
+// New loads the subscriptions and deliveries kept in kv. Deliveries are
+// POSTed with client, which is not allowed to follow redirects.
+func New(kv storage.KV, client *http.Client, opts Options) (*Dispatcher, error) {
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	d := &Dispatcher{
+		kv:         kv,
+		client:     &c,
+		opts:       opts,
+		subs:       map[string]*Subscription{},
+		deliveries: map[string]*Delivery{},
+		busy:       map[string]int{},
+		inflight:   map[string]bool{},
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+
+	if err := load(kv, subPrefix, func(s *Subscription) { d.subs[s.ID] = s }); err != nil {
+		return nil, fmt.Errorf("load webhook subscriptions: %w", err)
+	}
+	if err := load(kv, deliveryPrefix, func(dl *Delivery) { d.deliveries[dl.ID] = dl }); err != nil {
+		return nil, fmt.Errorf("load webhook deliveries: %w", err)
+	}
+	return d, nil
+}
+
+func load[T any](kv storage.KV, prefix string, add func(*T)) error {
+	var err error
+	scanErr := kv.Scan(prefix, func(_ string, v []byte) bool {
+		x := new(T)
+		if err = json.Unmarshal(v, x); err != nil {
+			return false
+		}
+		add(x)
+		return true
+	})
+	return errors.Join(scanErr, err)
+}
+
+// Start begins delivering.
+func (d *Dispatcher) Start() {
+	d.loop.Add(1)
+	go d.run()
+}
+
+// Close stops delivering. Requests in flight get until ctx is done to
+// complete; interrupted ones are retried after the next start, as is every
+// other pending delivery.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	close(d.stop)
+	d.loop.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		d.sending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+	}
+	d.cancel()
+
+	d.mu.Lock()
+	pending := 0
+	for _, dl := range d.deliveries {
+		if dl.State == Pending {
+			pending++
+		}
+	}
+	d.mu.Unlock()
+	if pending > 0 {
+		slog.Warn("webhook deliveries pending at shutdown", "count", pending)
+	}
+	return nil
+}
+
+// Stats counts the deliveries in the log by state.
+func (d *Dispatcher) Stats() map[DeliveryState]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := map[DeliveryState]int{}
+	for _, dl := range d.deliveries {
+		out[dl.State]++
+	}
+	return out
+}
+
+// Check fails once the dispatcher is closed, or while subscriptions are
+// disabled because their endpoints kept failing.
+func (d *Dispatcher) Check(context.Context) error {
+	select {
+	case <-d.stop:
+		return errors.New("webhook dispatcher is closed")
+	default:
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var disabled []string
+	for id, s := range d.subs {
+		if !s.Active && s.DisabledReason != "" {
+			disabled = append(disabled, id)
+		}
+	}
+	if len(disabled) > 0 {
+		sort.Strings(disabled)
+		return fmt.Errorf("%d subscriptions disabled after failed deliveries: %v", len(disabled), disabled)
+	}
+	return nil
+}
+
+// Subscribe adds a subscription to events. An empty secret gets a random
+// one.
+func (d *Dispatcher) Subscribe(url string, events []string, secret string) (Subscription, error) {
+	if err := d.checkEvents(events); err != nil {
+		return Subscription{}, err
+	}
+	if secret == "" {
+		secret = "whsec_" + randomHex(24)
+	}
+	now := time.Now().UTC()
+	s := &Subscription{
+		ID:      randomHex(8),
+		URL:     url,
+		Events:  slices.Clone(events),
+		Secret:  secret,
+		Active:  true,
+		Created: now,
+		Updated: now,
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.saveSub(s); err != nil {
+		return Subscription{}, err
+	}
+	d.subs[s.ID] = s
+	return *s, nil
+}
+
+// Subscriptions returns every subscription, oldest first, without secrets.
+func (d *Dispatcher) Subscriptions() []Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Subscription, 0, len(d.subs))
+	for _, s := range d.subs {
+		out = append(out, s.redacted())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Created.Equal(out[j].Created) {
+			return out[i].Created.Before(out[j].Created)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Subscription returns the subscription with id, without its secret.
+func (d *Dispatcher) Subscription(id string) (Subscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.subs[id]
+	if !ok {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return s.redacted(), nil
+}
+
+// Update holds the fields of a subscription to change; nil ones are kept.
+type Update struct {
+	URL    *string   `json:"url" binding:"omitempty,http_url,max=2048"`
+	Events *[]string `json:"events" binding:"omitempty,min=1,max=20,dive,required,max=64"`
+	Secret *string   `json:"secret" binding:"omitempty,min=16,max=128"`
+	Active *bool     `json:"active"`
+}
+
+// Update changes a subscription. Activating a disabled one resets its
+// failure count and resumes its pending deliveries.
+func (d *Dispatcher) Update(id string, u Update) (Subscription, error) {
+	if u.Events != nil {
+		if err := d.checkEvents(*u.Events); err != nil {
+			return Subscription{}, err
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.subs[id]
+	if !ok {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	next := *s
+	if u.URL != nil {
+		next.URL = *u.URL
+	}
+	if u.Events != nil {
+		next.Events = slices.Clone(*u.Events)
+	}
+	if u.Secret != nil {
+		next.Secret = *u.Secret
+	}
+	if u.Active != nil {
+		if *u.Active && !s.Active {
+			next.ConsecutiveFailures, next.DisabledReason = 0, ""
+		}
+		next.Active = *u.Active
+	}
+	next.Updated = time.Now().UTC()
+	if err := d.saveSub(&next); err != nil {
+		return Subscription{}, err
+	}
+	*s = next
+	d.notify()
+	return s.redacted(), nil
+}
+
+// Unsubscribe deletes the subscription with id and its deliveries.
+func (d *Dispatcher) Unsubscribe(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.subs[id]; !ok {
+		return ErrSubscriptionNotFound
+	}
+	if err := d.kv.Delete(subPrefix + id); err != nil {
+		return err
+	}
+	delete(d.subs, id)
+	for did, dl := range d.deliveries {
+		if dl.SubscriptionID == id {
+			if err := d.kv.Delete(deliveryPrefix + did); err != nil {
+				return err
+			}
+			delete(d.deliveries, did)
+		}
+	}
+	return nil
+}
+
+// Stage returns the write that puts an event of type typ carrying data in
+// the outbox. Callers make it in the same storage.KV.Apply as the change
+// the event describes, so neither is stored without the other, and call
+// Notify afterwards.
+func (d *Dispatcher) Stage(typ string, data any) (storage.Op, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return storage.Op{}, err
+	}
+	d.mu.Lock()
+	id := d.nextIDLocked()
+	d.mu.Unlock()
+	ev, err := json.Marshal(Event{ID: id, Type: typ, Created: time.Now().UTC(), Data: raw})
+	if err != nil {
+		return storage.Op{}, err
+	}
+	return storage.Op{Key: outboxPrefix + id, Value: ev}, nil
+}
+
+// Notify tells the dispatcher that staged events were written.
+func (d *Dispatcher) Notify() {
+	d.notify()
+}
+
+// Publish stages an event of type typ carrying data and queues it for every
+// active subscription that wants it. It returns once the deliveries are
+// stored.
+func (d *Dispatcher) Publish(_ context.Context, typ string, data any) error {
+	op, err := d.Stage(typ, data)
+	if err != nil {
+		return err
+	}
+	if err := d.kv.Apply(op); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notify()
+	return d.fanOutLocked()
+}
+
+// fanOutLocked turns the events in the outbox into deliveries, oldest
+// first. An event leaves the outbox in the same write that stores its
+// deliveries.
+func (d *Dispatcher) fanOutLocked() error {
+	var (
+		staged []Event
+		err    error
+	)
+	scanErr := d.kv.Scan(outboxPrefix, func(_ string, v []byte) bool {
+		var ev Event
+		if err = json.Unmarshal(v, &ev); err != nil {
+			return false
+		}
+		staged = append(staged, ev)
+		return true
+	})
+	if err := errors.Join(scanErr, err); err != nil {
+		return fmt.Errorf("read webhook outbox: %w", err)
+	}
+
+	for _, ev := range staged {
+		ops := []storage.Op{{Key: outboxPrefix + ev.ID, Delete: true}}
+		var queued []*Delivery
+		for _, s := range d.subs {
+			if !s.Active || !s.wants(ev.Type) {
+				continue
+			}
+			dl := d.newDeliveryLocked(s.ID, ev, "")
+			data, err := json.Marshal(dl)
+			if err != nil {
+				return err
+			}
+			ops = append(ops, storage.Op{Key: deliveryPrefix + dl.ID, Value: data})
+			queued = append(queued, dl)
+		}
+		if err := d.kv.Apply(ops...); err != nil {
+			return err
+		}
+		for _, dl := range queued {
+			d.deliveries[dl.ID] = dl
+		}
+	}
+	return nil
+}
+
+// Deliveries returns the delivery log of a subscription, newest first.
+func (d *Dispatcher) Deliveries(subID string) ([]Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.subs[subID]; !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+	out := []Delivery{}
+	for _, dl := range d.deliveries {
+		if dl.SubscriptionID == subID {
+			out = append(out, *dl)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out, nil
+}
+
+// Delivery returns one delivery of a subscription.
+func (d *Dispatcher) Delivery(subID, id string) (Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dl, err := d.deliveryLocked(subID, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	return *dl, nil
+}
+
+// Redeliver sends the event of a delivery again as a new delivery, with a
+// fresh set of attempts.
+func (d *Dispatcher) Redeliver(subID, id string) (Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dl, err := d.deliveryLocked(subID, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if !d.subs[subID].Active {
+		return Delivery{}, ErrDisabled
+	}
+	again, err := d.queueLocked(subID, dl.Event, dl.ID)
+	if err != nil {
+		return Delivery{}, err
+	}
+	d.notify()
+	return *again, nil
+}
+
+func (d *Dispatcher) deliveryLocked(subID, id string) (*Delivery, error) {
+	if _, ok := d.subs[subID]; !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+	dl, ok := d.deliveries[id]
+	if !ok || dl.SubscriptionID != subID {
+		return nil, ErrDeliveryNotFound
+	}
+	return dl, nil
+}
+
+// queueLocked stores a pending delivery of ev to a subscription.
+func (d *Dispatcher) queueLocked(subID string, ev Event, redeliveryOf string) (*Delivery, error) {
+	dl := d.newDeliveryLocked(subID, ev, redeliveryOf)
+	if err := d.saveDelivery(dl); err != nil {
+		return nil, err
+	}
+	d.deliveries[dl.ID] = dl
+	return dl, nil
+}
+
+// newDeliveryLocked returns a pending delivery of ev to a subscription,
+// due now.
+func (d *Dispatcher) newDeliveryLocked(subID string, ev Event, redeliveryOf string) *Delivery {
+	now := time.Now().UTC()
+	return &Delivery{
+		ID:             d.nextIDLocked(),
+		SubscriptionID: subID,
+		Event:          ev,
+		State:          Pending,
+		Attempts:       []Attempt{},
+		NextAttempt:    &now,
+		RedeliveryOf:   redeliveryOf,
+		Created:        now,
+		Updated:        now,
+	}
+}
+
+// nextIDLocked returns an ID for an event or delivery that sorts by
+// creation time.
+func (d *Dispatcher) nextIDLocked() string {
+	id := time.Now().UnixNano()
+	if id <= d.lastID {
+		id = d.lastID + 1
+	}
+	d.lastID = id
+	return fmt.Sprintf("%016x", id)
+}
+
+func (d *Dispatcher) checkEvents(events []string) error {
+	for _, e := range events {
+		if e != "*" && !slices.Contains(d.opts.EventTypes, e) {
+			return fmt.Errorf("%w %q", ErrUnknownEvent, e)
+		}
+	}
+	return nil
+}
+
+// notify wakes the delivery loop.
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) saveSub(s *Subscription) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return d.kv.Put(subPrefix+s.ID, data)
+}
+
+func (d *Dispatcher) saveDelivery(dl *Delivery) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	return d.kv.Put(deliveryPrefix+dl.ID, data)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
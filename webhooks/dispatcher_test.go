@@ -0,0 +1,371 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tutorial/storage"
+)
+
+func testOptions() Options {
+	return Options{
+		EventTypes:   []string{"album.created", "album.deleted"},
+		Concurrency:  2,
+		Timeout:      time.Second,
+		Backoff:      time.Millisecond,
+		MaxBackoff:   4 * time.Millisecond,
+		MaxAttempts:  3,
+		DisableAfter: 100,
+		Retention:    time.Hour,
+	}
+}
+
+// receiver is a webhook endpoint that verifies signatures and answers with
+// the status status returns for the n-th request, counting from 1.
+type receiver struct {
+	*httptest.Server
+	secret string
+	status func(n int) int
+	delay  time.Duration
+
+	mu       sync.Mutex
+	events   []Event
+	requests int
+	inFlight int
+	maxPar   int
+	badSig   int
+}
+
+func newReceiver(t *testing.T, secret string, status func(n int) int) *receiver {
+	r := &receiver{secret: secret, status: status}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) serve(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.requests++
+	n := r.requests
+	r.inFlight++
+	r.maxPar = max(r.maxPar, r.inFlight)
+	if err := Verify(r.secret, req.Header, body, time.Minute, time.Now()); err != nil {
+		r.badSig++
+	}
+	r.mu.Unlock()
+
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight--
+	status := r.status(n)
+	if status == http.StatusOK {
+		var ev Event
+		json.Unmarshal(body, &ev)
+		r.events = append(r.events, ev)
+	}
+	w.WriteHeader(status)
+}
+
+func always(status int) func(int) int { return func(int) int { return status } }
+
+func newTestDispatcher(t *testing.T, kv storage.KV, opts Options) *Dispatcher {
+	t.Helper()
+	d, err := New(kv, http.DefaultClient, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Start()
+	t.Cleanup(func() { d.Close(context.Background()) })
+	return d
+}
+
+func subscribe(t *testing.T, d *Dispatcher, r *receiver) Subscription {
+	t.Helper()
+	s, err := d.Subscribe(r.URL, []string{"*"}, r.secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// waitFor polls the only delivery of s until cond holds.
+func waitFor(t *testing.T, d *Dispatcher, subID string, cond func(Delivery) bool) Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ds, err := d.Deliveries(subID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ds) > 0 && cond(ds[0]) {
+			return ds[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met; deliveries: %+v", ds)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func state(s DeliveryState) func(Delivery) bool {
+	return func(dl Delivery) bool { return dl.State == s }
+}
+
+func TestDeliverySigned(t *testing.T) {
+	d := newTestDispatcher(t, storage.NewMemory(), testOptions())
+	r := newReceiver(t, "0123456789abcdef", always(http.StatusOK))
+	s := subscribe(t, d, r)
+
+	if err := d.Publish(context.Background(), "album.created", map[string]string{"id": "a1"}); err != nil {
+		t.Fatal(err)
+	}
+	dl := waitFor(t, d, s.ID, state(Delivered))
+	if len(dl.Attempts) != 1 || dl.Attempts[0].Status != http.StatusOK {
+		t.Errorf("attempts = %+v", dl.Attempts)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.badSig != 0 {
+		t.Errorf("%d requests with a bad signature", r.badSig)
+	}
+	if len(r.events) != 1 || r.events[0].Type != "album.created" || string(r.events[0].Data) != `{"id":"a1"}` {
+		t.Errorf("received %+v", r.events)
+	}
+}
+
+func TestRetryUntilDelivered(t *testing.T) {
+	d := newTestDispatcher(t, storage.NewMemory(), testOptions())
+	r := newReceiver(t, "0123456789abcdef", func(n int) int {
+		if n <= 2 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	})
+	s := subscribe(t, d, r)
+	d.Publish(context.Background(), "album.created", nil)
+
+	dl := waitFor(t, d, s.ID, state(Delivered))
+	if len(dl.Attempts) != 3 || dl.Attempts[0].Status != 500 || dl.Attempts[0].Error == "" {
+		t.Errorf("attempts = %+v", dl.Attempts)
+	}
+	if s, _ := d.Subscription(s.ID); s.ConsecutiveFailures != 0 {
+		t.Errorf("consecutive failures = %d after a success", s.ConsecutiveFailures)
+	}
+}
+
+func TestGiveUpAndRedeliver(t *testing.T) {
+	d := newTestDispatcher(t, storage.NewMemory(), testOptions())
+	var healthy atomic.Bool
+	r := newReceiver(t, "0123456789abcdef", func(int) int {
+		if healthy.Load() {
+			return http.StatusOK
+		}
+		return http.StatusServiceUnavailable
+	})
+	s := subscribe(t, d, r)
+	d.Publish(context.Background(), "album.deleted", map[string]string{"id": "a1"})
+
+	failed := waitFor(t, d, s.ID, state(Failed))
+	if len(failed.Attempts) != 3 {
+		t.Errorf("gave up after %d attempts, want 3", len(failed.Attempts))
+	}
+
+	healthy.Store(true)
+	again, err := d.Redeliver(s.ID, failed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.RedeliveryOf != failed.ID || again.Event.ID != failed.Event.ID {
+		t.Errorf("redelivery = %+v", again)
+	}
+	dl := waitFor(t, d, s.ID, state(Delivered))
+	if dl.ID != again.ID {
+		t.Errorf("newest delivery is %s, want the redelivery %s", dl.ID, again.ID)
+	}
+}
+
+func TestDisableAfterFailures(t *testing.T) {
+	opts := testOptions()
+	opts.DisableAfter, opts.MaxAttempts = 2, 10
+	d := newTestDispatcher(t, storage.NewMemory(), opts)
+	var healthy atomic.Bool
+	r := newReceiver(t, "0123456789abcdef", func(int) int {
+		if healthy.Load() {
+			return http.StatusOK
+		}
+		return http.StatusBadGateway
+	})
+	s := subscribe(t, d, r)
+	d.Publish(context.Background(), "album.created", nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Active {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription still active")
+		}
+		time.Sleep(time.Millisecond)
+		s, _ = d.Subscription(s.ID)
+	}
+	if s.DisabledReason == "" {
+		t.Error("disabled without a reason")
+	}
+
+	// While disabled nothing is sent and new events are not queued.
+	d.Publish(context.Background(), "album.created", nil)
+	time.Sleep(20 * time.Millisecond)
+	ds, _ := d.Deliveries(s.ID)
+	if len(ds) != 1 || ds[0].State != Pending || len(ds[0].Attempts) != 2 {
+		t.Fatalf("deliveries while disabled: %+v", ds)
+	}
+	if _, err := d.Redeliver(s.ID, ds[0].ID); err != ErrDisabled {
+		t.Errorf("Redeliver while disabled: err = %v", err)
+	}
+
+	healthy.Store(true)
+	active := true
+	if _, err := d.Update(s.ID, Update{Active: &active}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, d, s.ID, state(Delivered))
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	d := newTestDispatcher(t, storage.NewMemory(), testOptions())
+	r := newReceiver(t, "0123456789abcdef", always(http.StatusOK))
+	r.delay = 20 * time.Millisecond
+	s := subscribe(t, d, r)
+	for i := 0; i < 6; i++ {
+		d.Publish(context.Background(), "album.created", i)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.mu.Lock()
+		n, par := len(r.events), r.maxPar
+		r.mu.Unlock()
+		if n == 6 {
+			if par != 2 {
+				t.Errorf("at most %d requests in flight, want 2", par)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of 6 events delivered", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// The receiver has seen every event; the outcomes are recorded once the
+	// responses are read.
+	for {
+		ds, _ := d.Deliveries(s.ID)
+		pending := 0
+		for _, dl := range ds {
+			if dl.State != Delivered {
+				pending++
+			}
+		}
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d deliveries not marked delivered", pending)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	kv := storage.NewMemory()
+	r := newReceiver(t, "0123456789abcdef", always(http.StatusOK))
+
+	// Not started: the event only reaches the outbox.
+	first, err := New(kv, http.DefaultClient, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := subscribe(t, first, r)
+	first.Publish(context.Background(), "album.created", nil)
+	first.Close(context.Background())
+
+	d := newTestDispatcher(t, kv, testOptions())
+	waitFor(t, d, s.ID, state(Delivered))
+}
+
+func TestStagedEventSurvivesRestart(t *testing.T) {
+	kv := storage.NewMemory()
+	r := newReceiver(t, "0123456789abcdef", always(http.StatusOK))
+
+	// The change and its event are written together, and the process stops
+	// before the event became a delivery.
+	first, err := New(kv, http.DefaultClient, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := subscribe(t, first, r)
+	op, err := first.Stage("album.created", map[string]string{"id": "a1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Apply(storage.Op{Key: "albums/a1", Value: []byte("{}")}, op); err != nil {
+		t.Fatal(err)
+	}
+	first.Close(context.Background())
+
+	d := newTestDispatcher(t, kv, testOptions())
+	waitFor(t, d, s.ID, state(Delivered))
+	ds, _ := d.Deliveries(s.ID)
+	if len(ds) != 1 || string(ds[0].Event.Data) != `{"id":"a1"}` {
+		t.Errorf("deliveries = %+v, want the staged event once", ds)
+	}
+	if err := kv.Scan(outboxPrefix, func(k string, _ []byte) bool {
+		t.Errorf("%s still in the outbox", k)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscribeUnknownEvent(t *testing.T) {
+	d := newTestDispatcher(t, storage.NewMemory(), testOptions())
+	if _, err := d.Subscribe("http://example.com", []string{"album.exploded"}, ""); err == nil {
+		t.Fatal("subscribed to an unknown event type")
+	}
+	s, err := d.Subscribe("http://example.com", []string{"album.created"}, "")
+	if err != nil || s.Secret == "" {
+		t.Fatalf("Subscribe = %+v, %v; want a generated secret", s, err)
+	}
+	if got, _ := d.Subscription(s.ID); got.Secret != "" {
+		t.Error("secret shown after creation")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"e1"}`)
+	now := time.Unix(1_700_000_000, 0)
+	h := http.Header{}
+	h.Set(HeaderTimestamp, "1700000000")
+	h.Set(HeaderSignature, Sign("secret", now.Unix(), body))
+
+	if err := Verify("secret", h, body, time.Minute, now); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := Verify("other", h, body, time.Minute, now); err != ErrBadSignature {
+		t.Errorf("wrong secret: %v", err)
+	}
+	if err := Verify("secret", h, []byte(`{"id":"e2"}`), time.Minute, now); err != ErrBadSignature {
+		t.Errorf("tampered body: %v", err)
+	}
+	if err := Verify("secret", h, body, time.Minute, now.Add(2*time.Minute)); err != ErrStale {
+		t.Errorf("replayed late: %v", err)
+	}
+}
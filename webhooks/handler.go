@@ -0,0 +1,180 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+	"tutorial/routes"
+)
+
+// Handler serves the subscription management API.
+type Handler struct {
+	d *Dispatcher
+}
+
+func NewHandler(d *Dispatcher) *Handler {
+	return &Handler{d: d}
+}
+
+type subscribeRequest struct {
+	URL    string   `json:"url" binding:"required,http_url,max=2048"`
+	Events []string `json:"events" binding:"required,min=1,max=20,dive,required,max=64"`
+	Secret string   `json:"secret" binding:"omitempty,min=16,max=128"`
+}
+
+type subURI struct {
+	ID string `uri:"id" binding:"required,max=64,alphanum"`
+}
+
+type deliveryURI struct {
+	ID       string `uri:"id" binding:"required,max=64,alphanum"`
+	Delivery string `uri:"delivery" binding:"required,max=64,alphanum"`
+}
+
+// Register mounts the endpoints on r, typically /api/webhooks.
+func (h *Handler) Register(r routes.Router) {
+	meta := func(description string) routes.Meta {
+		return routes.Meta{Description: description, Auth: "none", Owner: "platform"}
+	}
+	r.POST("", meta("Subscribes a URL to event types; the answer holds the signing secret."), h.subscribe)
+	r.GET("", meta("Lists webhook subscriptions."), h.list)
+	r.GET("/:id", meta("Returns a webhook subscription."), h.get)
+	r.PATCH("/:id", meta("Changes the URL, events or secret of a subscription, or (de)activates it."), h.update)
+	r.DELETE("/:id", meta("Deletes a subscription and its delivery log."), h.unsubscribe)
+	r.GET("/:id/deliveries", meta("Delivery log of a subscription, newest first."), h.deliveries)
+	r.GET("/:id/deliveries/:delivery", meta("One delivery with all its attempts."), h.delivery)
+	r.POST("/:id/deliveries/:delivery/redeliver", meta("Sends a delivery's event again."), h.redeliver)
+}
+
+func (h *Handler) subscribe(c *gin.Context) {
+	var req subscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	s, err := h.d.Subscribe(req.URL, req.Events, req.Secret)
+	if err != nil {
+		c.Error(h.dispatchError(err))
+		return
+	}
+	c.Header("Location", c.FullPath()+"/"+s.ID)
+	c.JSON(http.StatusCreated, s)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	c.JSON(http.StatusOK, h.d.Subscriptions())
+}
+
+func (h *Handler) get(c *gin.Context) {
+	var uri subURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	s, err := h.d.Subscription(uri.ID)
+	if err != nil {
+		c.Error(h.dispatchError(err))
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func (h *Handler) update(c *gin.Context) {
+	var uri subURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	var u Update
+	if err := c.ShouldBindJSON(&u); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	s, err := h.d.Update(uri.ID, u)
+	if err != nil {
+		c.Error(h.dispatchError(err))
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func (h *Handler) unsubscribe(c *gin.Context) {
+	var uri subURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	if err := h.d.Unsubscribe(uri.ID); err != nil {
+		c.Error(h.dispatchError(err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) deliveries(c *gin.Context) {
+	var uri subURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	ds, err := h.d.Deliveries(uri.ID)
+	if err != nil {
+		c.Error(h.dispatchError(err))
+		return
+	}
+	c.JSON(http.StatusOK, ds)
+}
+
+func (h *Handler) delivery(c *gin.Context) {
+	var uri deliveryURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	dl, err := h.d.Delivery(uri.ID, uri.Delivery)
+	if err != nil {
+		c.Error(h.dispatchError(err))
+		return
+	}
+	c.JSON(http.StatusOK, dl)
+}
+
+func (h *Handler) redeliver(c *gin.Context) {
+	var uri deliveryURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	dl, err := h.d.Redeliver(uri.ID, uri.Delivery)
+	if err != nil {
+		c.Error(h.dispatchError(err))
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, uri.Delivery+"/redeliver")+dl.ID)
+	c.JSON(http.StatusAccepted, dl)
+}
+
+// dispatchError maps dispatcher errors to problems; anything else becomes a
+// 500.
+func (h *Handler) dispatchError(err error) error {
+	switch {
+	case errors.Is(err, ErrUnknownEvent):
+		e := problem.New(http.StatusUnprocessableEntity, "validation_failed", "The request has invalid fields.")
+		e.Fields = []problem.FieldError{{
+			Field:   "events",
+			Message: strings.TrimPrefix(err.Error(), ErrUnknownEvent.Error()+" ") + " is not one of: *, " + strings.Join(h.d.opts.EventTypes, ", "),
+		}}
+		return e
+	case errors.Is(err, ErrSubscriptionNotFound):
+		return problem.NotFound("subscription_not_found", "There is no such webhook subscription.")
+	case errors.Is(err, ErrDeliveryNotFound):
+		return problem.NotFound("delivery_not_found", "The subscription has no such delivery.")
+	case errors.Is(err, ErrDisabled):
+		return problem.Conflict("subscription_disabled", "Activate the subscription before redelivering.")
+	}
+	return err
+}
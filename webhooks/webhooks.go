@@ -0,0 +1,127 @@
+// Package webhooks notifies subscribed endpoints of changes by POSTing
+// signed JSON events to them, retrying until they accept.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of every delivery.
+const (
+	HeaderID        = "X-Webhook-ID" // the delivery, stable across retries
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp" // Unix seconds when the attempt was signed
+	HeaderSignature = "X-Webhook-Signature" // "sha256=" and the hex HMAC
+)
+
+// Subscription is an endpoint and the event types it wants.
+type Subscription struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"` // event types, or "*" for all
+	// Secret signs deliveries. It is only shown when the subscription is
+	// created.
+	Secret string `json:"secret,omitempty"`
+	Active bool   `json:"active"`
+	// DisabledReason says why an endpoint that kept failing was disabled.
+	DisabledReason      string    `json:"disabled_reason,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Created             time.Time `json:"created"`
+	Updated             time.Time `json:"updated"`
+}
+
+func (s *Subscription) wants(typ string) bool {
+	for _, e := range s.Events {
+		if e == "*" || e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// redacted returns s without its secret.
+func (s Subscription) redacted() Subscription {
+	s.Secret = ""
+	return s
+}
+
+// Event is what is POSTed to the subscribers.
+type Event struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Created time.Time       `json:"created"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type DeliveryState string
+
+const (
+	Pending   DeliveryState = "pending"
+	Delivered DeliveryState = "delivered"
+	Failed    DeliveryState = "failed" // gave up
+)
+
+// Delivery is one event on its way to one subscription, with the outcome
+// of every attempt.
+type Delivery struct {
+	ID             string        `json:"id"`
+	SubscriptionID string        `json:"subscription_id"`
+	Event          Event         `json:"event"`
+	State          DeliveryState `json:"state"`
+	Attempts       []Attempt     `json:"attempts"`
+	NextAttempt    *time.Time    `json:"next_attempt,omitempty"`
+	// RedeliveryOf is the delivery this one repeats on request.
+	RedeliveryOf string    `json:"redelivery_of,omitempty"`
+	Created      time.Time `json:"created"`
+	Updated      time.Time `json:"updated"`
+}
+
+// Attempt is one POST of a delivery.
+type Attempt struct {
+	At         time.Time `json:"at"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Response   string    `json:"response,omitempty"` // start of the response body
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// Sign returns the signature header value for body sent at timestamp: the
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	ErrBadSignature = errors.New("webhook signature does not match")
+	ErrStale        = errors.New("webhook timestamp is too old or in the future")
+)
+
+// Verify checks the signature of a delivery as its receiver would: it must
+// match and be signed within tolerance of now, which defeats replays.
+func Verify(secret string, h http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(h.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return ErrStale
+	}
+	want := Sign(secret, ts, body)
+	got := strings.TrimSpace(h.Get(HeaderSignature))
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		return ErrBadSignature
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tutorial/webhooks"
+)
+
+func TestWebhooks(t *testing.T) {
+	router := newTestRouter(t, "-webhooks.allow_private")
+
+	received := make(chan webhooks.Event, 10)
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhooks.Verify(secret, r.Header, body, time.Minute, time.Now()); err != nil {
+			t.Errorf("delivery %s: %v", r.Header.Get(webhooks.HeaderID), err)
+		}
+		var ev webhooks.Event
+		json.Unmarshal(body, &ev)
+		received <- ev
+	}))
+	defer receiver.Close()
+
+	w := serveJSON(router, "POST", "/api/webhooks", `{"url":"`+receiver.URL+`","events":["album.created"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("subscribe: status %d; body: %s", w.Code, w.Body)
+	}
+	var sub webhooks.Subscription
+	json.Unmarshal(w.Body.Bytes(), &sub)
+	secret = sub.Secret
+	if secret == "" || w.Header().Get("Location") != "/api/webhooks/"+sub.ID {
+		t.Fatalf("subscription %+v, Location %q", sub, w.Header().Get("Location"))
+	}
+
+	serveJSON(router, "POST", "/api/v1/albums", `{"id":"bt","title":"Blue Train","artist":"John Coltrane","price":56.99}`)
+	serveJSON(router, "DELETE", "/api/v1/albums/bt", "") // not subscribed to
+	select {
+	case ev := <-received:
+		if ev.Type != "album.created" {
+			t.Errorf("received %s", ev.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+
+	var log []webhooks.Delivery
+	for deadline := time.Now().Add(5 * time.Second); len(log) != 1 || log[0].State != webhooks.Delivered; {
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery log: %+v", log)
+		}
+		json.Unmarshal(serveJSON(router, "GET", "/api/webhooks/"+sub.ID+"/deliveries", "").Body.Bytes(), &log)
+		time.Sleep(time.Millisecond)
+	}
+
+	base := "/api/webhooks/" + sub.ID
+	w = serveJSON(router, "POST", base+"/deliveries/"+log[0].ID+"/redeliver", "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("redeliver: status %d; body: %s", w.Code, w.Body)
+	}
+	var again webhooks.Delivery
+	json.Unmarshal(w.Body.Bytes(), &again)
+	if loc := w.Header().Get("Location"); loc != base+"/deliveries/"+again.ID {
+		t.Errorf("redeliver Location = %q", loc)
+	}
+	select {
+	case ev := <-received:
+		if ev.ID != log[0].Event.ID {
+			t.Errorf("redelivered event %s, want %s", ev.ID, log[0].Event.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no redelivery")
+	}
+
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"secret hidden", "GET", base, "", 200},
+		{"unknown event type", "POST", "/api/webhooks", `{"url":"https://example.com","events":["album.exploded"]}`, 422},
+		{"not a url", "POST", "/api/webhooks", `{"url":"ftp://example.com","events":["*"]}`, 422},
+		{"short secret", "POST", "/api/webhooks", `{"url":"https://example.com","events":["*"],"secret":"short"}`, 422},
+		{"deactivate", "PATCH", base, `{"active":false}`, 200},
+		{"redeliver while disabled", "POST", base + "/deliveries/" + log[0].ID + "/redeliver", "", 409},
+		{"unknown delivery", "GET", base + "/deliveries/ffff", "", 404},
+		{"unsubscribe", "DELETE", base, "", 204},
+		{"unknown subscription", "GET", base, "", 404},
+	}
+	for _, s := range steps {
+		w := serveJSON(router, s.method, s.path, s.body)
+		if w.Code != s.wantStatus {
+			t.Errorf("%s: status = %d, want %d; body: %s", s.name, w.Code, s.wantStatus, w.Body)
+		}
+		if s.name == "secret hidden" && json.Valid(w.Body.Bytes()) {
+			var got webhooks.Subscription
+			json.Unmarshal(w.Body.Bytes(), &got)
+			if got.Secret != "" {
+				t.Error("GET shows the secret")
+			}
+		}
+	}
+}
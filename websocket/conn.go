@@ -0,0 +1,402 @@
+// Package websocket implements the WebSocket protocol (RFC 6455) on top of
+// net/http: the server handshake, a client, and message framing.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType is the type of a data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// Close codes from RFC 6455 section 7.4.1.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005 // never sent; reported when a close frame had no code
+	CloseAbnormal        = 1006 // never sent; reported when the connection dropped
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+	CloseTryAgainLater   = 1013
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+
+	finBit  = 0x80
+	maskBit = 0x80
+
+	maxControlPayload = 125
+
+	// DefaultReadLimit is the largest message read unless SetReadLimit
+	// changes it.
+	DefaultReadLimit = 1 << 20
+
+	closeTimeout = 5 * time.Second
+)
+
+// CloseError is returned by ReadMessage once the peer closed the connection,
+// or after the connection was closed because the peer broke the protocol.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("websocket: closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: closed with code %d: %s", e.Code, e.Text)
+}
+
+// IsClose reports whether err is a CloseError with one of the codes, or any
+// CloseError if no codes are given.
+func IsClose(err error, codes ...int) bool {
+	var ce *CloseError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	if len(codes) == 0 {
+		return true
+	}
+	for _, c := range codes {
+		if ce.Code == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a WebSocket connection. One goroutine may read while others
+// write; writes are serialised.
+type Conn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	isServer bool
+
+	readLimit int64
+	onPong    func(data []byte)
+	readErr   error
+
+	wmu       sync.Mutex
+	bw        *bufio.Writer
+	closeSent bool
+}
+
+func newConn(c net.Conn, br *bufio.Reader, isServer bool) *Conn {
+	return &Conn{
+		conn:      c,
+		br:        br,
+		bw:        bufio.NewWriter(c),
+		isServer:  isServer,
+		readLimit: DefaultReadLimit,
+	}
+}
+
+// SetReadLimit bounds the size of a message, after reassembly of fragments.
+// Larger messages close the connection with CloseMessageTooBig.
+func (c *Conn) SetReadLimit(n int64) { c.readLimit = n }
+
+// SetPongHandler sets a function called from ReadMessage for every pong.
+func (c *Conn) SetPongHandler(fn func(data []byte)) { c.onPong = fn }
+
+func (c *Conn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+func (c *Conn) RemoteAddr() net.Addr               { return c.conn.RemoteAddr() }
+
+// ReadMessage returns the next data message, answering pings and handling
+// the close handshake on the way. Once it has failed it keeps returning the
+// same error.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	typ, data, err := c.readMessage()
+	if err != nil {
+		c.readErr = err
+	}
+	return typ, data, err
+}
+
+func (c *Conn) readMessage() (MessageType, []byte, error) {
+	var (
+		typ     MessageType
+		message []byte
+		started bool
+	)
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+
+		switch f.op {
+		case opPing:
+			if err := c.writeFrame(opPong, f.payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			if c.onPong != nil {
+				c.onPong(f.payload)
+			}
+			continue
+		case opClose:
+			return 0, nil, c.handleClose(f.payload)
+		case opText, opBinary:
+			if started {
+				return 0, nil, c.fail(protocolError("new message before the previous one finished"))
+			}
+			started, typ = true, MessageType(f.op)
+		case opContinuation:
+			if !started {
+				return 0, nil, c.fail(protocolError("continuation frame without a message"))
+			}
+		default:
+			return 0, nil, c.fail(protocolError(fmt.Sprintf("unknown opcode %#x", f.op)))
+		}
+
+		if int64(len(message))+int64(len(f.payload)) > c.readLimit {
+			return 0, nil, c.fail(&CloseError{Code: CloseMessageTooBig, Text: fmt.Sprintf("message exceeds %d bytes", c.readLimit)})
+		}
+		message = append(message, f.payload...)
+		if f.fin {
+			if typ == TextMessage && !utf8.Valid(message) {
+				return 0, nil, c.fail(&CloseError{Code: CloseInvalidPayload, Text: "text message is not valid UTF-8"})
+			}
+			return typ, message, nil
+		}
+	}
+}
+
+type frame struct {
+	fin     bool
+	op      byte
+	payload []byte
+}
+
+func protocolError(text string) *CloseError {
+	return &CloseError{Code: CloseProtocolError, Text: text}
+}
+
+func (c *Conn) readFrame() (frame, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{fin: hdr[0]&finBit != 0, op: hdr[0] & 0x0f}
+	if hdr[0]&0x70 != 0 {
+		return frame{}, protocolError("reserved bits set without an extension")
+	}
+	masked := hdr[1]&maskBit != 0
+	if masked != c.isServer {
+		return frame{}, protocolError("clients must mask frames and servers must not")
+	}
+
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+		if n>>63 != 0 {
+			return frame{}, protocolError("payload length has the high bit set")
+		}
+	}
+	if f.op >= opClose {
+		if !f.fin || n > maxControlPayload {
+			return frame{}, protocolError("control frames must be unfragmented and at most 125 bytes")
+		}
+	}
+	// Checked before allocating, so a bogus length cannot exhaust memory.
+	if n > uint64(c.readLimit) {
+		return frame{}, &CloseError{Code: CloseMessageTooBig, Text: fmt.Sprintf("message exceeds %d bytes", c.readLimit)}
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return frame{}, err
+		}
+	}
+	f.payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return frame{}, err
+	}
+	if masked {
+		mask(key, f.payload)
+	}
+	return f, nil
+}
+
+// fail turns a read error into the error ReadMessage returns, closing the
+// connection: with the matching close code if the peer broke the protocol,
+// as abnormal if the connection just ended.
+func (c *Conn) fail(err error) error {
+	var ce *CloseError
+	if errors.As(err, &ce) {
+		c.writeClose(ce.Code, ce.Text)
+		c.conn.Close()
+		return ce
+	}
+	c.conn.Close()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &CloseError{Code: CloseAbnormal, Text: "connection closed without a close frame"}
+	}
+	return err
+}
+
+// handleClose answers the peer's close frame and closes the connection.
+func (c *Conn) handleClose(payload []byte) error {
+	ce := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		return c.fail(protocolError("close frame with a one-byte payload"))
+	case len(payload) >= 2:
+		ce.Code = int(binary.BigEndian.Uint16(payload))
+		ce.Text = string(payload[2:])
+		if !validCloseCode(ce.Code) {
+			return c.fail(protocolError(fmt.Sprintf("invalid close code %d", ce.Code)))
+		}
+		if !utf8.ValidString(ce.Text) {
+			return c.fail(&CloseError{Code: CloseInvalidPayload, Text: "close reason is not valid UTF-8"})
+		}
+	}
+	reply := ce.Code
+	if reply == CloseNoStatus {
+		reply = CloseNormal
+	}
+	c.writeClose(reply, "")
+	c.conn.Close()
+	return ce
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011, code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// WriteMessage sends data as a single frame.
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", typ)
+	}
+	return c.writeFrame(byte(typ), data)
+}
+
+// Ping sends a ping; the peer's pong goes to the pong handler.
+func (c *Conn) Ping(data []byte) error {
+	if len(data) > maxControlPayload {
+		return errors.New("websocket: ping payload over 125 bytes")
+	}
+	return c.writeFrame(opPing, data)
+}
+
+// Close starts the close handshake with code and reason and closes the
+// connection once the peer answered, or after a timeout. A reader goroutine
+// sees the answer as a CloseError.
+func (c *Conn) Close(code int, reason string) error {
+	if err := c.writeClose(code, reason); err != nil {
+		c.conn.Close()
+		return err
+	}
+	// Without a concurrent reader, wait for the peer's close frame here.
+	time.AfterFunc(closeTimeout, func() { c.conn.Close() })
+	return nil
+}
+
+// CloseNow closes the underlying connection without a handshake.
+func (c *Conn) CloseNow() error {
+	return c.conn.Close()
+}
+
+func (c *Conn) writeClose(code int, reason string) error {
+	if len(reason) > maxControlPayload-2 {
+		reason = reason[:maxControlPayload-2]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	return c.writeFrame(opClose, payload)
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return errors.New("websocket: write after close")
+	}
+	if op == opClose {
+		c.closeSent = true
+	}
+
+	hdr := make([]byte, 0, 14)
+	hdr = append(hdr, finBit|op)
+	var m byte
+	if !c.isServer {
+		m = maskBit
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		hdr = append(hdr, m|byte(n))
+	case n <= 0xffff:
+		hdr = append(hdr, m|126)
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr = append(hdr, m|127)
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	if !c.isServer {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		hdr = append(hdr, key[:]...)
+		masked := append([]byte(nil), payload...)
+		mask(key, masked)
+		payload = masked
+	}
+
+	c.bw.Write(hdr)
+	c.bw.Write(payload)
+	return c.bw.Flush()
+}
+
+func mask(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"tutorial/problem"
+	"tutorial/routes"
+)
+
+// Handler serves the WebSocket endpoints through a Hub.
+type Handler struct {
+	hub     *Hub
+	origins func() []string
+}
+
+// NewHandler accepts browsers from the page's own origin and from those
+// origins returns, which may include "*".
+func NewHandler(hub *Hub, origins func() []string) *Handler {
+	return &Handler{hub: hub, origins: origins}
+}
+
+type roomURI struct {
+	Name string `uri:"name" binding:"required,max=64,alphanum"`
+}
+
+// Register mounts /echo and /rooms/:name on r, typically /ws.
+func (h *Handler) Register(r routes.Router) {
+	meta := func(description string) routes.Meta {
+		return routes.Meta{Description: description, Auth: "none", Owner: "platform"}
+	}
+	r.GET("/echo", meta("WebSocket that echoes every message."), h.echo)
+	r.GET("/rooms/:name", meta("WebSocket relaying messages to everyone in the room."), h.room)
+}
+
+func (h *Handler) echo(c *gin.Context) {
+	if conn, ok := h.upgrade(c); ok {
+		h.hub.Echo(conn)
+	}
+}
+
+func (h *Handler) room(c *gin.Context) {
+	var uri roomURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(problem.FromBinding(err))
+		return
+	}
+	if conn, ok := h.upgrade(c); ok {
+		h.hub.Join(uri.Name, conn)
+	}
+}
+
+func (h *Handler) upgrade(c *gin.Context) (*Conn, bool) {
+	if !h.originAllowed(c.Request) {
+		c.Error(problem.New(http.StatusForbidden, "origin_not_allowed", "WebSocket connections from this origin are not allowed."))
+		return nil, false
+	}
+	// Only recorded, for the access log and metrics: the response itself is
+	// written by Upgrade on the hijacked connection.
+	c.Status(http.StatusSwitchingProtocols)
+	conn, err := Upgrade(c.Writer, c.Request)
+	var he *HandshakeError
+	if errors.As(err, &he) {
+		c.Error(problem.New(he.Status, "websocket_handshake", he.Reason))
+		return nil, false
+	}
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+	return conn, true
+}
+
+// originAllowed guards against cross-site WebSocket hijacking: browsers
+// send cookies with the handshake whatever page opened it.
+func (h *Handler) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // not a browser
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+		return true
+	}
+	allowed := h.origins()
+	return slices.Contains(allowed, origin) || slices.Contains(allowed, "*")
+}
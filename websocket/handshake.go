@@ -0,0 +1,153 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// acceptGUID is appended to the client's key to derive Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// HandshakeError describes why a request could not be upgraded. Nothing
+// has been written to the client when Upgrade returns one.
+type HandshakeError struct {
+	Status int
+	Reason string
+}
+
+func (e *HandshakeError) Error() string { return "websocket: " + e.Reason }
+
+// Upgrade completes the opening handshake on a GET request and takes over
+// its connection. On a *HandshakeError the caller should answer the request
+// itself with the error's status.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		return nil, &HandshakeError{http.StatusMethodNotAllowed, "the handshake must be a GET request"}
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, &HandshakeError{http.StatusUpgradeRequired, "not a WebSocket handshake"}
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, &HandshakeError{http.StatusUpgradeRequired, "unsupported Sec-WebSocket-Version"}
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		return nil, &HandshakeError{http.StatusBadRequest, "invalid Sec-WebSocket-Key"}
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("websocket: response writer cannot be hijacked")
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// The server's deadlines do not apply to the hijacked connection.
+	conn.SetDeadline(time.Time{})
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newConn(conn, brw.Reader, true), nil
+}
+
+// headerContains reports whether the comma-separated header contains token,
+// case-insensitively.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Dial opens a client connection to a ws:// or wss:// URL. header is sent
+// with the handshake, e.g. to set Origin.
+func Dial(ctx context.Context, rawURL string, header http.Header) (*Conn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	var d net.Dialer
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = d.DialContext(ctx, "tcp", hostPort(u, "80"))
+	case "wss":
+		td := tls.Dialer{NetDialer: &d, Config: &tls.Config{ServerName: u.Hostname()}}
+		conn, err = td.DialContext(ctx, "tcp", hostPort(u, "443"))
+	default:
+		return nil, nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	key := base64.StdEncoding.EncodeToString(raw)
+
+	u.Scheme = map[string]string{"ws": "http", "wss": "https"}[u.Scheme]
+	req := &http.Request{Method: http.MethodGet, URL: u, Host: u.Host, Header: http.Header{}}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!headerContains(resp.Header, "Upgrade", "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, resp, fmt.Errorf("websocket: handshake failed with status %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return newConn(conn, br, false), resp, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
@@ -0,0 +1,210 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// HubOptions tune a Hub.
+type HubOptions struct {
+	// Queue is how many messages may wait for a slow connection before it
+	// is disconnected.
+	Queue int
+	// MaxMessage is the largest message accepted from a client.
+	MaxMessage int64
+	// PingInterval is how often idle connections are pinged; a connection
+	// that does not answer within two intervals is dropped.
+	PingInterval time.Duration
+}
+
+// Hub owns WebSocket connections and relays messages between the members
+// of named rooms. Each connection gets its own write queue and writer
+// goroutine, so one slow client never blocks the others.
+type Hub struct {
+	opts HubOptions
+
+	mu     sync.Mutex
+	rooms  map[string]map[*client]struct{}
+	conns  map[*client]struct{}
+	closed bool
+}
+
+type message struct {
+	typ  MessageType
+	data []byte
+}
+
+type client struct {
+	conn *Conn
+	room string
+	send chan message
+	// closeCode is sent as the close frame once send is closed.
+	closeCode int
+	closeText string
+}
+
+func NewHub(opts HubOptions) *Hub {
+	return &Hub{opts: opts, rooms: map[string]map[*client]struct{}{}, conns: map[*client]struct{}{}}
+}
+
+// Join adds conn to room and relays its messages to every member, itself
+// included, until the connection ends. It blocks for the connection's
+// lifetime.
+func (h *Hub) Join(room string, conn *Conn) {
+	h.serve(conn, room, func(cl *client, typ MessageType, data []byte) {
+		h.Broadcast(room, typ, data)
+	})
+}
+
+// Echo sends every message from conn back to it until the connection ends.
+func (h *Hub) Echo(conn *Conn) {
+	h.serve(conn, "", func(cl *client, typ MessageType, data []byte) {
+		h.enqueue(cl, message{typ, data})
+	})
+}
+
+// Broadcast queues a message for every member of room.
+func (h *Hub) Broadcast(room string, typ MessageType, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for cl := range h.rooms[room] {
+		h.enqueueLocked(cl, message{typ, data})
+	}
+}
+
+// Rooms returns the member count of every room.
+func (h *Hub) Rooms() map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(map[string]int, len(h.rooms))
+	for name, members := range h.rooms {
+		out[name] = len(members)
+	}
+	return out
+}
+
+// Close disconnects every connection with CloseGoingAway. Hijacked
+// connections are invisible to http.Server.Shutdown, so this must run when
+// shutdown starts.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for cl := range h.conns {
+		h.removeLocked(cl, CloseGoingAway, "server shutting down")
+	}
+}
+
+func (h *Hub) serve(conn *Conn, room string, onMessage func(*client, MessageType, []byte)) {
+	cl := &client{conn: conn, room: room, send: make(chan message, h.opts.Queue)}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		conn.writeClose(CloseGoingAway, "server shutting down")
+		conn.CloseNow()
+		return
+	}
+	h.conns[cl] = struct{}{}
+	if room != "" {
+		if h.rooms[room] == nil {
+			h.rooms[room] = map[*client]struct{}{}
+		}
+		h.rooms[room][cl] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.write(cl)
+	}()
+
+	conn.SetReadLimit(h.opts.MaxMessage)
+	wait := 2 * h.opts.PingInterval
+	conn.SetReadDeadline(time.Now().Add(wait))
+	conn.SetPongHandler(func([]byte) { conn.SetReadDeadline(time.Now().Add(wait)) })
+	for {
+		typ, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		conn.SetReadDeadline(time.Now().Add(wait))
+		onMessage(cl, typ, data)
+	}
+
+	// The reader has already answered or sent a close frame.
+	h.remove(cl, 0, "")
+	<-done
+	conn.CloseNow()
+}
+
+func (h *Hub) enqueue(cl *client, m message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.enqueueLocked(cl, m)
+}
+
+func (h *Hub) enqueueLocked(cl *client, m message) {
+	if _, ok := h.conns[cl]; !ok {
+		return
+	}
+	select {
+	case cl.send <- m:
+	default:
+		h.removeLocked(cl, CloseTryAgainLater, "too slow to keep up")
+	}
+}
+
+func (h *Hub) remove(cl *client, code int, text string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(cl, code, text)
+}
+
+// removeLocked takes cl out of the hub and stops its writer, which sends a
+// close frame with code unless it is zero.
+func (h *Hub) removeLocked(cl *client, code int, text string) {
+	if _, ok := h.conns[cl]; !ok {
+		return
+	}
+	delete(h.conns, cl)
+	if members := h.rooms[cl.room]; members != nil {
+		delete(members, cl)
+		if len(members) == 0 {
+			delete(h.rooms, cl.room)
+		}
+	}
+	cl.closeCode, cl.closeText = code, text
+	close(cl.send)
+}
+
+// write drains the client's queue and pings it while idle.
+func (h *Hub) write(cl *client) {
+	ping := time.NewTicker(h.opts.PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case m, ok := <-cl.send:
+			cl.conn.SetWriteDeadline(time.Now().Add(h.opts.PingInterval))
+			if !ok {
+				if cl.closeCode != 0 {
+					cl.conn.Close(cl.closeCode, cl.closeText)
+				}
+				return
+			}
+			if err := cl.conn.WriteMessage(m.typ, m.data); err != nil {
+				cl.conn.CloseNow()
+				h.remove(cl, 0, "")
+				return
+			}
+		case <-ping.C:
+			cl.conn.SetWriteDeadline(time.Now().Add(h.opts.PingInterval))
+			if err := cl.conn.Ping(nil); err != nil {
+				cl.conn.CloseNow()
+				h.remove(cl, 0, "")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package websocket
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoServer echoes messages with a 1 KiB read limit.
+func echoServer(t *testing.T) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			t.Log(err)
+			return
+		}
+		conn.SetReadLimit(1024)
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(typ, data)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { conn.CloseNow() })
+	return conn
+}
+
+// rawFrame writes a frame as a client would, with full control over the
+// header bits.
+func rawFrame(t *testing.T, c *Conn, first byte, payload []byte, masked bool) {
+	t.Helper()
+	b := []byte{first}
+	m := byte(0)
+	if masked {
+		m = maskBit
+	}
+	if len(payload) > 125 {
+		b = append(b, m|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(payload)))
+	} else {
+		b = append(b, m|byte(len(payload)))
+	}
+	p := append([]byte(nil), payload...)
+	if masked {
+		key := [4]byte{1, 2, 3, 4}
+		b = append(b, key[:]...)
+		mask(key, p)
+	}
+	if _, err := c.conn.Write(append(b, p...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	conn := dial(t, echoServer(t))
+	for _, m := range []struct {
+		typ  MessageType
+		data string
+	}{
+		{TextMessage, "hello"},
+		{BinaryMessage, "\x00\x01\x02"},
+		{TextMessage, strings.Repeat("x", 500)}, // 16-bit length
+		{TextMessage, ""},
+	} {
+		if err := conn.WriteMessage(m.typ, []byte(m.data)); err != nil {
+			t.Fatal(err)
+		}
+		typ, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != m.typ || string(data) != m.data {
+			t.Errorf("echo = %d %q, want %d %q", typ, data, m.typ, m.data)
+		}
+	}
+}
+
+func TestFragmentsAndInterleavedPing(t *testing.T) {
+	conn := dial(t, echoServer(t))
+	pongs := make(chan string, 1)
+	conn.SetPongHandler(func(b []byte) { pongs <- string(b) })
+
+	rawFrame(t, conn, opText, []byte("hel"), true)
+	rawFrame(t, conn, finBit|opPing, []byte("are you there"), true)
+	rawFrame(t, conn, opContinuation, []byte("lo "), true)
+	rawFrame(t, conn, finBit|opContinuation, []byte("world"), true)
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello world" {
+		t.Errorf("reassembled %q", data)
+	}
+	select {
+	case p := <-pongs:
+		if p != "are you there" {
+			t.Errorf("pong payload %q", p)
+		}
+	default:
+		t.Error("no pong for the ping")
+	}
+}
+
+func TestProtocolViolationsClose(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(t *testing.T, c *Conn)
+		code int
+	}{
+		{"too big", func(t *testing.T, c *Conn) { c.WriteMessage(BinaryMessage, make([]byte, 2000)) }, CloseMessageTooBig},
+		{"too big in fragments", func(t *testing.T, c *Conn) {
+			rawFrame(t, c, opBinary, make([]byte, 400), true)
+			rawFrame(t, c, opContinuation, make([]byte, 400), true)
+			rawFrame(t, c, finBit|opContinuation, make([]byte, 400), true)
+		}, CloseMessageTooBig},
+		{"invalid utf-8", func(t *testing.T, c *Conn) { c.WriteMessage(TextMessage, []byte{0xff, 0xfe}) }, CloseInvalidPayload},
+		{"unmasked", func(t *testing.T, c *Conn) { rawFrame(t, c, finBit|opText, []byte("hi"), false) }, CloseProtocolError},
+		{"reserved bits", func(t *testing.T, c *Conn) { rawFrame(t, c, finBit|0x40|opText, []byte("hi"), true) }, CloseProtocolError},
+		{"stray continuation", func(t *testing.T, c *Conn) { rawFrame(t, c, finBit|opContinuation, []byte("hi"), true) }, CloseProtocolError},
+		{"fragmented ping", func(t *testing.T, c *Conn) { rawFrame(t, c, opPing, nil, true) }, CloseProtocolError},
+		{"bad close code", func(t *testing.T, c *Conn) { rawFrame(t, c, finBit|opClose, []byte{0x03, 0xe7}, true) }, CloseProtocolError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dial(t, echoServer(t))
+			tt.send(t, conn)
+			_, _, err := conn.ReadMessage()
+			if !IsClose(err, tt.code) {
+				t.Fatalf("err = %v, want close code %d", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	conn := dial(t, echoServer(t))
+	if err := conn.Close(CloseNormal, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := conn.ReadMessage()
+	if !IsClose(err, CloseNormal) {
+		t.Fatalf("err = %v, want the server's CloseNormal answer", err)
+	}
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := Upgrade(w, r); err != nil {
+			w.WriteHeader(err.(*HandshakeError).Status)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"plain request", nil, http.StatusUpgradeRequired},
+		{"old version", map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8"}, http.StatusUpgradeRequired},
+		{"bad key", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "short"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tutorial/websocket"
+)
+
+func dialTest(t *testing.T, url string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, resp, err := websocket.Dial(ctx, url, header)
+	if conn != nil {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		t.Cleanup(func() { conn.CloseNow() })
+	}
+	return conn, resp, err
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	srv := httptest.NewServer(newTestRouter(t))
+	defer srv.Close()
+	base := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, _, err := dialTest(t, base+"/ws/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte("ping?"))
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "ping?" {
+		t.Fatalf("echo = %q, %v", data, err)
+	}
+
+	// Messages above websocket.max_message_bytes end the connection.
+	conn.WriteMessage(websocket.BinaryMessage, make([]byte, 128<<10))
+	if _, _, err := conn.ReadMessage(); !websocket.IsClose(err, websocket.CloseMessageTooBig) {
+		t.Fatalf("err = %v, want close code %d", err, websocket.CloseMessageTooBig)
+	}
+}
+
+func TestWebSocketRooms(t *testing.T) {
+	srv := httptest.NewServer(newTestRouter(t))
+	defer srv.Close()
+	base := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	alice, _, err := dialTest(t, base+"/ws/rooms/lobby", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, _, err := dialTest(t, base+"/ws/rooms/lobby", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := dialTest(t, base+"/ws/rooms/other", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make sure bob has joined before alice speaks: bob's own message comes
+	// back to him only once he is a member.
+	bob.WriteMessage(websocket.TextMessage, []byte("bob here"))
+	if _, data, err := bob.ReadMessage(); err != nil || string(data) != "bob here" {
+		t.Fatalf("bob got %q, %v", data, err)
+	}
+	if _, data, err := alice.ReadMessage(); err != nil || string(data) != "bob here" {
+		t.Fatalf("alice got %q, %v", data, err)
+	}
+
+	alice.WriteMessage(websocket.TextMessage, []byte("hi bob"))
+	for name, conn := range map[string]*websocket.Conn{"alice": alice, "bob": bob} {
+		if _, data, err := conn.ReadMessage(); err != nil || string(data) != "hi bob" {
+			t.Errorf("%s got %q, %v", name, data, err)
+		}
+	}
+
+	other.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := other.ReadMessage(); err == nil {
+		t.Errorf("other room got %q", data)
+	}
+}
+
+func TestWebSocketHandshakeErrors(t *testing.T) {
+	srv := httptest.NewServer(newTestRouter(t, "-cors.allowed_origins=https://app.example"))
+	defer srv.Close()
+	base := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	tests := []struct {
+		name   string
+		path   string
+		origin string
+		want   int
+	}{
+		{"foreign origin", "/ws/echo", "https://evil.example", http.StatusForbidden},
+		{"listed origin", "/ws/echo", "https://app.example", http.StatusSwitchingProtocols},
+		{"bad room name", "/ws/rooms/no-dashes", "", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.origin != "" {
+			header.Set("Origin", tt.origin)
+		}
+		_, resp, _ := dialTest(t, base+tt.path, header)
+		if resp == nil || resp.StatusCode != tt.want {
+			t.Errorf("%s: response %v, want status %d", tt.name, resp, tt.want)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/ws/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("plain GET: status %d, want %d", resp.StatusCode, http.StatusUpgradeRequired)
+	}
+}